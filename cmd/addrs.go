@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+func AddrsCmd() *cobra.Command {
+	var filename string
+	var names []string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "addrs",
+		Short: "List the addresses of a message",
+		Long: `List every mailbox of the address headers of a message (From, Sender,
+Reply-To, To, Cc, Bcc and their Resent- forms) with its decoded display name,
+group and address. Internationalized domains are shown in Unicode as well:
+	gemm addrs -f test.eml
+Choose headers with --header, and use -o json or -o yaml to get the local
+part, domain and Unicode domain of each mailbox as separate fields:
+	gemm addrs -f test.eml -H To -H Cc -o json
+An mbox, MMDF or Maildir mailbox lists the addresses of every message:
+	gemm addrs -f archive.mbox -H From`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if filename == "" {
+				return fmt.Errorf("please specify a file with -f")
+			}
+			return forEachMessage(filename, format, func(r io.Reader, out *messageOutput) error {
+				return listAddresses(r, out, filename, names)
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&filename, "file", "f", "", "file to read; use - for standard input")
+	cmd.Flags().StringSliceVarP(&names, "header", "H", nil, "address header to list, case-insensitive; may be repeated")
+	addFormatFlag(cmd, &format)
+	return cmd
+}
+
+// listAddresses prints the mailboxes of the address headers of a message.
+func listAddresses(r io.Reader, out *messageOutput, filename string, names []string) error {
+	headers, err := utils.ReadRawHeaders(r)
+	if err != nil {
+		return fmt.Errorf("failed to read file '%s': %v", filename, err)
+	}
+
+	var records []addressRecord
+	found, failed := 0, 0
+	for _, header := range headers {
+		if !wantAddressHeader(header.Name, names) {
+			continue
+		}
+		found++
+		addresses, err := utils.ParseAddressList(header.Raw)
+		if err != nil {
+			failed++
+			records = append(records, addressRecord{Header: header.Name, Error: err.Error()})
+			continue
+		}
+		for _, address := range addresses {
+			records = append(records, newAddressRecord(header.Name, address))
+		}
+	}
+	if found == 0 {
+		return fmt.Errorf("no address header found")
+	}
+
+	err = out.write(records, func() {
+		for _, record := range records {
+			if record.Error != "" {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", record.Header, record.Error)
+				continue
+			}
+			fmt.Printf("%s: %s\n", record.Header, describeAddress(record))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to parse %d address header(s)", failed)
+	}
+	return nil
+}
+
+// wantAddressHeader reports whether the header should be listed: one of
+// names if any are given, and any address header otherwise.
+func wantAddressHeader(name string, names []string) bool {
+	if len(names) == 0 {
+		return utils.IsAddressHeader(name)
+	}
+	for _, want := range names {
+		if strings.EqualFold(name, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeAddress formats a mailbox the way it would be written in a header,
+// with the group as a prefix and the Unicode form of an IDN domain appended.
+func describeAddress(record addressRecord) string {
+	var b strings.Builder
+	if record.Group != "" {
+		if record.Address == "" {
+			return record.Group + ":;"
+		}
+		b.WriteString(record.Group + ": ")
+	}
+	if record.Name != "" {
+		b.WriteString(record.Name + " ")
+	}
+	b.WriteString("<" + record.Address + ">")
+	if record.UnicodeDomain != record.Domain {
+		b.WriteString(" (" + record.LocalPart + "@" + record.UnicodeDomain + ")")
+	}
+	return b.String()
+}
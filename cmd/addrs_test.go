@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddrsCommand(t *testing.T) {
+	list := `From: 山田 <taro@example.jp>
+To: undisclosed-recipients:;
+Cc: Team: <a@example.com>
+Cc: Team: 例 <info@xn--r8jz45g.xn--zckzah> (info@例え.テスト)
+Cc: John Doe <john.doe@example.com>
+`
+	tests := []struct {
+		name           string
+		args           []string
+		expectOutput   string
+		expectStderr   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name:         "Selected headers",
+			args:         []string{"addrs", "-f", "../test_files/addresses.eml", "-H", "from", "-H", "To", "-H", "Cc"},
+			expectOutput: list,
+		},
+		{
+			name: "JSON",
+			args: []string{"addrs", "-f", "../test_files/addresses.eml", "-H", "Cc", "-o", "json"},
+			expectOutput: `[
+  {
+    "header": "Cc",
+    "group": "Team",
+    "address": "a@example.com",
+    "local_part": "a",
+    "domain": "example.com",
+    "unicode_domain": "example.com"
+  },
+  {
+    "header": "Cc",
+    "group": "Team",
+    "name": "例",
+    "address": "info@xn--r8jz45g.xn--zckzah",
+    "local_part": "info",
+    "domain": "xn--r8jz45g.xn--zckzah",
+    "unicode_domain": "例え.テスト"
+  },
+  {
+    "header": "Cc",
+    "name": "John Doe",
+    "address": "john.doe@example.com",
+    "local_part": "john.doe",
+    "domain": "example.com",
+    "unicode_domain": "example.com"
+  }
+]
+`,
+		},
+		{
+			name:           "Unparsable header",
+			args:           []string{"addrs", "-f", "../test_files/addresses.eml"},
+			expectOutput:   list,
+			expectStderr:   "Bcc: unterminated angle-addr at offset 7\n",
+			expectError:    true,
+			expectedErrMsg: "failed to parse 1 address header(s)",
+		},
+		{
+			name:           "No address header",
+			args:           []string{"addrs", "-f", "../test_files/addresses.eml", "-H", "X-Missing"},
+			expectError:    true,
+			expectedErrMsg: "no address header found",
+		},
+		{
+			name:           "No file",
+			args:           []string{"addrs"},
+			expectError:    true,
+			expectedErrMsg: "please specify a file with -f",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(AddrsCmd(), tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, tt.expectStderr+"Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectStderr, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+func ArcCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "arc",
+		Short: "Validate and seal ARC chains",
+		Long: `Validate the ARC (Authenticated Received Chain) sets of messages, which let
+mailing lists and forwarders vouch for authentication results that their
+changes break, and add a new set. Keys are looked up in the DNS unless a local
+key store is given with --keys:
+	gemm arc validate -f forwarded.eml --keys keys.zone
+	gemm arc seal -f message.eml --selector s1 --domain example.jp --key key.pem --authserv-id mx.example.jp`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+	}
+	cmd.AddCommand(arcValidateCmd())
+	cmd.AddCommand(arcSealCmd())
+	return cmd
+}
+
+func arcValidateCmd() *cobra.Command {
+	var filename string
+	var keys string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the ARC chain of a message",
+		Long: `Validate the ARC chain of a message as in RFC 8617. Every instance from i=1
+up must have one ARC-Authentication-Results, ARC-Message-Signature and
+ARC-Seal; the first seal must have cv=none and the others cv=pass. The newest
+ARC-Message-Signature and every ARC-Seal must verify. The chain is reported as
+pass or fail, followed by each set:
+	gemm arc validate -f forwarded.eml
+	pass
+	1: ams=pass as=pass cv=none d=example.jp s=s1 a=rsa-sha256 lists.example.jp; dkim=pass header.d=example.jp
+The oldest instance from which the message signatures verify is shown when
+an older one no longer does. An mbox, MMDF or Maildir mailbox validates every
+message.`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if filename == "" {
+				return fmt.Errorf("please specify a file with -f")
+			}
+			resolver, err := keyResolver(keys)
+			if err != nil {
+				return err
+			}
+			return forEachMessage(filename, format, func(r io.Reader, out *messageOutput) error {
+				message, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				return validateARC(message, resolver, out)
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&filename, "file", "f", "", "file to read; use - for standard input")
+	addKeysFlag(cmd, &keys)
+	addFormatFlag(cmd, &format)
+	return cmd
+}
+
+// validateARC validates and prints the ARC chain of a message. It fails
+// unless the chain passes.
+func validateARC(message []byte, resolver utils.TXTResolver, out *messageOutput) error {
+	result, err := utils.ValidateARC(message, resolver)
+	if err != nil {
+		return fmt.Errorf("failed to read message: %v", err)
+	}
+	if result.Status == utils.ARCNone {
+		return fmt.Errorf("no ARC set found")
+	}
+
+	record := newARCRecord(result)
+	if err := out.write(record, func() {
+		fmt.Println(describeARC(record))
+		for _, set := range record.Sets {
+			fmt.Println(describeARCSet(set))
+		}
+	}); err != nil {
+		return err
+	}
+	if result.Status != utils.ARCPass {
+		return fmt.Errorf("the ARC chain did not validate")
+	}
+	return nil
+}
+
+// describeARC formats the chain result as "pass" or "fail: reason".
+func describeARC(record arcRecord) string {
+	line := record.Result
+	if record.OldestPass > 0 {
+		line += fmt.Sprintf(" (oldest pass i=%d)", record.OldestPass)
+	}
+	if record.Reason != "" {
+		line += ": " + record.Reason
+	}
+	return line
+}
+
+// describeARCSet formats a set as
+// "1: ams=pass as=pass cv=none d=example.jp s=sel a=rsa-sha256 authserv-id; results".
+func describeARCSet(set arcSetRecord) string {
+	fields := []string{
+		fmt.Sprintf("%d:", set.Instance),
+		"ams=" + set.MessageSignature,
+		"as=" + set.Seal,
+	}
+	if set.Domain != "" {
+		fields = append(fields,
+			"cv="+set.ChainValidation,
+			"d="+set.Domain,
+			"s="+set.Selector,
+			"a="+set.Algorithm)
+	}
+	if set.AuthServID != "" {
+		fields = append(fields, set.AuthServID+";", set.Results)
+	}
+	line := strings.TrimSuffix(strings.Join(fields, " "), " ")
+	var reasons []string
+	if set.MessageSignatureReason != "" {
+		reasons = append(reasons, "ams: "+set.MessageSignatureReason)
+	}
+	if set.SealReason != "" {
+		reasons = append(reasons, "as: "+set.SealReason)
+	}
+	if len(reasons) > 0 {
+		line += " (" + strings.Join(reasons, ", ") + ")"
+	}
+	return line
+}
+
+func arcSealCmd() *cobra.Command {
+	var opts utils.ARCOptions
+	var flags signingFlags
+	var keys string
+
+	cmd := &cobra.Command{
+		Use:   "seal",
+		Short: "Add an ARC set to a message",
+		Long: `Add an ARC set to a message as in RFC 8617 and print it with the new
+ARC-Seal, ARC-Message-Signature and ARC-Authentication-Results on top. The
+existing chain is validated first to find the cv= value of the seal, and a
+chain that has already failed is not sealed:
+	gemm arc seal -f message.eml --selector s1 --domain example.jp --key key.pem --authserv-id mx.example.jp
+The authentication results recorded in the set are given with --result, or
+else are those of the DKIM signatures and ARC chain of the message:
+	gemm arc seal -f message.eml ... --result "spf=pass smtp.mailfrom=example.jp" --result "dkim=pass header.d=example.jp"
+The key, -c, -H and --over-sign apply to the ARC-Message-Signature as to a
+DKIM signature, and --in-place writes the sealed message back to the file.`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.AuthServID == "" {
+				return fmt.Errorf("please specify the authserv-id of the sealer with --authserv-id")
+			}
+			message, err := readMessageToSign(&flags, &opts.DKIMOptions)
+			if err != nil {
+				return err
+			}
+			resolver, err := keyResolver(keys)
+			if err != nil {
+				return err
+			}
+			if len(opts.Results) == 0 {
+				if opts.Results, err = authenticationResults(message, resolver); err != nil {
+					return err
+				}
+			}
+			return sealARC(message, opts, resolver, &flags)
+		},
+	}
+
+	addSigningFlags(cmd, &opts.DKIMOptions, &flags)
+	cmd.Flags().StringVar(&opts.AuthServID, "authserv-id", "", "name of the sealer in ARC-Authentication-Results")
+	cmd.Flags().StringArrayVar(&opts.Results, "result", nil, "authentication result to record, e.g. \"spf=pass smtp.mailfrom=example.jp\"; repeatable")
+	addKeysFlag(cmd, &keys)
+	return cmd
+}
+
+// authenticationResults returns the results of checking the DKIM
+// signatures and ARC chain of a message, as recorded by a sealer.
+func authenticationResults(message []byte, resolver utils.TXTResolver) ([]string, error) {
+	dkim, err := utils.VerifyDKIM(message, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %v", err)
+	}
+	var results []string
+	for _, result := range dkim {
+		line := "dkim=" + result.Status
+		if sig := result.Signature; sig != nil {
+			line += " header.d=" + sig.Domain + " header.s=" + sig.Selector
+		}
+		results = append(results, line)
+	}
+	arc, err := utils.ValidateARC(message, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %v", err)
+	}
+	if arc.Status != utils.ARCNone {
+		results = append(results, "arc="+arc.Status)
+	}
+	return results, nil
+}
+
+// sealARC seals a message and prints or writes back the result.
+func sealARC(message []byte, opts utils.ARCOptions, resolver utils.TXTResolver, flags *signingFlags) error {
+	sealed, err := utils.SealARC(message, opts, resolver)
+	if err != nil {
+		return fmt.Errorf("failed to seal: %v", err)
+	}
+	fields := string(sealed[:len(sealed)-len(message)])
+	seal := fields[:strings.Index(fields, "ARC-Message-Signature:")]
+	_, value, _ := strings.Cut(seal, ":")
+	parsed, err := utils.ParseARCSeal(value)
+	if err != nil {
+		return err
+	}
+	record := arcSealRecord{
+		Instance:        parsed.Instance,
+		ChainValidation: parsed.ChainValidation,
+		Domain:          parsed.Domain,
+		Selector:        parsed.Selector,
+		Algorithm:       parsed.Algorithm,
+		AuthServID:      opts.AuthServID,
+		Results:         opts.Results,
+		Fields:          strings.TrimRight(fields, "\r\n"),
+	}
+	return writeSigned(sealed, flags, record)
+}
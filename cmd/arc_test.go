@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// arcSets are the sets of test_files/arc.eml as printed by arc validate.
+const arcSets = `1: ams=pass as=pass cv=none d=example.jp s=ed2024 a=ed25519-sha256 lists.example.jp; dkim=pass header.d=example.jp header.s=ed2024
+2: ams=pass as=pass cv=pass d=example.jp s=rsa2024 a=rsa-sha256 mx.example.com; dkim=fail header.d=example.jp header.s=ed2024; arc=pass smtp.remote-ip=192.0.2.1
+`
+
+func TestArcValidateCommand(t *testing.T) {
+	message, err := os.ReadFile("../test_files/arc.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := filepath.Join(t.TempDir(), "tampered.eml")
+	if err := os.WriteFile(tampered, []byte(strings.Replace(string(message), "lists.example.jp;", "evil.example.com;", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectOutput   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name:         "Zone file",
+			args:         []string{"arc", "validate", "-f", "../test_files/arc.eml", "--keys", "../test_files/dkim.zone"},
+			expectOutput: "pass\n" + arcSets,
+		},
+		{
+			name: "JSON",
+			args: []string{"arc", "validate", "-f", "../test_files/arc.eml", "--keys", "../test_files/dkim.json", "-o", "json"},
+			expectOutput: `{
+  "result": "pass",
+  "sets": [
+    {
+      "instance": 1,
+      "authserv_id": "lists.example.jp",
+      "results": "dkim=pass header.d=example.jp header.s=ed2024",
+      "chain_validation": "none",
+      "domain": "example.jp",
+      "selector": "ed2024",
+      "algorithm": "ed25519-sha256",
+      "message_signature": "pass",
+      "seal": "pass"
+    },
+    {
+      "instance": 2,
+      "authserv_id": "mx.example.com",
+      "results": "dkim=fail header.d=example.jp header.s=ed2024; arc=pass smtp.remote-ip=192.0.2.1",
+      "chain_validation": "pass",
+      "domain": "example.jp",
+      "selector": "rsa2024",
+      "algorithm": "rsa-sha256",
+      "message_signature": "pass",
+      "seal": "pass"
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "Tampered results",
+			args: []string{"arc", "validate", "-f", tampered, "--keys", "../test_files/dkim.zone"},
+			expectOutput: `fail: ARC-Seal i=2: fail: signature does not verify
+1: ams=pass as=fail cv=none d=example.jp s=ed2024 a=ed25519-sha256 evil.example.com; dkim=pass header.d=example.jp header.s=ed2024 (as: signature does not verify)
+2: ams=pass as=fail cv=pass d=example.jp s=rsa2024 a=rsa-sha256 mx.example.com; dkim=fail header.d=example.jp header.s=ed2024; arc=pass smtp.remote-ip=192.0.2.1 (as: signature does not verify)
+`,
+			expectError:    true,
+			expectedErrMsg: "the ARC chain did not validate",
+		},
+		{
+			name:           "Unsealed",
+			args:           []string{"arc", "validate", "-f", "../test_files/dkim.eml", "--keys", "../test_files/dkim.zone"},
+			expectError:    true,
+			expectedErrMsg: "no ARC set found",
+		},
+		{
+			name:           "No file",
+			args:           []string{"arc", "validate"},
+			expectError:    true,
+			expectedErrMsg: "please specify a file with -f",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(ArcCmd(), tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, "Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+}
+
+func TestArcSealCommand(t *testing.T) {
+	seal := []string{"arc", "seal", "--domain", "example.jp", "--selector", "ed2024",
+		"--key", "../test_files/dkim-ed25519.pem", "--keys", "../test_files/dkim.zone"}
+
+	tests := []struct {
+		name   string
+		source string
+		args   []string
+		// expectValidate is the output of arc validate on the sealed message.
+		expectValidate string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name:           "First set",
+			source:         "../test_files/dkim.eml",
+			args:           append(seal, "--authserv-id", "lists.example.jp"),
+			expectValidate: "pass\n1: ams=pass as=pass cv=none d=example.jp s=ed2024 a=ed25519-sha256 lists.example.jp; dkim=pass header.d=example.jp header.s=ed2024; dkim=pass header.d=example.jp header.s=rsa2024\n",
+		},
+		{
+			name:           "Third set with results",
+			source:         "../test_files/arc.eml",
+			args:           append(seal, "--authserv-id", "fwd.example.net", "--result", "spf=pass smtp.mailfrom=example.jp", "-H", "from,subject"),
+			expectValidate: "pass\n" + arcSets + "3: ams=pass as=pass cv=pass d=example.jp s=ed2024 a=ed25519-sha256 fwd.example.net; spf=pass smtp.mailfrom=example.jp\n",
+		},
+		{
+			name:           "No authserv-id",
+			source:         "../test_files/dkim.eml",
+			args:           seal,
+			expectError:    true,
+			expectedErrMsg: "please specify the authserv-id of the sealer with --authserv-id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := os.ReadFile(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filename := filepath.Join(t.TempDir(), "message.eml")
+			if err := os.WriteFile(filename, message, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			args := append(append([]string{}, tt.args...), "-f", filename, "--in-place")
+			_, _, err = executeCommand(ArcCmd(), args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				return
+			}
+			assert.NoError(t, err)
+
+			output, _, err := executeCommand(ArcCmd(), []string{"arc", "validate", "-f", filename, "--keys", "../test_files/dkim.zone"})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectValidate, output)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yken2257/gemm/utils"
+)
+
+// batchFiles returns the files to decode: those under dir when it is set,
+// or else those matching the glob pattern. Files and directories that
+// cannot be read are returned in skipped.
+func batchFiles(pattern, dir string) ([]string, []*utils.WalkError, error) {
+	var files []string
+	var skipped []*utils.WalkError
+	var err error
+	if dir != "" {
+		files, skipped, err = utils.WalkFiles(dir)
+	} else {
+		files, skipped, err = utils.Glob(pattern)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 && len(skipped) == 0 {
+		if dir != "" {
+			return nil, nil, fmt.Errorf("no file found in %s", dir)
+		}
+		return nil, nil, fmt.Errorf("no file matches %s", pattern)
+	}
+	return files, skipped, nil
+}
+
+// fileResult is what decodeFile found in a file: its message, or each
+// message of a mailbox, and the error that stopped the file from being read.
+type fileResult struct {
+	messages []batchMessage
+	err      error
+}
+
+// batchMessage holds the headers of a message. index is 0 for a single
+// message file.
+type batchMessage struct {
+	index     int
+	messageID string
+	headers   []utils.Header
+	err       error
+}
+
+// decodeBatch decodes the headers of files on up to jobs workers, reading
+// each file as a mailbox of format. The output follows the order of files
+// however the workers finish, and a file that fails is reported without
+// stopping the others and listed at the end, along with the skipped paths
+// that could not be read.
+func decodeBatch(files []string, skipped []*utils.WalkError, names []string, format string, jobs int) error {
+	mailboxFormat, err := utils.ParseMailboxFormat(format)
+	if err != nil {
+		return err
+	}
+	records := []fileRecord{}
+	printed := 0
+	var failed []string
+	for _, walkErr := range skipped {
+		failed = append(failed, walkErr.Path)
+		if isStructuredOutput() {
+			records = append(records, newFileRecord(walkErr.Path, nil, walkErr.Err))
+		} else {
+			fmt.Fprintln(os.Stderr, walkErr)
+		}
+	}
+	runOrdered(len(files), jobs, func(i int) fileResult {
+		return decodeFile(files[i], names, mailboxFormat)
+	}, func(i int, result fileResult) {
+		fileFailed := result.err != nil
+		for _, message := range result.messages {
+			name := files[i]
+			if message.index > 0 {
+				name = fmt.Sprintf("%s:%d", files[i], message.index)
+			}
+			if message.err != nil {
+				fileFailed = true
+			}
+			if isStructuredOutput() {
+				record := newFileRecord(files[i], message.headers, message.err)
+				record.Index = message.index
+				record.MessageID = message.messageID
+				records = append(records, record)
+				continue
+			}
+			if message.err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, message.err)
+				continue
+			}
+			if len(message.headers) == 0 {
+				continue
+			}
+			if printed > 0 {
+				fmt.Println()
+			}
+			printed++
+			if message.messageID != "" {
+				name += " " + message.messageID
+			}
+			fmt.Printf("==> %s <==\n", name)
+			for _, header := range message.headers {
+				printHeader(header)
+			}
+		}
+		if result.err != nil {
+			if isStructuredOutput() {
+				records = append(records, newFileRecord(files[i], nil, result.err))
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", files[i], result.err)
+			}
+		}
+		if fileFailed {
+			failed = append(failed, files[i])
+		}
+	})
+
+	if isStructuredOutput() {
+		if err := writeOutput(records, nil); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d files failed: %s", len(failed), len(files)+len(skipped), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// decodeFile returns the headers with an encoded-word, or those named by
+// names, of the message in filename or of each message when it is a
+// mailbox. A message without any is not an error in a batch.
+func decodeFile(filename string, names []string, format utils.MailboxFormat) fileResult {
+	mailbox, err := utils.OpenMailbox(filename, format)
+	if err != nil {
+		return fileResult{err: err}
+	}
+	defer mailbox.Close()
+
+	if mailbox.IsSingle() {
+		r, err := mailbox.NextReader()
+		if err != nil {
+			return fileResult{err: err}
+		}
+		headers, err := batchHeaders(r, names)
+		if err != nil {
+			return fileResult{err: err}
+		}
+		return fileResult{messages: []batchMessage{{headers: headers}}}
+	}
+
+	var result fileResult
+	for {
+		message, err := mailbox.Next()
+		if err == io.EOF {
+			if len(result.messages) == 0 {
+				result.err = fmt.Errorf("no message found")
+			}
+			return result
+		}
+		if err != nil {
+			result.err = err
+			return result
+		}
+		headers, err := batchHeaders(bytes.NewReader(message.Data), names)
+		result.messages = append(result.messages, batchMessage{
+			index:     message.Index,
+			messageID: message.MessageID(),
+			headers:   headers,
+			err:       err,
+		})
+	}
+}
+
+// batchHeaders reads the headers of a message for decodeFile.
+func batchHeaders(r io.Reader, names []string) ([]utils.Header, error) {
+	if len(names) == 0 {
+		headers, err := utils.DecodeHeadersFrom(r)
+		if errors.Is(err, utils.ErrNoEncodedHeader) {
+			return nil, nil
+		}
+		return headers, err
+	}
+	headers, err := utils.ReadHeaders(r)
+	if err != nil {
+		return nil, err
+	}
+	return selectHeaders(headers, names), nil
+}
+
+// runOrdered calls work for 0 to n-1 on up to jobs goroutines and emit with
+// each result in index order. Workers run at most jobs items ahead of emit,
+// so memory stays bounded however many items there are.
+func runOrdered(n, jobs int, work func(i int) fileResult, emit func(i int, result fileResult)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	pending := make(chan chan fileResult, jobs)
+	go func() {
+		running := make(chan struct{}, jobs)
+		for i := 0; i < n; i++ {
+			result := make(chan fileResult, 1)
+			running <- struct{}{}
+			pending <- result
+			go func(i int) {
+				result <- work(i)
+				<-running
+			}(i)
+		}
+		close(pending)
+	}()
+
+	i := 0
+	for result := range pending {
+		emit(i, <-result)
+		i++
+	}
+}
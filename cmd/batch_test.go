@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeBatch(t *testing.T) {
+	dir := t.TempDir()
+	simple, err := os.ReadFile("../test_files/simple.eml")
+	assert.NoError(t, err)
+	files := map[string]string{
+		"a/1.eml":   string(simple),
+		"a/2.eml":   "Subject: plain\n\nbody\n",
+		"a/b/3.eml": "not a header\n\nbody\n",
+		"a/b/4.eml": "Subject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\n\nbody\n",
+		"a/b/5.txt": "Subject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\n\nbody\n",
+		"c/[1].eml": "Subject: bracketed\n\nbody\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	file := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+	tests := []struct {
+		name           string
+		args           []string
+		expectOutput   string
+		expectStderr   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name: "Glob",
+			args: []string{"decode", "-f", filepath.Join(dir, "**", "*.eml"), "-H", "Subject", "-j", "4"},
+			expectOutput: fmt.Sprintf("==> %s <==\nSubject: Re: ご飯に行きませんか？\n\n==> %s <==\nSubject: plain\n\n==> %s <==\nSubject: こんにちは\n\n==> %s <==\nSubject: bracketed\n",
+				file("a/1.eml"), file("a/2.eml"), file("a/b/4.eml"), file("c/[1].eml")),
+			expectStderr:   file("a/b/3.eml") + ": malformed header at line 1: \"not a header\"\n",
+			expectError:    true,
+			expectedErrMsg: "1 of 5 files failed: " + file("a/b/3.eml"),
+		},
+		{
+			name: "Recursive",
+			args: []string{"decode", "--recursive", file("a/b"), "-o", "json"},
+			expectOutput: strings.ReplaceAll(`[
+  {
+    "file": "DIR/3.eml",
+    "headers": [],
+    "error": "malformed header at line 1: \"not a header\""
+  },
+  {
+    "file": "DIR/4.eml",
+    "headers": [
+      {
+        "name": "Subject",
+        "raw": "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=",
+        "decoded": "こんにちは",
+        "words": [
+          {
+            "word": "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=",
+            "charset": "UTF-8",
+            "encoding": "B",
+            "decoded": "こんにちは"
+          }
+        ]
+      }
+    ]
+  },
+  {
+    "file": "DIR/5.txt",
+    "headers": [
+      {
+        "name": "Subject",
+        "raw": "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=",
+        "decoded": "こんにちは",
+        "words": [
+          {
+            "word": "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=",
+            "charset": "UTF-8",
+            "encoding": "B",
+            "decoded": "こんにちは"
+          }
+        ]
+      }
+    ]
+  }
+]
+`, "DIR", file("a/b")),
+			expectError:    true,
+			expectedErrMsg: "1 of 3 files failed: " + file("a/b/3.eml"),
+		},
+		{
+			name:         "File named like a glob",
+			args:         []string{"decode", "-f", file("c/[1].eml"), "-H", "Subject"},
+			expectOutput: "Subject: bracketed\n",
+		},
+		{
+			name:           "No match",
+			args:           []string{"decode", "-f", filepath.Join(dir, "*.msg")},
+			expectError:    true,
+			expectedErrMsg: "no file matches " + filepath.Join(dir, "*.msg"),
+		},
+		{
+			name:           "File and recursive",
+			args:           []string{"decode", "-f", "x.eml", "--recursive", dir},
+			expectError:    true,
+			expectedErrMsg: "please specify either a file or --recursive, not both",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(DecodeCmd(), tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, tt.expectStderr+"Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectStderr, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+}
+
+func TestDecodeBatchMailbox(t *testing.T) {
+	dir := t.TempDir()
+	mbox := filepath.Join(dir, "archive.mbox")
+	assert.NoError(t, os.WriteFile(mbox, []byte("From a@example.com Mon Jan  1 00:00:00 2024\nMessage-ID: <1@example.com>\nSubject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\n\nbody\n\n"+
+		"From b@example.com Mon Jan  1 00:00:00 2024\nMessage-ID: <2@example.com>\nSubject: plain\n\nbody\n"), 0644))
+	eml := filepath.Join(dir, "single.eml")
+	assert.NoError(t, os.WriteFile(eml, []byte("Subject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\n\nbody\n"), 0644))
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectOutput   string
+		expectStderr   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name:         "Mailbox in a glob",
+			args:         []string{"decode", "-f", filepath.Join(dir, "*"), "-H", "Subject"},
+			expectOutput: fmt.Sprintf("==> %s:1 <1@example.com> <==\nSubject: こんにちは\n\n==> %s:2 <2@example.com> <==\nSubject: plain\n\n==> %s <==\nSubject: こんにちは\n", mbox, mbox, eml),
+		},
+		{
+			name: "Mailbox JSON",
+			args: []string{"decode", "-f", filepath.Join(dir, "*.mbox"), "-o", "json"},
+			expectOutput: `[
+  {
+    "file": "` + mbox + `",
+    "index": 1,
+    "message_id": "\u003c1@example.com\u003e",
+    "headers": [
+      {
+        "name": "Subject",
+        "raw": "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=",
+        "decoded": "こんにちは",
+        "words": [
+          {
+            "word": "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=",
+            "charset": "UTF-8",
+            "encoding": "B",
+            "decoded": "こんにちは"
+          }
+        ]
+      }
+    ]
+  },
+  {
+    "file": "` + mbox + `",
+    "index": 2,
+    "message_id": "\u003c2@example.com\u003e",
+    "headers": []
+  }
+]
+`,
+		},
+		{
+			// --format applies to every file of the batch
+			name:           "Format",
+			args:           []string{"decode", "-f", filepath.Join(dir, "*"), "--format", "maildir"},
+			expectStderr:   mbox + ": " + mbox + " is not a Maildir directory\n" + eml + ": " + eml + " is not a Maildir directory\n",
+			expectError:    true,
+			expectedErrMsg: "2 of 2 files failed: " + mbox + ", " + eml,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(DecodeCmd(), tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, tt.expectStderr+"Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectStderr, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+}
+
+func TestDecodeBatchPipedStdin(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.eml")
+	assert.NoError(t, os.WriteFile(path, []byte("Subject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\n\nbody\n"), 0644))
+
+	// stdin is an empty pipe, as it is under cron, CI or xargs
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	w.Close()
+	defer r.Close()
+	origStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = origStdin }()
+
+	expected := fmt.Sprintf("==> %s <==\nSubject: こんにちは\n", path)
+	for _, args := range [][]string{
+		{"decode", "--recursive", dir},
+		{"decode", "-f", filepath.Join(dir, "*.eml")},
+	} {
+		output, _, err := executeCommand(DecodeCmd(), args)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, output)
+	}
+
+	_, _, err = executeCommand(DecodeCmd(), []string{"decode", "-f", path})
+	assert.EqualError(t, err, "cannot specify a file or arguments when using standard input")
+}
+
+func TestRunOrdered(t *testing.T) {
+	var order []string
+	runOrdered(20, 4, func(i int) fileResult {
+		// later items finish first
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		return fileResult{err: fmt.Errorf("%d", i)}
+	}, func(i int, result fileResult) {
+		order = append(order, result.err.Error())
+	})
+	expected := make([]string, 20)
+	for i := range expected {
+		expected[i] = fmt.Sprint(i)
+	}
+	assert.Equal(t, strings.Join(expected, ","), strings.Join(order, ","))
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+func BodyCmd() *cobra.Command {
+	var filename string
+	var partPath string
+	var html bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "body",
+		Short: "Decode the body of a message",
+		Long: `Decode the body of a message. The transfer encoding is undone and the text is
+converted from its charset to UTF-8. By default the first text/plain part is
+printed:
+	gemm body -f test.eml
+Print the HTML part instead, or any part by its index path (see "gemm tree"):
+	gemm body -f test.eml --html
+	gemm body -f test.eml --part 1.2
+For an mbox, MMDF or Maildir mailbox the body of every message is printed:
+	gemm body -f archive.mbox`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if filename == "" {
+				return fmt.Errorf("please specify a file with -f")
+			}
+			return forEachMessage(filename, format, func(r io.Reader, out *messageOutput) error {
+				root, err := utils.ParseMessage(r)
+				if err != nil {
+					return fmt.Errorf("failed to parse file '%s': %v", filename, err)
+				}
+				part, err := selectBodyPart(root, partPath, html)
+				if err != nil {
+					return err
+				}
+				return printBody(part, out)
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&filename, "file", "f", "", "file to read; use - for standard input")
+	cmd.Flags().StringVarP(&partPath, "part", "p", "", "index path of the part to print, e.g. 1.2")
+	cmd.Flags().BoolVar(&html, "html", false, "print the first text/html part")
+	addFormatFlag(cmd, &format)
+	return cmd
+}
+
+// selectBodyPart returns the part named by partPath, the first text/html
+// part with html, or else the first text part, preferring text/plain.
+func selectBodyPart(root *utils.Part, partPath string, html bool) (*utils.Part, error) {
+	var part *utils.Part
+	switch {
+	case partPath != "":
+		part = root.Find(partPath)
+		if part == nil {
+			return nil, fmt.Errorf("part not found: %s", partPath)
+		}
+	case html:
+		part = root.FirstText("text/html")
+		if part == nil {
+			return nil, fmt.Errorf("no text/html part found")
+		}
+	default:
+		part = root.FirstText("text/plain")
+		if part == nil {
+			part = root.FirstText("text/html")
+		}
+		if part == nil {
+			return nil, fmt.Errorf("no text part found")
+		}
+	}
+	return part, nil
+}
+
+// printBody prints a text part converted to UTF-8, or writes the decoded
+// bytes of any other part as they are.
+func printBody(part *utils.Part, out *messageOutput) error {
+	if part.IsMultipart() {
+		return fmt.Errorf("part %s is %s; choose one of its children", part.Path, part.MediaType)
+	}
+	record := bodyRecord{
+		Path:             part.Path,
+		ContentType:      part.MediaType,
+		Charset:          part.Charset(),
+		TransferEncoding: part.TransferEncoding(),
+	}
+
+	if !strings.HasPrefix(part.MediaType, "text/") {
+		decoded, err := part.Decode()
+		if err != nil {
+			return err
+		}
+		record.Size = len(decoded)
+		return out.write(record, func() { os.Stdout.Write(decoded) })
+	}
+
+	text, err := part.Text()
+	if err != nil {
+		return err
+	}
+	record.Size = len(text)
+	record.Text = text
+	return out.write(record, func() { fmt.Print(text) })
+}
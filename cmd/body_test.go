@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		expectOutput   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name:         "First text/plain part",
+			args:         []string{"body", "-f", "../test_files/nested.eml"},
+			expectOutput: "こんにちは、ニュースレターです。\r\n今月のお知らせ：ご飯に行きませんか？\r\n",
+		},
+		{
+			name:         "HTML part",
+			args:         []string{"body", "-f", "../test_files/nested.eml", "--html"},
+			expectOutput: "<html><body><p>こんにちは、ニュースレターです。</p></body></html>\r\n",
+		},
+		{
+			name: "Part by path",
+			args: []string{"body", "-f", "../test_files/nested.eml", "--part", "4.1", "-o", "json"},
+			expectOutput: `{
+  "path": "4.1",
+  "content_type": "text/plain",
+  "charset": "US-ASCII",
+  "transfer_encoding": "7bit",
+  "size": 30,
+  "text": "This is the forwarded message."
+}
+`,
+		},
+		{
+			name:           "Unknown part",
+			args:           []string{"body", "-f", "../test_files/nested.eml", "--part", "9"},
+			expectError:    true,
+			expectedErrMsg: "part not found: 9",
+		},
+		{
+			name:           "Multipart part",
+			args:           []string{"body", "-f", "../test_files/nested.eml", "--part", "1"},
+			expectError:    true,
+			expectedErrMsg: "part 1 is multipart/alternative; choose one of its children",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(BodyCmd(), tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, "Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+func CharsetsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "charsets",
+		Short: "List charsets supported for encoding",
+		Long: `List the charsets that can be given to "gemm encode -c". Names are matched
+case-insensitively, and common aliases such as utf8, sjis, cp932, eucjp,
+cp1252 or latin1 are accepted as well.`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names := utils.SupportedCharsets()
+			return writeOutput(names, func() {
+				for _, name := range names {
+					fmt.Println(name)
+				}
+			})
+		},
+	}
+	return cmd
+}
@@ -4,13 +4,23 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"strings"
 
 	gomime "github.com/ProtonMail/go-mime"
 	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
 )
 
 func DecodeCmd() *cobra.Command {
 	var filename string
+	var printAll bool
+	var headerNames []string
+	var lint bool
+	var strict bool
+	var format string
+	var recursive string
+	var jobs int
 
 	cmd := &cobra.Command{
 		Use:     "decode",
@@ -20,12 +30,39 @@ func DecodeCmd() *cobra.Command {
 	gemm decode '=?ISO-2022-JP?B?GyRCJDMkcyRLJEEkTxsoQg==?='
 You can also decode a header from a file:
 	gemm decode -f test.eml
+Use "-" to read the message from standard input:
+	cat test.eml | gemm decode -f -
+An Outlook .msg file is converted to a MIME message first. The file may also
+be an mbox or MMDF mailbox or a Maildir directory; each message is printed
+under its index and Message-ID:
+	gemm decode -f archive.mbox --print
+	gemm decode -f ~/Maildir -H Subject
+Decode many files at once with a glob, where "**" matches any number of
+directories, or every file under a directory. Files are read in parallel
+and printed in order, mailboxes message by message; a file that fails is
+reported and the rest go on:
+	gemm decode -f 'archive/**/*.eml' -H Subject
+	gemm decode --recursive archive/ --jobs 8
+Print the decoded headers without prompting, or only the named ones:
+	gemm decode -f test.eml --print
+	gemm decode -f test.eml -H Subject -H From
+Check encoded-words for RFC 2047 problems instead of decoding; --strict also
+exits with an error when a problem is found:
+	gemm decode --lint '=?UTF-8?B?44GT44KT44Gr44Gh44Gv?='
+	gemm decode --strict -f test.eml
 
 Please enclose the header with single quotes to prevent unexpected behavior:
 	gemm decode '=?ISO-2022-JP?B?GyRCJDMkcyRLJEEkTxsoQg==?= =?ISO-2022-JP?B?GyRCJDMkcyRLJEEkTxsoQg==?='`,
 		Version: rootCmd.Version,
 		Args: func(cmd *cobra.Command, args []string) error {
 			filename, _ := cmd.Flags().GetString("file")
+			recursive, _ := cmd.Flags().GetString("recursive")
+			if filename != "" && recursive != "" {
+				return fmt.Errorf("please specify either a file or --recursive, not both")
+			}
+			// a glob or --recursive reads only its files, so stdin may be
+			// piped as it is under cron, CI or xargs
+			batch := recursive != "" || utils.IsGlob(filename)
 
 			// 標準入力がパイプされているかどうかをチェック
 			stat, err := os.Stdin.Stat()
@@ -35,12 +72,12 @@ Please enclose the header with single quotes to prevent unexpected behavior:
 			isPiped := (stat.Mode() & os.ModeCharDevice) == 0
 
 			// エラー条件のチェック
-			if isPiped {
-				if filename != "" || len(args) > 0 {
+			if isPiped && !batch {
+				if (filename != "" && filename != "-") || len(args) > 0 {
 					return fmt.Errorf("cannot specify a file or arguments when using standard input")
 				}
 			} else {
-				if filename != "" && len(args) > 0 {
+				if (filename != "" || recursive != "") && len(args) > 0 {
 					return fmt.Errorf("please specify either a file or a header to decode, not both")
 				}
 
@@ -56,11 +93,33 @@ Please enclose the header with single quotes to prevent unexpected behavior:
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var decoded string
 			var err error
 
+			if recursive != "" || utils.IsGlob(filename) {
+				if lint || strict {
+					return fmt.Errorf("--lint and --strict take a single file, not a glob or --recursive")
+				}
+				files, skipped, err := batchFiles(filename, recursive)
+				if err != nil {
+					return err
+				}
+				return decodeBatch(files, skipped, headerNames, format, jobs)
+			}
+
+			if lint || strict {
+				return lintInput(filename, format, args, headerNames, strict)
+			}
+
 			if filename != "" {
-				err = decodeEmlPrompt(filename)
+				err = forEachMessage(filename, format, func(r io.Reader, out *messageOutput) error {
+					// the prompt needs a terminal on both ends and a single
+					// message; a message piped through stdin, output captured
+					// by a script or a mailbox prints instead
+					if printAll || len(headerNames) > 0 || filename == "-" || isStructuredOutput() || !isTerminal(os.Stdout) || out.inMailbox() {
+						return decodeEmlPrint(r, out, headerNames)
+					}
+					return decodeEmlPrompt(r)
+				})
 				if err != nil {
 					return fmt.Errorf("failed to decode file '%s': %v", filename, err)
 				}
@@ -68,11 +127,10 @@ Please enclose the header with single quotes to prevent unexpected behavior:
 			}
 
 			if len(args) == 1 {
-				decoded, err = gomime.DecodeHeader(args[0])
+				err = printDecoded(args[0])
 				if err != nil {
 					return fmt.Errorf("failed to decode header: %v", err)
 				}
-				fmt.Println(decoded)
 				return nil
 			}
 
@@ -90,15 +148,161 @@ Please enclose the header with single quotes to prevent unexpected behavior:
 			if err != nil {
 				return fmt.Errorf("failed to read from stdin: %v", err)
 			}
-			decoded, err = gomime.DecodeHeader(string(data))
+			err = printDecoded(strings.TrimRight(string(data), "\r\n"))
 			if err != nil {
 				return fmt.Errorf("failed to decode header from stdin: %v", err)
 			}
-			fmt.Println(decoded)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&filename, "file", "f", "", "file to decode")
+	cmd.Flags().StringVarP(&filename, "file", "f", "", "file to decode; use - for standard input")
+	cmd.Flags().BoolVarP(&printAll, "print", "p", false, "print decoded headers without prompting")
+	cmd.Flags().StringSliceVarP(&headerNames, "header", "H", nil, "header names to print; can be repeated")
+	cmd.Flags().BoolVar(&lint, "lint", false, "report problems in encoded-words instead of decoding")
+	cmd.Flags().BoolVar(&strict, "strict", false, "like --lint, but exit with an error when a problem is found")
+	addFormatFlag(cmd, &format)
+	cmd.Flags().StringVarP(&recursive, "recursive", "r", "", "decode every file under a directory")
+	cmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "number of files to decode in parallel with a glob or --recursive")
 	return cmd
 }
+
+// decodeEmlPrint prints decoded headers of a message in file order. Without
+// names every header containing an encoded-word is printed; with names the
+// matching headers are printed whether encoded or not.
+func decodeEmlPrint(r io.Reader, out *messageOutput, names []string) error {
+	var headers []utils.Header
+	var err error
+	if len(names) == 0 {
+		headers, err = utils.DecodeHeadersFrom(r)
+		if err != nil {
+			return err
+		}
+	} else {
+		all, err := utils.ReadHeaders(r)
+		if err != nil {
+			return err
+		}
+		headers = selectHeaders(all, names)
+		if len(headers) == 0 {
+			return fmt.Errorf("header not found: %s", strings.Join(names, ", "))
+		}
+	}
+
+	records := []headerRecord{}
+	for _, header := range headers {
+		records = append(records, newHeaderRecord(header.Name, header.Raw, header.Decoded, header.Err))
+	}
+	return out.write(records, func() {
+		for _, header := range headers {
+			printHeader(header)
+		}
+	})
+}
+
+// printHeader prints a decoded header field. A field that failed to decode
+// is printed as it is, with the error on stderr.
+func printHeader(header utils.Header) {
+	if header.Err != nil {
+		fmt.Fprintf(os.Stderr, "%s: failed to decode: %v\n", header.Name, header.Err)
+	}
+	fmt.Printf("%s: %s\n", header.Name, header.Decoded)
+}
+
+// printDecoded decodes a single header value and prints it in the selected
+// output format. A structured record is still printed when decoding fails.
+func printDecoded(raw string) error {
+	decoded, err := gomime.DecodeHeader(raw)
+	if err != nil && !isStructuredOutput() {
+		return err
+	}
+	record := newHeaderRecord("", raw, decoded, err)
+	if werr := writeOutput(record, func() { fmt.Println(decoded) }); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// selectHeaders returns the headers whose name matches one of names,
+// case-insensitively, keeping file order.
+func selectHeaders(headers []utils.Header, names []string) []utils.Header {
+	var selected []utils.Header
+	for _, header := range headers {
+		for _, name := range names {
+			if strings.EqualFold(header.Name, name) {
+				selected = append(selected, header)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// lintInput lints the header given as an argument, through stdin, or the
+// headers of every message of a file, and prints the problems found.
+func lintInput(filename, format string, args, names []string, strict bool) error {
+	if filename != "" {
+		return forEachMessage(filename, format, func(r io.Reader, out *messageOutput) error {
+			all, err := utils.ReadRawHeaders(r)
+			if err != nil {
+				return fmt.Errorf("failed to read file '%s': %v", filename, err)
+			}
+			if len(names) > 0 {
+				all = selectHeaders(all, names)
+			}
+			var headers []utils.Header
+			for _, header := range all {
+				if strings.Contains(header.Raw, "=?") {
+					headers = append(headers, header)
+				}
+			}
+			return printLint(headers, out, strict)
+		})
+	}
+
+	var headers []utils.Header
+	switch {
+	case len(args) == 1:
+		headers = []utils.Header{{Raw: args[0]}}
+	default:
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read from stdin: %v", err)
+		}
+		headers = []utils.Header{{Raw: strings.TrimRight(string(data), "\r\n")}}
+	}
+	return printLint(headers, &messageOutput{}, strict)
+}
+
+// printLint prints the problems found in headers. With strict, finding any
+// is an error.
+func printLint(headers []utils.Header, out *messageOutput, strict bool) error {
+	records := []lintRecord{}
+	count := 0
+	for _, header := range headers {
+		problems := utils.LintHeader(header.Raw)
+		count += len(problems)
+		records = append(records, newLintRecord(header.Name, header.Raw, problems))
+	}
+	err := out.write(records, func() {
+		for _, record := range records {
+			for _, problem := range record.Problems {
+				if record.Name != "" {
+					fmt.Printf("%s:%d: %s\n", record.Name, problem.Column, problem.Message)
+				} else {
+					fmt.Printf("%d: %s\n", problem.Column, problem.Message)
+				}
+			}
+		}
+		if count == 0 {
+			fmt.Println("no problems found")
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if strict && count > 0 {
+		return fmt.Errorf("%d problem(s) found", count)
+	}
+	return nil
+}
@@ -57,6 +57,91 @@ func TestDecodeCommand(t *testing.T) {
 			expectError:    true,
 			expectedErrMsg: "cannot specify a file or arguments when using standard input",
 		},
+		{
+			name:         "Decode message from stdin",
+			args:         []string{"decode", "-f", "-"},
+			inputStdin:   "Subject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\r\n\r\nbody\r\n",
+			expectOutput: "Subject: こんにちは",
+			expectError:  false,
+		},
+		{
+			name:         "Decode a message encoded by gemm",
+			args:         []string{"decode", "-f", "-"},
+			inputStdin:   "Subject: =?ISO-2022-JP?b?GyRCJDMkcxsoQg==?=\r\n =?utf-8?q?=E3=81=AB=E3=81=A1=E3=81=AF?=\r\n\r\nbody\r\n",
+			expectOutput: "Subject: こんにちは",
+			expectError:  false,
+		},
+		{
+			name:         "Decode a message with an unknown charset",
+			args:         []string{"decode", "-f", "-"},
+			inputStdin:   "Subject: =?x-unknown?B?YWJj?=\r\nTo: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\r\n\r\nbody\r\n",
+			expectOutput: "Subject: =?x-unknown?B?YWJj?=\nTo: こんにちは\n",
+			expectError:  false,
+		},
+		{
+			name:       "Decode a message with an unknown charset to JSON",
+			args:       []string{"decode", "-f", "-", "-o", "json"},
+			inputStdin: "Subject: =?x-unknown?B?YWJj?=\r\n\r\nbody\r\n",
+			expectOutput: `    "error": "can not get encodig for 'x-unknown' (or 'x-unknown')"
+  }
+]`,
+			expectError: false,
+		},
+		{
+			name:         "Decode file without prompting",
+			args:         []string{"decode", "-f", "../test_files/simple.eml"},
+			expectOutput: "Subject: Re: ご飯に行きませんか？\nTo: ジェーン・ドゥー <jane@example.co.jp>",
+			expectError:  false,
+		},
+		{
+			name:         "Decode selected headers",
+			args:         []string{"decode", "-f", "../test_files/simple.eml", "-H", "to", "-H", "MIME-Version"},
+			expectOutput: "To: ジェーン・ドゥー <jane@example.co.jp>\nMIME-Version: 1.0",
+			expectError:  false,
+		},
+		{
+			name: "Decode to JSON",
+			args: []string{"decode", "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=", "-o", "json"},
+			expectOutput: `"words": [
+    {
+      "word": "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=",
+      "charset": "UTF-8",
+      "encoding": "B",
+      "decoded": "こんにちは"
+    }
+  ]`,
+			expectError: false,
+		},
+		{
+			name:         "Decode file to YAML",
+			args:         []string{"decode", "-f", "../test_files/simple.eml", "-H", "Subject", "-o", "yaml"},
+			expectOutput: "- name: Subject\n  raw: =?ISO-2022-JP?Q?Re:_=1B$B$4HS$K9T$-$^$;$s$+!)=1B(B?=\n  decoded: 'Re: ご飯に行きませんか？'\n  words:\n    - word:",
+			expectError:  false,
+		},
+		{
+			name:           "Invalid output format",
+			args:           []string{"decode", "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=", "-o", "xml"},
+			expectError:    true,
+			expectedErrMsg: "output must be either text, json, or yaml",
+		},
+		{
+			name:         "Lint a header",
+			args:         []string{"decode", "--lint", "=?UTF-8?B?44GT4=KT?="},
+			expectOutput: "16: misplaced base64 padding",
+			expectError:  false,
+		},
+		{
+			name:           "Strict decoding fails on problems",
+			args:           []string{"decode", "--strict", "=?X-UNKNOWN?B?44GT?="},
+			expectError:    true,
+			expectedErrMsg: "1 problem(s) found",
+		},
+		{
+			name:           "Decode unknown header",
+			args:           []string{"decode", "-f", "../test_files/simple.eml", "-H", "Date"},
+			expectError:    true,
+			expectedErrMsg: "header not found: Date",
+		},
 		{
 			name:           "Decode from stdin and argument",
 			args:           []string{"decode", "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?="},
@@ -86,6 +171,7 @@ func TestDecodeCommand(t *testing.T) {
 			// コマンドのセットアップ
 			decodeCmd := DecodeCmd()
 			root := &cobra.Command{Use: "gemm"}
+			addOutputFlag(root)
 			root.AddCommand(decodeCmd)
 
 			// 引数の設定
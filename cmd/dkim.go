@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+func DkimCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dkim",
+		Short: "Sign messages and verify DKIM signatures",
+		Long: `Sign messages with DKIM and verify their signatures. Keys are looked up in
+the DNS unless a local key store is given with --keys:
+	gemm dkim sign -f message.eml --selector s1 --domain example.jp --key key.pem
+	gemm dkim verify -f signed.eml --keys keys.zone`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+	}
+	cmd.AddCommand(dkimSignCmd())
+	cmd.AddCommand(dkimVerifyCmd())
+	return cmd
+}
+
+func dkimSignCmd() *cobra.Command {
+	var opts utils.DKIMOptions
+	var flags signingFlags
+	var expire time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "sign",
+		Short: "Add a DKIM signature to a message",
+		Long: `Sign a message as in RFC 6376 and print it with the DKIM-Signature field
+added on top. The key is a PEM encoded RSA or Ed25519 private key, which
+selects a=rsa-sha256 or a=ed25519-sha256:
+	gemm dkim sign -f message.eml --selector s1 --domain example.jp --key key.pem
+The headers and body are canonicalized as relaxed/relaxed unless -c is given.
+The signed fields default to the usual ones present in the message; -H lists
+them instead, and --over-sign signs each once more than it occurs so that an
+added instance breaks the signature:
+	gemm dkim sign -f message.eml ... -c simple/simple -H from,to,subject --over-sign
+--body-length adds l= so that content appended to the body is not signed,
+and --in-place writes the signed message back to the file.`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			message, err := readMessageToSign(&flags, &opts)
+			if err != nil {
+				return err
+			}
+			if expire > 0 {
+				opts.Expiration = opts.Timestamp.Add(expire)
+			}
+			return signDKIM(message, opts, &flags)
+		},
+	}
+
+	addSigningFlags(cmd, &opts, &flags)
+	cmd.Flags().BoolVar(&opts.BodyLength, "body-length", false, "add l= with the length of the signed body")
+	cmd.Flags().StringVar(&opts.Identity, "identity", "", "agent or user identifier, i=")
+	cmd.Flags().DurationVar(&expire, "expire", 0, "add x= this long after the signing time, e.g. 168h")
+	return cmd
+}
+
+// signingFlags are the flags shared by dkim sign and arc seal that are not
+// options of the signature itself.
+type signingFlags struct {
+	filename         string
+	keyFile          string
+	canonicalization string
+	inPlace          bool
+}
+
+// addSigningFlags adds the flags for the message, the key and the signed
+// fields.
+func addSigningFlags(cmd *cobra.Command, opts *utils.DKIMOptions, flags *signingFlags) {
+	cmd.Flags().StringVarP(&flags.filename, "file", "f", "", "file to read; use - for standard input")
+	cmd.Flags().StringVar(&opts.Selector, "selector", "", "selector, s=, of the key")
+	cmd.Flags().StringVar(&opts.Domain, "domain", "", "signing domain, d=")
+	cmd.Flags().StringVar(&flags.keyFile, "key", "", "PEM file of the private key")
+	cmd.Flags().StringVarP(&flags.canonicalization, "canonicalization", "c", "relaxed/relaxed", "header/body canonicalization; simple or relaxed")
+	cmd.Flags().StringSliceVarP(&opts.Headers, "header", "H", nil, "fields to sign, h=; repeat or separate with commas")
+	cmd.Flags().BoolVar(&opts.OverSign, "over-sign", false, "sign each field once more than it occurs")
+	cmd.Flags().BoolVar(&flags.inPlace, "in-place", false, "write the signed message back to the file")
+}
+
+// readMessageToSign checks the signing flags, completes opts with the key,
+// canonicalization and signing time, and reads the message.
+func readMessageToSign(flags *signingFlags, opts *utils.DKIMOptions) ([]byte, error) {
+	if flags.filename == "" {
+		return nil, fmt.Errorf("please specify a file with -f")
+	}
+	if flags.keyFile == "" {
+		return nil, fmt.Errorf("please specify a private key with --key")
+	}
+	if flags.inPlace && flags.filename == "-" {
+		return nil, fmt.Errorf("--in-place needs a file, not standard input")
+	}
+	var err error
+	if opts.HeaderCanon, opts.BodyCanon, err = utils.ParseCanonicalization(flags.canonicalization); err != nil {
+		return nil, err
+	}
+	if opts.Key, err = utils.LoadDKIMKey(flags.keyFile); err != nil {
+		return nil, fmt.Errorf("failed to read key: %v", err)
+	}
+	opts.Timestamp = time.Now()
+
+	r, err := openInput(flags.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// writeSigned writes a signed message back to its file with --in-place, or
+// prints it unless the output is structured, in which case record, which
+// describes the added fields, is printed instead.
+func writeSigned(signed []byte, flags *signingFlags, record interface{}) error {
+	if flags.inPlace {
+		if err := replaceFile(flags.filename, signed); err != nil {
+			return err
+		}
+	}
+	return writeOutput(record, func() {
+		if !flags.inPlace {
+			os.Stdout.Write(signed)
+		}
+	})
+}
+
+// replaceFile replaces the content of filename with data through a
+// temporary file in the same directory, so that the file is either left as
+// it was or fully written.
+func replaceFile(filename string, data []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(info.Mode().Perm()); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filename)
+}
+
+// signDKIM signs a message and prints or writes back the result.
+func signDKIM(message []byte, opts utils.DKIMOptions, flags *signingFlags) error {
+	signed, err := utils.SignDKIM(message, opts)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %v", err)
+	}
+	field := signed[:len(signed)-len(message)]
+	_, value, _ := strings.Cut(string(field), ":")
+	sig, err := utils.ParseDKIMSignature(value)
+	if err != nil {
+		return err
+	}
+	return writeSigned(signed, flags, newDKIMSignRecord(sig, strings.TrimRight(string(field), "\r\n")))
+}
+
+func dkimVerifyCmd() *cobra.Command {
+	var filename string
+	var keys string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the DKIM signatures of a message",
+		Long: `Verify every DKIM-Signature of a message as in RFC 6376: the body hash bh=
+and the rsa-sha256 or ed25519-sha256 signature over the headers, with simple
+or relaxed canonicalization. Each signature is reported as pass, fail,
+permerror or temperror:
+	gemm dkim verify -f signed.eml
+Public keys are looked up in the DNS at selector._domainkey.domain. To check
+offline, give a zone file or a JSON object mapping names to TXT records:
+	gemm dkim verify -f signed.eml --keys keys.zone
+	gemm dkim verify -f signed.eml --keys keys.json
+An mbox, MMDF or Maildir mailbox verifies every message.`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if filename == "" {
+				return fmt.Errorf("please specify a file with -f")
+			}
+			resolver, err := keyResolver(keys)
+			if err != nil {
+				return err
+			}
+			return forEachMessage(filename, format, func(r io.Reader, out *messageOutput) error {
+				message, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				return verifyDKIM(message, resolver, out)
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&filename, "file", "f", "", "file to read; use - for standard input")
+	addKeysFlag(cmd, &keys)
+	addFormatFlag(cmd, &format)
+	return cmd
+}
+
+// addKeysFlag adds the --keys flag naming a local key store.
+func addKeysFlag(cmd *cobra.Command, keys *string) {
+	cmd.Flags().StringVar(keys, "keys", "", "zone file, or .json file, of TXT records to look keys up in instead of the DNS")
+}
+
+// keyResolver returns the resolver for public keys: the records of the
+// key store at path, or the DNS if path is empty.
+func keyResolver(path string) (utils.TXTResolver, error) {
+	if path == "" {
+		return utils.DNSResolver{}, nil
+	}
+	records, err := utils.LoadTXTRecords(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys: %v", err)
+	}
+	return records, nil
+}
+
+// verifyDKIM verifies and prints the DKIM signatures of a message. It fails
+// unless every signature passes.
+func verifyDKIM(message []byte, resolver utils.TXTResolver, out *messageOutput) error {
+	results, err := utils.VerifyDKIM(message, resolver)
+	if err != nil {
+		return fmt.Errorf("failed to read message: %v", err)
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no DKIM-Signature found")
+	}
+
+	records := []dkimRecord{}
+	failed := 0
+	for i, result := range results {
+		record := newDKIMRecord(i+1, result)
+		if record.Result != utils.DKIMPass {
+			failed++
+		}
+		records = append(records, record)
+	}
+	if err := out.write(records, func() {
+		for _, record := range records {
+			fmt.Println(describeDKIM(record))
+		}
+	}); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d signatures did not verify", failed, len(records))
+	}
+	return nil
+}
+
+// describeDKIM formats a result as
+// "1: pass d=example.jp s=sel a=rsa-sha256 c=relaxed/relaxed".
+func describeDKIM(record dkimRecord) string {
+	fields := []string{fmt.Sprintf("%d:", record.Index), record.Result}
+	if record.Domain != "" {
+		fields = append(fields,
+			"d="+record.Domain,
+			"s="+record.Selector,
+			"a="+record.Algorithm,
+			"c="+record.Canonicalization)
+	}
+	if record.BodyLength != nil {
+		fields = append(fields, fmt.Sprintf("l=%d", *record.BodyLength))
+	}
+	if record.Testing {
+		fields = append(fields, "(testing)")
+	}
+	line := strings.Join(fields, " ")
+	if record.Reason != "" {
+		line += ": " + record.Reason
+	}
+	return line
+}
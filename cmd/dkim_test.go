@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDkimVerifyCommand(t *testing.T) {
+	message, err := os.ReadFile("../test_files/dkim.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := filepath.Join(t.TempDir(), "tampered.eml")
+	if err := os.WriteFile(tampered, []byte(strings.Replace(string(message), "こんにちは", "さようなら", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectOutput   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name: "Zone file",
+			args: []string{"dkim", "verify", "-f", "../test_files/dkim.eml", "--keys", "../test_files/dkim.zone"},
+			expectOutput: `1: pass d=example.jp s=ed2024 a=ed25519-sha256 c=relaxed/relaxed
+2: pass d=example.jp s=rsa2024 a=rsa-sha256 c=simple/simple
+`,
+		},
+		{
+			name: "JSON keys",
+			args: []string{"dkim", "verify", "-f", "../test_files/dkim.eml", "--keys", "../test_files/dkim.json", "-o", "json"},
+			expectOutput: `[
+  {
+    "index": 1,
+    "result": "pass",
+    "domain": "example.jp",
+    "selector": "ed2024",
+    "algorithm": "ed25519-sha256",
+    "canonicalization": "relaxed/relaxed",
+    "identity": "@example.jp",
+    "headers": [
+      "from",
+      "to",
+      "subject",
+      "date",
+      "message-id",
+      "from"
+    ]
+  },
+  {
+    "index": 2,
+    "result": "pass",
+    "domain": "example.jp",
+    "selector": "rsa2024",
+    "algorithm": "rsa-sha256",
+    "canonicalization": "simple/simple",
+    "identity": "@example.jp",
+    "headers": [
+      "from",
+      "to",
+      "subject",
+      "date",
+      "message-id"
+    ]
+  }
+]
+`,
+		},
+		{
+			name: "Tampered body",
+			args: []string{"dkim", "verify", "-f", tampered, "--keys", "../test_files/dkim.zone"},
+			expectOutput: `1: fail d=example.jp s=ed2024 a=ed25519-sha256 c=relaxed/relaxed: body hash does not match
+2: fail d=example.jp s=rsa2024 a=rsa-sha256 c=simple/simple: body hash does not match
+`,
+			expectError:    true,
+			expectedErrMsg: "2 of 2 signatures did not verify",
+		},
+		{
+			name:           "Unsigned",
+			args:           []string{"dkim", "verify", "-f", "../test_files/simple.eml", "--keys", "../test_files/dkim.zone"},
+			expectError:    true,
+			expectedErrMsg: "no DKIM-Signature found",
+		},
+		{
+			name:           "Missing key store",
+			args:           []string{"dkim", "verify", "-f", "../test_files/dkim.eml", "--keys", "missing.zone"},
+			expectError:    true,
+			expectedErrMsg: "failed to read keys: open missing.zone: no such file or directory",
+		},
+		{
+			name:           "No file",
+			args:           []string{"dkim", "verify"},
+			expectError:    true,
+			expectedErrMsg: "please specify a file with -f",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(DkimCmd(), tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, "Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+}
+
+func TestDkimSignCommand(t *testing.T) {
+	message, err := os.ReadFile("../test_files/simple.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := []string{"dkim", "sign", "--domain", "example.jp"}
+	ed25519 := append(sign, "--selector", "ed2024", "--key", "../test_files/dkim-ed25519.pem")
+	rsa := append(sign, "--selector", "rsa2024", "--key", "../test_files/dkim-rsa.pem")
+
+	tests := []struct {
+		name string
+		args []string
+		// expectVerify is the output of dkim verify on the signed message.
+		expectVerify   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name:         "Ed25519",
+			args:         ed25519,
+			expectVerify: "1: pass d=example.jp s=ed2024 a=ed25519-sha256 c=relaxed/relaxed\n",
+		},
+		{
+			name:         "RSA simple with body length",
+			args:         append(rsa, "-c", "simple/simple", "--body-length"),
+			expectVerify: "1: pass d=example.jp s=rsa2024 a=rsa-sha256 c=simple/simple l=434\n",
+		},
+		{
+			name:         "Header list",
+			args:         append(ed25519, "-H", "From,Subject", "--over-sign", "-c", "relaxed"),
+			expectVerify: "1: pass d=example.jp s=ed2024 a=ed25519-sha256 c=relaxed/simple\n",
+		},
+		{
+			name:           "Without From",
+			args:           append(ed25519, "-H", "subject"),
+			expectError:    true,
+			expectedErrMsg: "failed to sign: the signed headers must include From",
+		},
+		{
+			name:           "Identity outside the domain",
+			args:           append(ed25519, "--identity", "noreply@example.com"),
+			expectError:    true,
+			expectedErrMsg: "failed to sign: i=noreply@example.com is not in the domain d=example.jp",
+		},
+		{
+			name:           "Unknown canonicalization",
+			args:           append(ed25519, "-c", "nofws"),
+			expectError:    true,
+			expectedErrMsg: "unknown canonicalization c=nofws",
+		},
+		{
+			name:           "Missing key",
+			args:           append(sign, "--selector", "s1", "--key", "missing.pem"),
+			expectError:    true,
+			expectedErrMsg: "failed to read key: open missing.pem: no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "message.eml")
+			if err := os.WriteFile(filename, message, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			args := append(append([]string{}, tt.args...), "-f", filename, "--in-place")
+			_, _, err := executeCommand(DkimCmd(), args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				unchanged, _ := os.ReadFile(filename)
+				assert.Equal(t, string(message), string(unchanged))
+				return
+			}
+			assert.NoError(t, err)
+			// the message is replaced through a temporary file, which is gone
+			entries, _ := os.ReadDir(filepath.Dir(filename))
+			assert.Len(t, entries, 1)
+
+			output, _, err := executeCommand(DkimCmd(), []string{"dkim", "verify", "-f", filename, "--keys", "../test_files/dkim.zone"})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectVerify, output)
+		})
+	}
+
+	t.Run("Standard output", func(t *testing.T) {
+		output, _, err := executeCommand(DkimCmd(), append(ed25519, "-f", "../test_files/simple.eml"))
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(output, "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed; d=example.jp;\n\ts=ed2024; t="))
+		assert.True(t, strings.HasSuffix(output, string(message)))
+	})
+}
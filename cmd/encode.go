@@ -13,6 +13,10 @@ import (
 func EncodeCmd() *cobra.Command {
 	var charset string
 	var encoding string
+	var header string
+	var verify bool
+	var unmappable string
+	var param string
 
 	cmd := &cobra.Command{
 		Use:   "encode",
@@ -22,36 +26,62 @@ func EncodeCmd() *cobra.Command {
 You can also run the command with arguments. For example:
 	gemm encode "こんにちは"
 With flags:
-	gemm encode "こんにちは" -c ISO-2022-JP -e Q`,
+	gemm encode "こんにちは" -c ISO-2022-JP -e Q
+Both flags accept auto, which picks the narrowest charset that keeps the text
+unchanged (US-ASCII needs no encoding, then ISO-2022-JP, then UTF-8) and
+whichever of B and Q is shorter. Text piped through stdin uses auto for
+anything not given:
+	echo "こんにちは" | gemm encode
+Long text is split into several encoded-words. Give a header name to get a
+complete header field folded at 78 columns:
+	gemm encode "こんにちは" -c ISO-2022-JP -e B --header Subject
+For address headers (From, To, Cc, Reply-To and the like) only display names
+and comments are encoded; addresses and ASCII words are kept as they are and
+display names with specials are quoted:
+	gemm encode "山田 太郎 <taro@example.jp>" -c ISO-2022-JP -e B --header From
+With --param the text becomes a Content-Type or Content-Disposition parameter
+in RFC 2231 form, percent-encoded in UTF-8 unless -c says otherwise and split
+into numbered continuations when long:
+	gemm encode "請求書.pdf" --param filename
+With --verify the output is decoded again and compared with the input;
+characters the charset cannot carry, such as ① or ～ in ISO-2022-JP, which
+reads back as 〜 under the JIS X 0208 mapping, are reported with their
+position:
+	gemm encode "①～" -c ISO-2022-JP -e B --verify
+Characters the charset cannot encode at all fail the command unless
+--unmappable says otherwise: substitute puts 〓 or ? in their place,
+transliterate uses a look-alike such as (株) for ㈱, and utf8 encodes the
+whole text in UTF-8 instead. Shift_JIS and ISO-2022-JP are limited to
+JIS X 0208; use CP932 (Windows-31J) or ISO-2022-JP-MS for the NEC and IBM
+extensions:
+	gemm encode "㈱①" -c ISO-2022-JP -e B --unmappable transliterate
+	gemm encode "㈱①" -c ISO-2022-JP-MS -e B`,
 		Version: rootCmd.Version,
 		Args: func(cmd *cobra.Command, args []string) error {
 			charset, _ := cmd.Flags().GetString("char")
 			encoding, _ := cmd.Flags().GetString("enc")
 
-			// if stdin is piped, check if both charset and encoding are set
-			stat, err := os.Stdin.Stat()
-			if err != nil {
-				return fmt.Errorf("failed to stat stdin: %v", err)
-			}
-			isPiped := (stat.Mode() & os.ModeCharDevice) == 0
-			if isPiped && (charset == "" || encoding == "") {
-				return fmt.Errorf("charset and encoding must be set when using stdin; e.g. gemm encode -c UTF-8 -e B")
-			}
-
-			// charset must be either UTF-8, ISO-2022-JP, or Shift_JIS
-			if charset != "" {
-				normalizedCharset := utils.NormalizeCharset(charset)
-				if _, valid := utils.ValidCharsets[normalizedCharset]; !valid {
-					return fmt.Errorf("charset must be either UTF-8, ISO-2022-JP, or Shift_JIS")
+			// charset must be one listed by "gemm charsets"
+			if charset != "" && !isAuto(charset) {
+				if _, _, err := utils.LookupCharset(charset); err != nil {
+					return fmt.Errorf("%v; run 'gemm charsets' to list supported charsets", err)
 				}
 			}
 			// encoding must be either B or Q (case-insensitive)
-			if encoding != "" {
+			if encoding != "" && !isAuto(encoding) {
 				encoding = strings.ToUpper(encoding)
 				if encoding != "B" && encoding != "Q" {
-					return fmt.Errorf("encoding must be either B or Q")
+					return fmt.Errorf("encoding must be either B, Q or auto")
 				}
 			}
+			if _, err := utils.ParseUnmappable(unmappable); err != nil {
+				return err
+			}
+			param, _ := cmd.Flags().GetString("param")
+			header, _ := cmd.Flags().GetString("header")
+			if param != "" && (encoding != "" || header != "") {
+				return fmt.Errorf("--param cannot be combined with --enc or --header")
+			}
 			if len(args) > 1 {
 				return fmt.Errorf("too many arguments; only one arg is allowed")
 			}
@@ -73,17 +103,150 @@ With flags:
 				if err != nil {
 					return fmt.Errorf("failed to read from stdin: %v", err)
 				}
-				text = string(data)
+				text = strings.TrimRight(string(data), "\r\n")
+				// there is no one to prompt, so pick what is not given
+				if charset == "" {
+					charset = autoSelect
+				}
+				if encoding == "" && param == "" {
+					encoding = autoSelect
+				}
 			} else if len(args) == 1 {
 				text = args[0]
 			} else if len(args) == 0 {
 				text = ""
 			}
-			return encodePrompt(text, charset, encoding)
+			policy, _ := utils.ParseUnmappable(unmappable)
+			return encodePrompt(text, charset, encoding, encodeOptions{header: header, verify: verify, unmappable: policy, param: param})
 		},
 	}
-	cmd.Flags().StringVarP(&charset, "char", "c", "", "charset; UTF-8, ISO-2022-JP, Shift_JIS")
-	cmd.Flags().StringVarP(&encoding, "enc", "e", "", "encoding; B, Q")
+	cmd.Flags().StringVarP(&charset, "char", "c", "", "charset; e.g. UTF-8, ISO-2022-JP, Shift_JIS, EUC-JP (see 'gemm charsets'), or auto")
+	cmd.Flags().StringVarP(&encoding, "enc", "e", "", "encoding; B, Q, or auto")
+	cmd.Flags().StringVarP(&header, "header", "H", "", "header name; prints a complete header field folded at 78 columns")
+	cmd.Flags().BoolVar(&verify, "verify", false, "decode the result again and check that it matches the input")
+	cmd.Flags().StringVar(&param, "param", "", "parameter name; encodes the text as an RFC 2231 parameter such as filename")
+	cmd.Flags().StringVar(&unmappable, "unmappable", "fail", "what to do with characters the charset cannot encode; fail, substitute, transliterate, utf8")
 	
 	return cmd
 }
+
+// autoSelect lets gemm choose the charset or the encoding.
+const autoSelect = "auto"
+
+func isAuto(s string) bool {
+	return strings.EqualFold(s, autoSelect)
+}
+
+// encodeOptions holds the encode flags that do not need a prompt.
+type encodeOptions struct {
+	header     string
+	verify     bool
+	unmappable utils.Unmappable
+	param      string
+}
+
+// verifyEncoded decodes encoded the same way "gemm decode" does and compares
+// the result with text. Text encoded in Shift_JIS or ISO-2022-JP, the target
+// charset, is read back with the JIS X 0208 mapping.
+func verifyEncoded(text, encoded, charset, target, header string) (*verifyRecord, error) {
+	field := encoded
+	if header == "" {
+		field = "X-Verify: " + encoded
+	}
+	decoded, err := utils.DecodeField(field)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the result: %v", err)
+	}
+	decoded = utils.StrictJIS(decoded, target)
+	losses, err := utils.CharsetLosses(text, charset)
+	if err != nil {
+		return nil, err
+	}
+	record := &verifyRecord{Decoded: decoded, Match: decoded == text}
+	for _, loss := range losses {
+		record.Losses = append(record.Losses, loss.String())
+	}
+	return record, nil
+}
+
+// writeEncodeRecord prints the encoded text, then the outcome of --verify,
+// and fails if the round trip did not match.
+func writeEncodeRecord(record encodeRecord) error {
+	if err := writeOutput(record, func() { fmt.Println(record.Encoded) }); err != nil {
+		return err
+	}
+	if record.Verify == nil {
+		return nil
+	}
+	if !isStructuredOutput() {
+		printVerify(record.Verify)
+	}
+	if !record.Verify.Match {
+		return fmt.Errorf("round trip does not match the input")
+	}
+	return nil
+}
+
+// printVerify reports the outcome of verifyEncoded on stderr so that stdout
+// keeps only the encoded text.
+func printVerify(record *verifyRecord) {
+	if record.Match {
+		fmt.Fprintln(os.Stderr, "verify: OK")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "verify: decoded text %q does not match the input\n", record.Decoded)
+	for _, loss := range record.Losses {
+		fmt.Fprintln(os.Stderr, "  "+loss)
+	}
+}
+
+// lossError explains a failed conversion by listing every character the
+// charset cannot encode.
+func lossError(err error, text, charset string) error {
+	losses, lossErr := utils.CharsetLosses(text, charset)
+	if lossErr != nil || len(losses) == 0 {
+		return err
+	}
+	messages := make([]string, len(losses))
+	for i, loss := range losses {
+		messages[i] = loss.String()
+	}
+	return fmt.Errorf("%v:\n  %s", err, strings.Join(messages, "\n  "))
+}
+
+// encodeParam encodes text as the RFC 2231 parameter opts.param. Without a
+// charset, or with auto, non-ASCII text is encoded in UTF-8, which every
+// current mailer reads.
+func encodeParam(text, charset string, opts encodeOptions) error {
+	if charset == "" || isAuto(charset) {
+		charset = "UTF-8"
+	}
+	source, target, err := utils.ApplyUnmappable(text, charset, opts.unmappable)
+	if err != nil {
+		return fmt.Errorf("%v; use --unmappable to substitute, transliterate or switch to UTF-8", err)
+	}
+	mimeCharset, _, err := utils.LookupCharset(target)
+	if err != nil {
+		return err
+	}
+	sections, err := utils.EncodeParam(opts.param, source, target)
+	if err != nil {
+		return err
+	}
+	encoded := strings.Join(sections, ";\r\n ")
+	record := encodeRecord{
+		Param:   opts.param,
+		Input:   text,
+		Charset: mimeCharset,
+		Encoded: encoded,
+	}
+	if opts.verify {
+		_, params, err := utils.ParseHeaderParams("x; " + encoded)
+		if err != nil {
+			return fmt.Errorf("failed to decode the result: %v", err)
+		}
+		decoded := utils.StrictJIS(params[strings.ToLower(opts.param)], target)
+		record.Verify = &verifyRecord{Decoded: decoded, Match: decoded == text}
+	}
+	return writeEncodeRecord(record)
+}
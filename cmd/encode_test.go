@@ -33,23 +33,36 @@ func TestEncodeCommand(t *testing.T) {
 			expectError:  false,
 		},
 		{
-			name:           "Stdin is piped but charset and encoding are not set",
-			args:           []string{"encode"},
-			inputStdin:     "こんにちは",
-			expectError:    true,
-			expectedErrMsg: "charset and encoding must be set when using stdin; e.g. gemm encode -c UTF-8 -e B",
+			name:         "Stdin is piped but charset and encoding are not set",
+			args:         []string{"encode"},
+			inputStdin:   "こんにちは\n",
+			expectOutput: "=?ISO-2022-JP?q?=1B$B$3$s$K$A$O=1B(B?=",
+			expectError:  false,
+		},
+		{
+			name:         "Stdin is piped with only the encoding set",
+			args:         []string{"encode", "-e", "B"},
+			inputStdin:   "こんにちは😀",
+			expectOutput: "=?UTF-8?b?44GT44KT44Gr44Gh44Gv8J+YgA==?=",
+			expectError:  false,
+		},
+		{
+			name:         "Automatic selection leaves ASCII alone",
+			args:         []string{"encode", "Hello world", "-c", "auto", "-e", "auto"},
+			expectOutput: "Hello world",
+			expectError:  false,
 		},
 		{
 			name:           "Invalid charset",
 			args:           []string{"encode", "こんにちは", "-c", "UTF-16", "-e", "B"},
 			expectError:    true,
-			expectedErrMsg: "charset must be either UTF-8, ISO-2022-JP, or Shift_JIS",
+			expectedErrMsg: "unsupported charset: UTF-16; run 'gemm charsets' to list supported charsets",
 		},
 		{
 			name:           "Invalid encoding",
 			args:           []string{"encode", "こんにちは", "-c", "UTF-8", "-e", "C"},
 			expectError:    true,
-			expectedErrMsg: "encoding must be either B or Q",
+			expectedErrMsg: "encoding must be either B, Q or auto",
 		},
 		{
 			name:           "Too many arguments",
@@ -58,16 +71,114 @@ func TestEncodeCommand(t *testing.T) {
 			expectedErrMsg: "too many arguments; only one arg is allowed",
 		},
 		{
-			name:           "lowercase encoding",
-			args:           []string{"encode", "こんにちは", "-c", "UTF-8", "-e", "b"},
-			expectOutput:   "=?UTF-8?b?44GT44KT44Gr44Gh44Gv?=",
-			expectError:    false,
+			name: "Encode to JSON",
+			args: []string{"encode", "こんにちは", "-c", "UTF-8", "-e", "B", "-o", "json"},
+			expectOutput: `"input": "こんにちは",
+  "charset": "UTF-8",
+  "encoding": "B",
+  "encoded": "=?UTF-8?b?44GT44KT44Gr44Gh44Gv?="`,
+			expectError: false,
+		},
+		{
+			name:         "Encode as header field",
+			args:         []string{"encode", "【重要】来週の定例会議の議題と資料についてのご案内", "-c", "ISO-2022-JP", "-e", "B", "--header", "Subject"},
+			expectOutput: "Subject: =?ISO-2022-JP?b?GyRCIVo9RU1XIVtNaD01JE5Eak5jMnE1RCRONURCaiRIGyhC?=\r\n =?ISO-2022-JP?b?GyRCO3FOQSRLJEQkJCRGJE4kNDBGRmIbKEI=?=",
+			expectError:  false,
+		},
+		{
+			name:         "Encode an address header",
+			args:         []string{"encode", "John Doe （ジョン） <john@example.com>", "-c", "UTF-8", "-e", "B", "--header", "From"},
+			expectOutput: "From: John Doe =?UTF-8?b?77yI44K444On44Oz77yJ?= <john@example.com>",
+			expectError:  false,
+		},
+		{
+			name:         "Encode an RFC 2231 parameter",
+			args:         []string{"encode", "【重要】2024年度第3四半期売上報告書.pdf", "--param", "filename", "--verify"},
+			expectOutput: "filename*0*=UTF-8''%E3%80%90%E9%87%8D%E8%A6%81%E3%80%912024%E5%B9%B4;\r\n filename*1*=",
+			expectError:  false,
+		},
+		{
+			name:           "Parameter with an encoding",
+			args:           []string{"encode", "請求書.pdf", "--param", "filename", "-e", "B"},
+			expectError:    true,
+			expectedErrMsg: "--param cannot be combined with --enc or --header",
+		},
+		{
+			name:         "Encode with an alias of a registered charset",
+			args:         []string{"encode", "Привет", "-c", "cp1251", "-e", "Q"},
+			expectOutput: "=?windows-1251?q?=CF=F0=E8=E2=E5=F2?=",
+			expectError:  false,
+		},
+		{
+			name:         "lowercase encoding",
+			args:         []string{"encode", "こんにちは", "-c", "UTF-8", "-e", "b"},
+			expectOutput: "=?UTF-8?b?44GT44KT44Gr44Gh44Gv?=",
+			expectError:  false,
+		},
+		{
+			name:         "Verify a round trip",
+			args:         []string{"encode", "【重要】来週の定例会議の議題と資料についてのご案内", "-c", "ISO-2022-JP", "-e", "Q", "--header", "Subject", "--verify"},
+			expectOutput: "Subject: =?ISO-2022-JP?q?",
+			expectError:  false,
+		},
+		{
+			name:           "Verify reports characters the charset cannot encode",
+			args:           []string{"encode", "絵文字😀", "-c", "Shift_JIS", "-e", "B", "--verify"},
+			expectError:    true,
+			expectedErrMsg: "'😀' (U+1F600) at 3 cannot be encoded",
+		},
+		{
+			name:         "JIS forms in Shift_JIS",
+			args:         []string{"encode", "波〜−", "-c", "Shift_JIS", "-e", "B", "--verify"},
+			expectOutput: "=?Shift_JIS?b?lGeBYIF8?=",
+		},
+		{
+			name:           "Verify reads ISO-2022-JP with the JIS mapping",
+			args:           []string{"encode", "波～", "-c", "ISO-2022-JP", "-e", "B", "--verify"},
+			expectError:    true,
+			expectedErrMsg: `'～' (U+FF5E) at 1 comes back as "〜"`,
+		},
+		{
+			name:           "Verify fails when the text does not come back",
+			args:           []string{"encode", " leading space", "-c", "UTF-8", "-e", "B", "--verify"},
+			expectError:    true,
+			expectedErrMsg: `verify: decoded text "leading space" does not match the input`,
+		},
+		{
+			name:           "Unmappable character",
+			args:           []string{"encode", "株式会社㈱", "-c", "ISO-2022-JP", "-e", "B"},
+			expectError:    true,
+			expectedErrMsg: "'㈱' (U+3231) at offset 4 cannot be encoded in ISO-2022-JP; use --unmappable",
 		},
 		{
-			name:           "lowercase charset",
-			args:           []string{"encode", "こんにちは", "-c", "utf8", "-e", "B"},
-			expectOutput:   "=?UTF-8?b?44GT44KT44Gr44Gh44Gv?=",
-			expectError:    false,
+			name:         "Transliterate unmappable characters",
+			args:         []string{"encode", "㈱", "-c", "ISO-2022-JP", "-e", "Q", "--unmappable", "transliterate"},
+			expectOutput: "=?ISO-2022-JP?q?(=1B$B3t=1B(B)?=",
+			expectError:  false,
+		},
+		{
+			name:         "Upgrade unmappable text to UTF-8",
+			args:         []string{"encode", "㈱", "-c", "ISO-2022-JP", "-e", "B", "--unmappable", "utf8"},
+			expectOutput: "=?UTF-8?b?44ix?=",
+			expectError:  false,
+		},
+		{
+			name:         "Encode in Windows-31J",
+			args:         []string{"encode", "㈱", "-c", "cp932", "-e", "B"},
+			expectOutput: "=?Windows-31J?b?h4o=?=",
+			expectError:  false,
+		},
+		{
+			name:           "Invalid unmappable policy",
+			args:           []string{"encode", "㈱", "-c", "UTF-8", "-e", "B", "--unmappable", "drop"},
+			expectError:    true,
+			expectedErrMsg: "unmappable must be one of fail, substitute, transliterate or utf8",
+		},
+		{
+			name:         "lowercase charset",
+			args:         []string{"encode", "こんにちは", "-c", "utf8", "-e", "B"},
+			expectOutput: "=?UTF-8?b?44GT44KT44Gr44Gh44Gv?=",
+			expectError:  false,
 		},
 	}
 
@@ -91,6 +202,7 @@ func TestEncodeCommand(t *testing.T) {
 			// コマンドのセットアップ
 			encodeCmd := EncodeCmd()
 			root := &cobra.Command{Use: "gemm"}
+			addOutputFlag(root)
 			root.AddCommand(encodeCmd)
 
 			// 引数の設定
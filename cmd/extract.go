@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+func ExtractCmd() *cobra.Command {
+	var filename string
+	var dir string
+	var partPaths []string
+	var types []string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "extract",
+		Short: "Save attachments of a message",
+		Long: `Save every attachment and inline part of a message to a directory:
+	gemm extract -f test.eml -d attachments/
+Filenames are decoded from RFC 2047 or RFC 2231 parameters, stripped of
+directory components, and numbered when they clash with existing files.
+An attached message/rfc822 part is saved whole as a .eml file rather than
+part by part. Select parts by index path (see "gemm tree") or by MIME type
+pattern:
+	gemm extract -f test.eml -d out/ --part 2 --part 3
+	gemm extract -f test.eml -d out/ --type 'image/*'
+The parts of every message of an mbox, MMDF or Maildir mailbox are saved to
+the same directory:
+	gemm extract -f archive.mbox -d out/`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if filename == "" {
+				return fmt.Errorf("please specify a file with -f")
+			}
+			for _, pattern := range types {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("invalid type pattern %q: %v", pattern, err)
+				}
+			}
+			taken := make(map[string]bool)
+			return forEachMessage(filename, format, func(r io.Reader, out *messageOutput) error {
+				root, err := utils.ParseMessage(r)
+				if err != nil {
+					return fmt.Errorf("failed to parse file '%s': %v", filename, err)
+				}
+				return extractParts(root, out, dir, partPaths, types, taken)
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&filename, "file", "f", "", "file to read; use - for standard input")
+	cmd.Flags().StringVarP(&dir, "dir", "d", ".", "directory to save the parts to")
+	cmd.Flags().StringSliceVarP(&partPaths, "part", "p", nil, "index paths of the parts to save; can be repeated")
+	cmd.Flags().StringSliceVarP(&types, "type", "t", nil, "MIME type patterns of the parts to save, e.g. 'image/*'; can be repeated")
+	addFormatFlag(cmd, &format)
+	return cmd
+}
+
+// extractParts saves the selected parts of a message to dir and prints
+// them. taken holds the names already used, so that the messages of a
+// mailbox do not overwrite each other's parts.
+func extractParts(root *utils.Part, out *messageOutput, dir string, partPaths, types []string, taken map[string]bool) error {
+	parts, err := selectParts(root, partPaths, types)
+	if err != nil {
+		return err
+	}
+	// in a mailbox, messages without attachments are simply skipped
+	if len(parts) == 0 && !out.inMailbox() {
+		return fmt.Errorf("no attachment found")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	records := []extractRecord{}
+	for _, part := range parts {
+		decoded, err := part.Decode()
+		if err != nil {
+			return err
+		}
+		name := utils.SanitizeFilename(part.Filename())
+		if name == "" {
+			name = utils.DefaultFilename(part)
+		} else if part.MediaType == "message/rfc822" && !strings.EqualFold(filepath.Ext(name), ".eml") {
+			name += ".eml"
+		}
+		target, err := writeUnique(dir, name, taken, decoded)
+		if err != nil {
+			return err
+		}
+		records = append(records, extractRecord{
+			Path:        part.Path,
+			ContentType: part.MediaType,
+			Filename:    part.Filename(),
+			SavedAs:     target,
+			Size:        len(decoded),
+		})
+	}
+	return out.write(records, func() {
+		for _, record := range records {
+			fmt.Printf("%s %s -> %s (%d bytes)\n", record.Path, record.ContentType, record.SavedAs, record.Size)
+		}
+	})
+}
+
+// writeUnique writes data to a new file in dir named after name by
+// utils.UniqueFilename and returns its path. The file is created
+// exclusively, so a file or symlink that appears after the name was chosen
+// is never written through; the next name is tried instead.
+func writeUnique(dir, name string, taken map[string]bool, data []byte) (string, error) {
+	for {
+		unique := utils.UniqueFilename(dir, name, taken)
+		taken[unique] = true
+		target := filepath.Join(dir, unique)
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return "", err
+		}
+		return target, f.Close()
+	}
+}
+
+// selectParts returns the parts to extract. Without paths these are the
+// parts with an attachment or inline disposition, leaving out the parts of
+// an attached message, which is saved whole; with paths, exactly the named
+// parts. Type patterns narrow either set down.
+func selectParts(root *utils.Part, paths, types []string) ([]*utils.Part, error) {
+	var candidates []*utils.Part
+	if len(paths) > 0 {
+		for _, p := range paths {
+			part := root.Find(p)
+			if part == nil {
+				return nil, fmt.Errorf("part not found: %s", p)
+			}
+			if part.IsMultipart() {
+				return nil, fmt.Errorf("part %s is %s; choose one of its children", part.Path, part.MediaType)
+			}
+			candidates = append(candidates, part)
+		}
+	} else {
+		var walk func(part *utils.Part)
+		walk = func(part *utils.Part) {
+			disposition, _ := part.Disposition()
+			if !part.IsMultipart() && (disposition == "attachment" || disposition == "inline") {
+				candidates = append(candidates, part)
+				if part.MediaType == "message/rfc822" {
+					return
+				}
+			}
+			for _, child := range part.Children {
+				walk(child)
+			}
+		}
+		walk(root)
+	}
+	if len(types) == 0 {
+		return candidates, nil
+	}
+
+	var selected []*utils.Part
+	for _, part := range candidates {
+		for _, pattern := range types {
+			if matched, _ := path.Match(pattern, part.MediaType); matched {
+				selected = append(selected, part)
+				break
+			}
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// expectOutput is stdout with DIR for the directory files are saved in.
+		expectOutput   string
+		expectFiles    []string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name:         "All attachments",
+			args:         []string{"extract", "-f", "../test_files/nested.eml"},
+			expectOutput: "2 application/pdf -> DIR/請求書.pdf (30 bytes)\n3 image/png -> DIR/画像.png (15 bytes)\n",
+			expectFiles:  []string{"請求書.pdf", "画像.png"},
+		},
+		{
+			name:         "By type",
+			args:         []string{"extract", "-f", "../test_files/nested.eml", "--type", "image/*"},
+			expectOutput: "3 image/png -> DIR/画像.png (15 bytes)\n",
+			expectFiles:  []string{"画像.png"},
+		},
+		{
+			name:         "By path",
+			args:         []string{"extract", "-f", "../test_files/nested.eml", "--part", "1.1", "--part", "2"},
+			expectOutput: "1.1 text/plain -> DIR/part-1.1.txt (84 bytes)\n2 application/pdf -> DIR/請求書.pdf (30 bytes)\n",
+			expectFiles:  []string{"part-1.1.txt", "請求書.pdf"},
+		},
+		{
+			name:         "Attached message",
+			args:         []string{"extract", "-f", "../test_files/forwarded.eml"},
+			expectOutput: "2 message/rfc822 -> DIR/fwd.eml (316 bytes)\n",
+			expectFiles:  []string{"fwd.eml"},
+		},
+		{
+			name: "Attached message in Outlook",
+			args: []string{"extract", "-f", "../test_files/sample.msg"},
+			expectOutput: `2 text/plain -> DIR/報告書.txt (8 bytes)
+3 message/rfc822 -> DIR/転送.eml (298 bytes)
+4 application/octet-stream -> DIR/big.bin (5000 bytes)
+`,
+			expectFiles: []string{"報告書.txt", "転送.eml", "big.bin"},
+		},
+		{
+			name:           "No match",
+			args:           []string{"extract", "-f", "../test_files/nested.eml", "--type", "video/*"},
+			expectError:    true,
+			expectedErrMsg: "no attachment found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			output, errorOutput, err := executeCommand(ExtractCmd(), append(tt.args, "-d", dir))
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, "Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, errorOutput)
+			}
+			assert.Equal(t, strings.ReplaceAll(tt.expectOutput, "DIR", dir), output)
+			entries, _ := os.ReadDir(dir)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			assert.ElementsMatch(t, tt.expectFiles, names)
+		})
+	}
+
+	// extracting twice keeps the first files and numbers the new ones
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		_, _, err := executeCommand(ExtractCmd(), []string{"extract", "-f", "../test_files/nested.eml", "--type", "application/pdf", "-d", dir})
+		assert.NoError(t, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "請求書 (1).pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4\n% fake pdf for tests\n", string(data))
+
+	// an attached message is saved as it is, with its own attachments
+	dir = t.TempDir()
+	_, _, err = executeCommand(ExtractCmd(), []string{"extract", "-f", "../test_files/forwarded.eml", "-d", dir})
+	assert.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(dir, "fwd.eml"))
+	assert.NoError(t, err)
+	message, _ := os.ReadFile("../test_files/forwarded.eml")
+	start := strings.Index(string(message), "From: boss@example.jp")
+	end := strings.Index(string(message), "--outer--")
+	assert.Equal(t, string(message[start:end-1]), string(data))
+}
+
+func TestWriteUnique(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.pdf"), []byte("old"), 0644))
+	taken := make(map[string]bool)
+
+	for _, expected := range []string{"a (1).pdf", "a (2).pdf"} {
+		target, err := writeUnique(dir, "a.pdf", taken, []byte("new"))
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, expected), target)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a.pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+
+	_, err = writeUnique(filepath.Join(dir, "missing"), "a.pdf", taken, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+func GrepCmd() *cobra.Command {
+	var names []string
+	var opts utils.MatchOptions
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "grep PATTERN [PATH]...",
+		Short: "Search the decoded headers of messages",
+		Long: `Search the decoded header values of messages, so that encoded Japanese
+subjects and names can be found by their text. Each path may be a message, an
+mbox or MMDF mailbox, a glob such as 'archive/**/*.eml' or a directory, whose
+files are all searched; without a path the message is read from standard
+input. Every matching header is printed with its file, and with its index for
+a message in a mailbox:
+	gemm grep -H Subject 'ご飯' archive/
+The pattern is a regular expression unless --fixed is given. --ignore-case
+folds case and --normalize applies NFKC to the pattern and the values, so
+that full-width and half-width forms match each other:
+	gemm grep -i --normalize -H From 'ｙａｍａｄａ' archive.mbox`,
+		Version: rootCmd.Version,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			matcher, err := utils.NewHeaderMatcher(args[0], opts)
+			if err != nil {
+				return fmt.Errorf("invalid pattern: %v", err)
+			}
+			paths := args[1:]
+			if len(paths) == 0 {
+				paths = []string{"-"}
+			}
+			mailboxFormat, err := utils.ParseMailboxFormat(format)
+			if err != nil {
+				return err
+			}
+			files, skipped, err := grepFiles(paths, mailboxFormat)
+			if err != nil {
+				return err
+			}
+
+			records := []grepRecord{}
+			matched, failed := 0, len(skipped)
+			for _, walkErr := range skipped {
+				if isStructuredOutput() {
+					records = append(records, grepRecord{File: walkErr.Path, Error: walkErr.Err.Error()})
+				} else {
+					fmt.Fprintln(os.Stderr, walkErr)
+				}
+			}
+			for _, file := range files {
+				matches, err := grepFile(file, mailboxFormat, names, matcher)
+				matched += len(matches)
+				if isStructuredOutput() {
+					records = append(records, matches...)
+				} else {
+					for _, match := range matches {
+						fmt.Println(describeMatch(match))
+					}
+				}
+				if err != nil {
+					failed++
+					if isStructuredOutput() {
+						records = append(records, grepRecord{File: file, Error: err.Error()})
+					} else {
+						fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+					}
+				}
+			}
+
+			if isStructuredOutput() {
+				if err := writeOutput(records, nil); err != nil {
+					return err
+				}
+			}
+			switch {
+			case failed > 0:
+				return fmt.Errorf("failed to read %d file(s)", failed)
+			case matched == 0:
+				return fmt.Errorf("no header matches")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&names, "header", "H", nil, "header to search, case-insensitive; may be repeated; all headers by default")
+	cmd.Flags().BoolVarP(&opts.Fixed, "fixed", "F", false, "match the pattern as a literal string")
+	cmd.Flags().BoolVarP(&opts.IgnoreCase, "ignore-case", "i", false, "ignore case")
+	cmd.Flags().BoolVar(&opts.Normalize, "normalize", false, "apply NFKC to match full-width and half-width forms")
+	addFormatFlag(cmd, &format)
+	return cmd
+}
+
+// grepFiles expands globs and directories in paths into the files to search.
+// Directories are kept whole when they are to be read as Maildirs. What
+// cannot be read while expanding them is returned in skipped.
+func grepFiles(paths []string, format utils.MailboxFormat) ([]string, []*utils.WalkError, error) {
+	var files []string
+	var skipped []*utils.WalkError
+	for _, p := range paths {
+		if p != "-" && utils.IsGlob(p) {
+			matches, unreadable, err := utils.Glob(p)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(matches) == 0 && len(unreadable) == 0 {
+				return nil, nil, fmt.Errorf("no file matches %s", p)
+			}
+			files = append(files, matches...)
+			skipped = append(skipped, unreadable...)
+			continue
+		}
+		if info, err := os.Stat(p); err == nil && info.IsDir() && format != utils.FormatMaildir {
+			walked, unreadable, err := utils.WalkFiles(p)
+			if err != nil {
+				return nil, nil, err
+			}
+			files = append(files, walked...)
+			skipped = append(skipped, unreadable...)
+			continue
+		}
+		files = append(files, p)
+	}
+	return files, skipped, nil
+}
+
+// grepFile returns the headers of the messages in file that match. The
+// matches found before an error are returned with it.
+func grepFile(file string, format utils.MailboxFormat, names []string, matcher *utils.HeaderMatcher) ([]grepRecord, error) {
+	var mailbox *utils.Mailbox
+	var err error
+	if file == "-" {
+		mailbox, err = utils.NewMailboxReader(os.Stdin, file, format)
+	} else {
+		mailbox, err = utils.OpenMailbox(file, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer mailbox.Close()
+
+	var records []grepRecord
+	for {
+		message, err := mailbox.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		headers, err := utils.ReadRawHeaders(bytes.NewReader(message.Data))
+		if err != nil && !mailbox.IsSingle() {
+			return records, fmt.Errorf("message %d: %v", message.Index, err)
+		}
+		if err != nil {
+			return records, err
+		}
+		for _, header := range headers {
+			if len(names) > 0 && len(selectHeaders([]utils.Header{header}, names)) == 0 {
+				continue
+			}
+			value := utils.DecodeValue(header.Raw)
+			if !matcher.Match(value) {
+				continue
+			}
+			record := grepRecord{File: message.Source, Header: header.Name, Value: value}
+			if !mailbox.IsSingle() {
+				record.MessageID = message.MessageID()
+			}
+			if !mailbox.IsSingle() && mailbox.Format != utils.FormatMaildir {
+				record.Index = message.Index
+			}
+			records = append(records, record)
+		}
+	}
+}
+
+// describeMatch formats a match as "file: Header: value", with the message
+// index after the file for a message in a mailbox.
+func describeMatch(record grepRecord) string {
+	if record.Index > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", record.File, record.Index, record.Header, record.Value)
+	}
+	return fmt.Sprintf("%s: %s: %s", record.File, record.Header, record.Value)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrepCommand(t *testing.T) {
+	// a file whose name looks like a glob is read as it is
+	bracketed := filepath.Join(t.TempDir(), "[1].eml")
+	assert.NoError(t, os.WriteFile(bracketed, []byte("Subject: bracketed\n\nbody\n"), 0644))
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectOutput   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name:         "Decoded subject",
+			args:         []string{"grep", "-H", "Subject", "ご飯", "../test_files/simple.eml", "../test_files/archive.mbox"},
+			expectOutput: "../test_files/simple.eml: Subject: Re: ご飯に行きませんか？\n",
+		},
+		{
+			name:         "Mailbox index",
+			args:         []string{"grep", "-H", "from", "-H", "to", "山田", "../test_files/archive.mbox"},
+			expectOutput: "../test_files/archive.mbox:1: From: 山田太郎 <taro@example.jp>\n../test_files/archive.mbox:2: To: 山田太郎 <taro@example.jp>\n",
+		},
+		{
+			name: "Normalize and ignore case",
+			args: []string{"grep", "-i", "--normalize", "ＨＡＮＡＫＯ", "../test_files/archive.mbox", "-o", "yaml"},
+			expectOutput: `- file: ../test_files/archive.mbox
+  index: 1
+  message_id: <first@example.jp>
+  header: To
+  value: hanako@example.com
+- file: ../test_files/archive.mbox
+  index: 2
+  message_id: <second@example.com>
+  header: From
+  value: Hanako <hanako@example.com>
+`,
+		},
+		{
+			name:         "Glob",
+			args:         []string{"grep", "-F", "ニュースレター", "../test_files/*.eml"},
+			expectOutput: "../test_files/nested.eml: From: ニュースレター <news@example.jp>\n",
+		},
+		{
+			name:         "File named like a glob",
+			args:         []string{"grep", "bracketed", bracketed},
+			expectOutput: bracketed + ": Subject: bracketed\n",
+		},
+		{
+			name:           "No match",
+			args:           []string{"grep", "-H", "Subject", "請求書", "../test_files/nested.eml"},
+			expectError:    true,
+			expectedErrMsg: "no header matches",
+		},
+		{
+			name:           "Invalid pattern",
+			args:           []string{"grep", "(", "../test_files/simple.eml"},
+			expectError:    true,
+			expectedErrMsg: "invalid pattern: error parsing regexp: missing closing ): `(`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(GrepCmd(), tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, "Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+}
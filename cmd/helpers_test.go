@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// executeCommand runs cmd under a fresh root with the given arguments and
+// returns what it wrote to stdout and stderr. The usage is not printed on
+// errors, so that stderr holds only what the command wrote and the error.
+func executeCommand(cmd *cobra.Command, args []string) (string, string, error) {
+	origStdout := os.Stdout
+	origStderr := os.Stderr
+	rOut, wOut, _ := os.Pipe()
+	rErr, wErr, _ := os.Pipe()
+	os.Stdout = wOut
+	os.Stderr = wErr
+
+	root := &cobra.Command{Use: "gemm", SilenceUsage: true}
+	addOutputFlag(root)
+	root.AddCommand(cmd)
+	root.SetArgs(args)
+
+	// both pipes are drained while the command runs so that it never blocks
+	// on a full pipe
+	drain := func(r *os.File) chan []byte {
+		done := make(chan []byte)
+		go func() {
+			data, _ := io.ReadAll(r)
+			done <- data
+		}()
+		return done
+	}
+	outDone, errDone := drain(rOut), drain(rErr)
+	err := root.Execute()
+
+	wOut.Close()
+	wErr.Close()
+	outBytes := <-outDone
+	errBytes := <-errDone
+	os.Stdout = origStdout
+	os.Stderr = origStderr
+	return string(outBytes), string(errBytes), err
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+// hopTimeLayout is how the dates of hops are shown.
+const hopTimeLayout = "2006-01-02 15:04:05 -0700"
+
+func HopsCmd() *cobra.Command {
+	var filename string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "hops",
+		Short: "Trace the relays of a message from its Received headers",
+		Long: `Parse every Received header of a message and list the relays it passed
+through, from the oldest header at the bottom to the newest at the top, with
+the client address each relay saw, the protocol and whether TLS was used:
+	gemm hops -f test.eml
+	Date: 2024-01-01 09:00:01 +0900
+	1: [10.0.0.5, private] by mail.example.jp with ESMTPSA, TLS; 2024-01-01 09:00:03 +0900 (+2s)
+The delay of each hop is counted from the one before it, or from the Date
+header for the first. A hop dated before the previous one is marked as clock
+skew when it is by at most 5 minutes and as out of order beyond that. Use
+-o json or -o yaml to get every clause of the headers. An mbox, MMDF or
+Maildir mailbox traces every message.`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if filename == "" {
+				return fmt.Errorf("please specify a file with -f")
+			}
+			return forEachMessage(filename, format, func(r io.Reader, out *messageOutput) error {
+				return traceHops(r, out, filename)
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&filename, "file", "f", "", "file to read; use - for standard input")
+	addFormatFlag(cmd, &format)
+	return cmd
+}
+
+// traceHops prints the hops of a message.
+func traceHops(r io.Reader, out *messageOutput, filename string) error {
+	headers, err := utils.ReadRawHeaders(r)
+	if err != nil {
+		return fmt.Errorf("failed to read file '%s': %v", filename, err)
+	}
+	trace := utils.TraceHops(headers)
+	if len(trace.Hops) == 0 {
+		return fmt.Errorf("no Received header found")
+	}
+
+	record := newHopsRecord(trace)
+	return out.write(record, func() {
+		if !trace.Date.IsZero() {
+			fmt.Printf("Date: %s\n", trace.Date.Format(hopTimeLayout))
+		}
+		for i, hop := range trace.Hops {
+			fmt.Printf("%d: %s\n", i+1, describeHop(hop))
+		}
+		fmt.Printf("Total: %s\n", trace.Total)
+	})
+}
+
+// describeHop formats a hop as
+// "from a.example [192.0.2.1] by b.example with ESMTPS, TLS; 2024-01-01 09:00:00 +0900 (+2s)".
+func describeHop(hop utils.Hop) string {
+	var words []string
+	if hop.From != "" && (hop.IP == nil || strings.Trim(hop.From, "[]") != hop.IP.String()) {
+		words = append(words, "from", hop.From)
+	}
+	if hop.IP != nil {
+		address := hop.IP.String()
+		if hop.Private {
+			address += ", private"
+		}
+		words = append(words, "["+address+"]")
+	}
+	if hop.By != "" {
+		words = append(words, "by", hop.By)
+	}
+	if hop.With != "" {
+		words = append(words, "with", hop.With)
+	}
+	line := strings.Join(words, " ")
+	if hop.UsesTLS {
+		tls := "TLS"
+		if hop.TLSDetail != "" {
+			tls = hop.TLSDetail
+		}
+		line += ", " + tls
+	}
+
+	if hop.Date.IsZero() {
+		return line + "; no date"
+	}
+	line += "; " + hop.Date.Format(hopTimeLayout)
+	if hop.HasDelay {
+		notes := []string{formatDelay(hop.Delay)}
+		if hop.Skew {
+			notes = append(notes, "clock skew")
+		}
+		if hop.OutOfOrder {
+			notes = append(notes, "out of order")
+		}
+		line += " (" + strings.Join(notes, ", ") + ")"
+	}
+	return line
+}
+
+// formatDelay formats a delay with its sign, such as "+2s" or "-1m30s".
+func formatDelay(d time.Duration) string {
+	if d < 0 {
+		return d.String()
+	}
+	return "+" + d.String()
+}
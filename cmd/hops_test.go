@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHopsCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		expectOutput   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name: "Text",
+			args: []string{"hops", "-f", "../test_files/received.eml"},
+			expectOutput: `Date: 2024-01-01 09:00:01 +0900
+1: [10.0.0.5, private] by mail.example.jp with ESMTPSA, TLS; 2024-01-01 09:00:03 +0900 (+2s)
+2: from mail.example.jp [192.0.2.10] by mx.example.com with ESMTPS, TLSv1.3 TLS_AES_256_GCM_SHA384; 2024-01-01 09:00:12 +0900 (+9s)
+3: from mx.example.com [127.0.0.1, private] by mbox.example.com with LMTP; 2024-01-01 00:00:10 +0000 (-2s, clock skew)
+Total: 9s
+`,
+		},
+		{
+			name: "JSON",
+			args: []string{"hops", "-f", "../test_files/received.eml", "-o", "json"},
+			expectOutput: `{
+  "date": "2024-01-01T09:00:01+09:00",
+  "total_seconds": 9,
+  "hops": [
+    {
+      "hop": 1,
+      "from": "[10.0.0.5]",
+      "from_comment": "unknown [10.0.0.5]",
+      "ip": "10.0.0.5",
+      "private": true,
+      "by": "mail.example.jp",
+      "by_comment": "Postfix",
+      "with": "ESMTPSA",
+      "id": "8A1B2C3D4E",
+      "for": "hanako@example.com",
+      "tls": true,
+      "date": "2024-01-01T09:00:03+09:00",
+      "delay_seconds": 2,
+      "raw": "from [10.0.0.5] (unknown [10.0.0.5])\tby mail.example.jp (Postfix) with ESMTPSA id 8A1B2C3D4E\tfor \u003chanako@example.com\u003e; Mon,  1 Jan 2024 09:00:03 +0900 (JST)"
+    },
+    {
+      "hop": 2,
+      "from": "mail.example.jp",
+      "from_comment": "mail.example.jp [192.0.2.10]",
+      "ip": "192.0.2.10",
+      "by": "mx.example.com",
+      "by_comment": "Postfix",
+      "with": "ESMTPS",
+      "id": "4T3kQm0bZ7z9sHL",
+      "for": "hanako@example.com",
+      "comments": [
+        "using TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits) key-exchange X25519 server-signature RSA-PSS (2048 bits)",
+        "No client certificate requested"
+      ],
+      "tls": true,
+      "tls_detail": "TLSv1.3 TLS_AES_256_GCM_SHA384",
+      "date": "2024-01-01T09:00:12+09:00",
+      "delay_seconds": 9,
+      "raw": "from mail.example.jp (mail.example.jp [192.0.2.10])\t(using TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits)\t key-exchange X25519 server-signature RSA-PSS (2048 bits))\t(No client certificate requested)\tby mx.example.com (Postfix) with ESMTPS id 4T3kQm0bZ7z9sHL\tfor \u003chanako@example.com\u003e; Mon,  1 Jan 2024 09:00:12 +0900 (JST)"
+    },
+    {
+      "hop": 3,
+      "from": "mx.example.com",
+      "from_comment": "localhost [127.0.0.1]",
+      "ip": "127.0.0.1",
+      "private": true,
+      "by": "mbox.example.com",
+      "by_comment": "Dovecot",
+      "with": "LMTP",
+      "id": "kD3sL0gNkmWvBQAA",
+      "for": "hanako@example.com",
+      "tls": false,
+      "date": "2024-01-01T00:00:10Z",
+      "delay_seconds": -2,
+      "skew": true,
+      "raw": "from mx.example.com (localhost [127.0.0.1])\tby mbox.example.com (Dovecot) with LMTP id kD3sL0gNkmWvBQAA\tfor \u003chanako@example.com\u003e; Mon, 01 Jan 2024 00:00:10 +0000"
+    }
+  ]
+}
+`,
+		},
+		{
+			name:           "No Received header",
+			args:           []string{"hops", "-f", "../test_files/simple.eml"},
+			expectError:    true,
+			expectedErrMsg: "no Received header found",
+		},
+		{
+			name:           "No file",
+			args:           []string{"hops"},
+			expectError:    true,
+			expectedErrMsg: "please specify a file with -f",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(HopsCmd(), tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, "Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"io"
+	"os"
+)
+
+// openInput opens filename for reading, treating "-" as standard input.
+func openInput(filename string) (io.ReadCloser, error) {
+	if filename == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(filename)
+}
+
+// isTerminal reports whether f is connected to a terminal rather than a pipe
+// or a regular file.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (stat.Mode() & os.ModeCharDevice) != 0
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+// addFormatFlag adds the --format flag selecting how -f is read.
+func addFormatFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVar(format, "format", string(utils.FormatAuto), "mailbox format of the file; auto, eml, mbox, mboxo, mboxrd, mboxcl2, mmdf, maildir or msg")
+}
+
+// messageOutput is where the output of a message read by forEachMessage
+// goes. For a message of a mailbox, structured output is kept in record
+// instead of printed, so that the whole mailbox is written as one list.
+type messageOutput struct {
+	record *messageRecord
+}
+
+// inMailbox reports whether the message is one of several.
+func (o *messageOutput) inMailbox() bool {
+	return o.record != nil
+}
+
+// write is writeOutput for the message.
+func (o *messageOutput) write(v interface{}, text func()) error {
+	if o.record != nil && isStructuredOutput() {
+		o.record.Result = v
+		return nil
+	}
+	return writeOutput(v, text)
+}
+
+// forEachMessage opens the file, Maildir or standard input named by
+// filename and calls fn with every message in it and where its output goes.
+// A single message is streamed to fn as is. For a mailbox, the text output
+// of each message follows a heading with its index and Message-ID,
+// structured output becomes a list of message records, and a failing
+// message is reported without stopping the others.
+func forEachMessage(filename, format string, fn func(r io.Reader, out *messageOutput) error) error {
+	mailboxFormat, err := utils.ParseMailboxFormat(format)
+	if err != nil {
+		return err
+	}
+	var mailbox *utils.Mailbox
+	if filename == "-" {
+		mailbox, err = utils.NewMailboxReader(os.Stdin, filename, mailboxFormat)
+	} else {
+		mailbox, err = utils.OpenMailbox(filename, mailboxFormat)
+	}
+	if err != nil {
+		return err
+	}
+	defer mailbox.Close()
+
+	if mailbox.IsSingle() {
+		r, err := mailbox.NextReader()
+		if err != nil {
+			return err
+		}
+		return fn(r, &messageOutput{})
+	}
+
+	records := []messageRecord{}
+	failed := 0
+	var readErr error
+	for {
+		message, err := mailbox.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		record := messageRecord{Index: message.Index, MessageID: message.MessageID(), Source: message.Source}
+		if !isStructuredOutput() {
+			if len(records) > 0 {
+				fmt.Println()
+			}
+			fmt.Println(messageHeading(record, filename))
+		}
+		err = fn(bytes.NewReader(message.Data), &messageOutput{record: &record})
+		if err != nil {
+			failed++
+			record.Error = err.Error()
+			if !isStructuredOutput() {
+				fmt.Fprintf(os.Stderr, "message %d: %v\n", record.Index, err)
+			}
+		}
+		records = append(records, record)
+	}
+
+	if isStructuredOutput() {
+		if err := writeOutput(records, nil); err != nil {
+			return err
+		}
+	}
+	switch {
+	case readErr != nil:
+		return readErr
+	case len(records) == 0:
+		return fmt.Errorf("no message found")
+	case failed > 0:
+		return fmt.Errorf("%d of %d messages failed", failed, len(records))
+	}
+	return nil
+}
+
+// messageHeading returns the line printed before each message of a mailbox,
+// such as "==> 2 <id@example.com> <==". Maildir messages also show their file.
+func messageHeading(record messageRecord, filename string) string {
+	heading := fmt.Sprintf("==> %d", record.Index)
+	if record.MessageID != "" {
+		heading += " " + record.MessageID
+	}
+	if record.Source != filename {
+		heading += " " + record.Source
+	}
+	return heading + " <=="
+}
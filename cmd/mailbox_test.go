@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMailboxInput(t *testing.T) {
+	maildir := t.TempDir()
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(maildir, sub), 0755))
+	}
+	message := "Message-ID: <maildir@example.com>\nSubject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\n\nbody\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(maildir, "new", "1700000000.M1.host"), []byte(message), 0644))
+
+	tests := []struct {
+		name           string
+		cmd            *cobra.Command
+		args           []string
+		expectOutput   string
+		expectStderr   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name: "Decode mbox",
+			cmd:  DecodeCmd(),
+			args: []string{"decode", "-f", "../test_files/archive.mbox", "-H", "Subject"},
+			expectOutput: `==> 1 <first@example.jp> <==
+Subject: こんにちは
+
+==> 2 <second@example.com> <==
+Subject: Re: hello
+
+==> 3 <third@example.jp> <==
+Subject: ありがとう
+`,
+		},
+		{
+			name: "Body unquotes From lines",
+			cmd:  BodyCmd(),
+			args: []string{"body", "-f", "../test_files/archive.mbox"},
+			expectOutput: `==> 1 <first@example.jp> <==
+Hello.
+
+==> 2 <second@example.com> <==
+From the top of the line.
+>From quoted once.
+
+==> 3 <third@example.jp> <==
+Thanks.
+`,
+		},
+		{
+			name: "mboxo keeps the second quote",
+			cmd:  BodyCmd(),
+			args: []string{"body", "-f", "../test_files/archive.mbox", "--format", "mboxo"},
+			expectOutput: `==> 1 <first@example.jp> <==
+Hello.
+
+==> 2 <second@example.com> <==
+From the top of the line.
+>>From quoted once.
+
+==> 3 <third@example.jp> <==
+Thanks.
+`,
+		},
+		{
+			name: "Structured output",
+			cmd:  TreeCmd(),
+			args: []string{"tree", "-f", "../test_files/archive.mbox", "-o", "yaml"},
+			expectOutput: `- index: 1
+  message_id: <first@example.jp>
+  source: ../test_files/archive.mbox
+  result:
+    path: "1"
+    content_type: text/plain
+    charset: UTF-8
+    transfer_encoding: 7bit
+    size: 7
+- index: 2
+  message_id: <second@example.com>
+  source: ../test_files/archive.mbox
+  result:
+    path: "1"
+    content_type: text/plain
+    charset: UTF-8
+    transfer_encoding: 7bit
+    size: 45
+- index: 3
+  message_id: <third@example.jp>
+  source: ../test_files/archive.mbox
+  result:
+    path: "1"
+    content_type: text/plain
+    transfer_encoding: 7bit
+    size: 8
+`,
+		},
+		{
+			name:         "Maildir",
+			cmd:          DecodeCmd(),
+			args:         []string{"decode", "-f", maildir, "--print"},
+			expectOutput: "==> 1 <maildir@example.com> " + filepath.Join(maildir, "new", "1700000000.M1.host") + " <==\nSubject: こんにちは\n",
+		},
+		{
+			name: "Failing messages",
+			cmd:  AddrsCmd(),
+			args: []string{"addrs", "-f", "../test_files/archive.mbox", "-H", "To"},
+			expectOutput: `==> 1 <first@example.jp> <==
+To: <hanako@example.com>
+
+==> 2 <second@example.com> <==
+To: 山田太郎 <taro@example.jp>
+
+==> 3 <third@example.jp> <==
+`,
+			expectStderr:   "message 3: no address header found\n",
+			expectError:    true,
+			expectedErrMsg: "1 of 3 messages failed",
+		},
+		{
+			name:           "Invalid format",
+			cmd:            TreeCmd(),
+			args:           []string{"tree", "-f", "../test_files/archive.mbox", "--format", "pst"},
+			expectError:    true,
+			expectedErrMsg: "format must be one of auto, eml, mbox, mboxo, mboxrd, mboxcl2, mmdf, maildir or msg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(tt.cmd, tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, tt.expectStderr+"Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectStderr, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+}
@@ -0,0 +1,459 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+	"gopkg.in/yaml.v3"
+)
+
+var outputFormat string
+
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "output format; text, json, yaml")
+}
+
+// isStructuredOutput reports whether the output format is json or yaml.
+func isStructuredOutput() bool {
+	return outputFormat == "json" || outputFormat == "yaml"
+}
+
+// writeOutput prints v as json or yaml, or calls text for the text format.
+func writeOutput(v interface{}, text func()) error {
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "text", "":
+		text()
+	default:
+		return fmt.Errorf("output must be either text, json, or yaml")
+	}
+	return nil
+}
+
+type wordRecord struct {
+	Word     string `json:"word" yaml:"word"`
+	Charset  string `json:"charset" yaml:"charset"`
+	Encoding string `json:"encoding" yaml:"encoding"`
+	Decoded  string `json:"decoded" yaml:"decoded"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type headerRecord struct {
+	Name    string       `json:"name,omitempty" yaml:"name,omitempty"`
+	Raw     string       `json:"raw" yaml:"raw"`
+	Decoded string       `json:"decoded" yaml:"decoded"`
+	Words   []wordRecord `json:"words" yaml:"words"`
+	Error   string       `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type encodeRecord struct {
+	Header   string        `json:"header,omitempty" yaml:"header,omitempty"`
+	Param    string        `json:"param,omitempty" yaml:"param,omitempty"`
+	Input    string        `json:"input" yaml:"input"`
+	Charset  string        `json:"charset" yaml:"charset"`
+	Encoding string        `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+	Encoded  string        `json:"encoded" yaml:"encoded"`
+	Words    []wordRecord  `json:"words,omitempty" yaml:"words,omitempty"`
+	Verify   *verifyRecord `json:"verify,omitempty" yaml:"verify,omitempty"`
+}
+
+type verifyRecord struct {
+	Decoded string   `json:"decoded" yaml:"decoded"`
+	Match   bool     `json:"match" yaml:"match"`
+	Losses  []string `json:"losses,omitempty" yaml:"losses,omitempty"`
+}
+
+type fileRecord struct {
+	File      string         `json:"file" yaml:"file"`
+	Index     int            `json:"index,omitempty" yaml:"index,omitempty"`
+	MessageID string         `json:"message_id,omitempty" yaml:"message_id,omitempty"`
+	Headers   []headerRecord `json:"headers" yaml:"headers"`
+	Error     string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type grepRecord struct {
+	File      string `json:"file" yaml:"file"`
+	Index     int    `json:"index,omitempty" yaml:"index,omitempty"`
+	MessageID string `json:"message_id,omitempty" yaml:"message_id,omitempty"`
+	Header    string `json:"header,omitempty" yaml:"header,omitempty"`
+	Value     string `json:"value,omitempty" yaml:"value,omitempty"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type problemRecord struct {
+	Column  int    `json:"column" yaml:"column"`
+	Word    string `json:"word" yaml:"word"`
+	Message string `json:"message" yaml:"message"`
+}
+
+type lintRecord struct {
+	Name     string          `json:"name,omitempty" yaml:"name,omitempty"`
+	Raw      string          `json:"raw" yaml:"raw"`
+	Problems []problemRecord `json:"problems" yaml:"problems"`
+}
+
+type bodyRecord struct {
+	Path             string `json:"path" yaml:"path"`
+	ContentType      string `json:"content_type" yaml:"content_type"`
+	Charset          string `json:"charset,omitempty" yaml:"charset,omitempty"`
+	TransferEncoding string `json:"transfer_encoding" yaml:"transfer_encoding"`
+	Size             int    `json:"size" yaml:"size"`
+	Text             string `json:"text,omitempty" yaml:"text,omitempty"`
+}
+
+type partRecord struct {
+	Path             string           `json:"path" yaml:"path"`
+	ContentType      string           `json:"content_type" yaml:"content_type"`
+	Charset          string           `json:"charset,omitempty" yaml:"charset,omitempty"`
+	TransferEncoding string           `json:"transfer_encoding,omitempty" yaml:"transfer_encoding,omitempty"`
+	Disposition      string           `json:"disposition,omitempty" yaml:"disposition,omitempty"`
+	Filename         string           `json:"filename,omitempty" yaml:"filename,omitempty"`
+	Size             int              `json:"size" yaml:"size"`
+	Error            string           `json:"error,omitempty" yaml:"error,omitempty"`
+	Properties       []propertyRecord `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Children         []partRecord     `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+type propertyRecord struct {
+	Tag   string `json:"tag" yaml:"tag"`
+	Name  string `json:"name,omitempty" yaml:"name,omitempty"`
+	Value string `json:"value" yaml:"value"`
+}
+
+type extractRecord struct {
+	Path        string `json:"path" yaml:"path"`
+	ContentType string `json:"content_type" yaml:"content_type"`
+	Filename    string `json:"filename,omitempty" yaml:"filename,omitempty"`
+	SavedAs     string `json:"saved_as" yaml:"saved_as"`
+	Size        int    `json:"size" yaml:"size"`
+}
+
+type dkimRecord struct {
+	Index            int      `json:"index" yaml:"index"`
+	Result           string   `json:"result" yaml:"result"`
+	Domain           string   `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Selector         string   `json:"selector,omitempty" yaml:"selector,omitempty"`
+	Algorithm        string   `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Canonicalization string   `json:"canonicalization,omitempty" yaml:"canonicalization,omitempty"`
+	Identity         string   `json:"identity,omitempty" yaml:"identity,omitempty"`
+	Headers          []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	BodyLength       *int64   `json:"body_length,omitempty" yaml:"body_length,omitempty"`
+	Testing          bool     `json:"testing,omitempty" yaml:"testing,omitempty"`
+	Reason           string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Raw              string   `json:"raw,omitempty" yaml:"raw,omitempty"`
+}
+
+type dkimSignRecord struct {
+	Domain           string   `json:"domain" yaml:"domain"`
+	Selector         string   `json:"selector" yaml:"selector"`
+	Algorithm        string   `json:"algorithm" yaml:"algorithm"`
+	Canonicalization string   `json:"canonicalization" yaml:"canonicalization"`
+	Identity         string   `json:"identity,omitempty" yaml:"identity,omitempty"`
+	Headers          []string `json:"headers" yaml:"headers"`
+	BodyLength       *int64   `json:"body_length,omitempty" yaml:"body_length,omitempty"`
+	Field            string   `json:"field" yaml:"field"`
+}
+
+type arcRecord struct {
+	Result     string         `json:"result" yaml:"result"`
+	Reason     string         `json:"reason,omitempty" yaml:"reason,omitempty"`
+	OldestPass int            `json:"oldest_pass,omitempty" yaml:"oldest_pass,omitempty"`
+	Sets       []arcSetRecord `json:"sets" yaml:"sets"`
+}
+
+type arcSetRecord struct {
+	Instance               int    `json:"instance" yaml:"instance"`
+	AuthServID             string `json:"authserv_id,omitempty" yaml:"authserv_id,omitempty"`
+	Results                string `json:"results,omitempty" yaml:"results,omitempty"`
+	ChainValidation        string `json:"chain_validation,omitempty" yaml:"chain_validation,omitempty"`
+	Domain                 string `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Selector               string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	Algorithm              string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	MessageSignature       string `json:"message_signature" yaml:"message_signature"`
+	MessageSignatureReason string `json:"message_signature_reason,omitempty" yaml:"message_signature_reason,omitempty"`
+	Seal                   string `json:"seal" yaml:"seal"`
+	SealReason             string `json:"seal_reason,omitempty" yaml:"seal_reason,omitempty"`
+}
+
+type arcSealRecord struct {
+	Instance        int      `json:"instance" yaml:"instance"`
+	ChainValidation string   `json:"chain_validation" yaml:"chain_validation"`
+	Domain          string   `json:"domain" yaml:"domain"`
+	Selector        string   `json:"selector" yaml:"selector"`
+	Algorithm       string   `json:"algorithm" yaml:"algorithm"`
+	AuthServID      string   `json:"authserv_id" yaml:"authserv_id"`
+	Results         []string `json:"results,omitempty" yaml:"results,omitempty"`
+	Fields          string   `json:"fields" yaml:"fields"`
+}
+
+type hopsRecord struct {
+	Date         string      `json:"date,omitempty" yaml:"date,omitempty"`
+	TotalSeconds float64     `json:"total_seconds" yaml:"total_seconds"`
+	Hops         []hopRecord `json:"hops" yaml:"hops"`
+}
+
+type hopRecord struct {
+	Hop          int      `json:"hop" yaml:"hop"`
+	From         string   `json:"from,omitempty" yaml:"from,omitempty"`
+	FromComment  string   `json:"from_comment,omitempty" yaml:"from_comment,omitempty"`
+	IP           string   `json:"ip,omitempty" yaml:"ip,omitempty"`
+	Private      bool     `json:"private,omitempty" yaml:"private,omitempty"`
+	By           string   `json:"by,omitempty" yaml:"by,omitempty"`
+	ByComment    string   `json:"by_comment,omitempty" yaml:"by_comment,omitempty"`
+	Via          string   `json:"via,omitempty" yaml:"via,omitempty"`
+	With         string   `json:"with,omitempty" yaml:"with,omitempty"`
+	ID           string   `json:"id,omitempty" yaml:"id,omitempty"`
+	For          string   `json:"for,omitempty" yaml:"for,omitempty"`
+	Comments     []string `json:"comments,omitempty" yaml:"comments,omitempty"`
+	TLS          bool     `json:"tls" yaml:"tls"`
+	TLSDetail    string   `json:"tls_detail,omitempty" yaml:"tls_detail,omitempty"`
+	Date         string   `json:"date,omitempty" yaml:"date,omitempty"`
+	DelaySeconds *float64 `json:"delay_seconds,omitempty" yaml:"delay_seconds,omitempty"`
+	Skew         bool     `json:"skew,omitempty" yaml:"skew,omitempty"`
+	OutOfOrder   bool     `json:"out_of_order,omitempty" yaml:"out_of_order,omitempty"`
+	Raw          string   `json:"raw" yaml:"raw"`
+}
+
+type messageRecord struct {
+	Index     int         `json:"index" yaml:"index"`
+	MessageID string      `json:"message_id,omitempty" yaml:"message_id,omitempty"`
+	Source    string      `json:"source" yaml:"source"`
+	Result    interface{} `json:"result,omitempty" yaml:"result,omitempty"`
+	Error     string      `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func newWordRecords(s string) []wordRecord {
+	records := []wordRecord{}
+	for _, word := range utils.ParseEncodedWords(s) {
+		record := wordRecord{
+			Word:     word.Word,
+			Charset:  word.Charset,
+			Encoding: word.Encoding,
+			Decoded:  word.Decoded,
+		}
+		if word.Err != nil {
+			record.Error = word.Err.Error()
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func newHeaderRecord(name, raw, decoded string, err error) headerRecord {
+	record := headerRecord{
+		Name:    name,
+		Raw:     raw,
+		Decoded: decoded,
+		Words:   newWordRecords(raw),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+func newFileRecord(file string, headers []utils.Header, err error) fileRecord {
+	record := fileRecord{File: file, Headers: []headerRecord{}}
+	for _, header := range headers {
+		record.Headers = append(record.Headers, newHeaderRecord(header.Name, header.Raw, header.Decoded, header.Err))
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+func newLintRecord(name, raw string, problems []utils.Problem) lintRecord {
+	record := lintRecord{
+		Name:     name,
+		Raw:      raw,
+		Problems: []problemRecord{},
+	}
+	for _, problem := range problems {
+		record.Problems = append(record.Problems, problemRecord{
+			Column:  problem.Column,
+			Word:    problem.Word,
+			Message: problem.Message,
+		})
+	}
+	return record
+}
+
+func newPartRecord(part *utils.Part) partRecord {
+	disposition, _ := part.Disposition()
+	record := partRecord{
+		Path:        part.Path,
+		ContentType: part.MediaType,
+		Charset:     part.Charset(),
+		Disposition: disposition,
+		Filename:    part.Filename(),
+	}
+	if !part.IsMultipart() {
+		record.TransferEncoding = part.TransferEncoding()
+	}
+	size, err := part.DecodedSize()
+	if part.Err != nil {
+		record.Error = part.Err.Error()
+	} else if err != nil {
+		record.Error = err.Error()
+	}
+	record.Size = size
+	for _, property := range part.Properties {
+		record.Properties = append(record.Properties, propertyRecord{
+			Tag:   property.Tag(),
+			Name:  property.CanonicalName(),
+			Value: property.String(),
+		})
+	}
+	for _, child := range part.Children {
+		record.Children = append(record.Children, newPartRecord(child))
+	}
+	return record
+}
+
+func newDKIMRecord(index int, result utils.DKIMResult) dkimRecord {
+	record := dkimRecord{Index: index, Result: result.Status, Testing: result.Testing}
+	if sig := result.Signature; sig != nil {
+		record.Domain = sig.Domain
+		record.Selector = sig.Selector
+		record.Algorithm = sig.Algorithm
+		record.Canonicalization = sig.Canonicalization()
+		record.Identity = sig.Identity
+		record.Headers = sig.Headers
+		if sig.BodyLength >= 0 {
+			length := sig.BodyLength
+			record.BodyLength = &length
+		}
+	} else {
+		record.Raw = result.Raw
+	}
+	if result.Err != nil {
+		record.Reason = result.Err.Error()
+	}
+	return record
+}
+
+func newDKIMSignRecord(sig *utils.DKIMSignature, field string) dkimSignRecord {
+	record := dkimSignRecord{
+		Domain:           sig.Domain,
+		Selector:         sig.Selector,
+		Algorithm:        sig.Algorithm,
+		Canonicalization: sig.Canonicalization(),
+		Identity:         sig.Identity,
+		Headers:          sig.Headers,
+		Field:            field,
+	}
+	if sig.BodyLength >= 0 {
+		length := sig.BodyLength
+		record.BodyLength = &length
+	}
+	return record
+}
+
+func newARCRecord(result *utils.ARCResult) arcRecord {
+	record := arcRecord{Result: result.Status, OldestPass: result.OldestPass, Sets: []arcSetRecord{}}
+	if result.Err != nil {
+		record.Reason = result.Err.Error()
+	}
+	for _, set := range result.Sets {
+		setRecord := arcSetRecord{
+			Instance:         set.Instance,
+			AuthServID:       set.AuthServID,
+			Results:          set.Results,
+			MessageSignature: set.MessageSignature.Status,
+			Seal:             set.SealStatus,
+		}
+		if seal := set.Seal; seal != nil {
+			setRecord.ChainValidation = seal.ChainValidation
+			setRecord.Domain = seal.Domain
+			setRecord.Selector = seal.Selector
+			setRecord.Algorithm = seal.Algorithm
+		}
+		if err := set.MessageSignature.Err; err != nil {
+			setRecord.MessageSignatureReason = err.Error()
+		}
+		if set.SealErr != nil {
+			setRecord.SealReason = set.SealErr.Error()
+		}
+		record.Sets = append(record.Sets, setRecord)
+	}
+	return record
+}
+
+func newHopsRecord(trace *utils.HopTrace) hopsRecord {
+	record := hopsRecord{TotalSeconds: trace.Total.Seconds(), Hops: []hopRecord{}}
+	if !trace.Date.IsZero() {
+		record.Date = trace.Date.Format(time.RFC3339)
+	}
+	for i, hop := range trace.Hops {
+		hopRecord := hopRecord{
+			Hop:         i + 1,
+			From:        hop.From,
+			FromComment: hop.FromComment,
+			Private:     hop.Private,
+			By:          hop.By,
+			ByComment:   hop.ByComment,
+			Via:         hop.Via,
+			With:        hop.With,
+			ID:          hop.ID,
+			For:         hop.For,
+			Comments:    hop.Comments,
+			TLS:         hop.UsesTLS,
+			TLSDetail:   hop.TLSDetail,
+			Skew:        hop.Skew,
+			OutOfOrder:  hop.OutOfOrder,
+			Raw:         hop.Raw,
+		}
+		if hop.IP != nil {
+			hopRecord.IP = hop.IP.String()
+		}
+		if !hop.Date.IsZero() {
+			hopRecord.Date = hop.Date.Format(time.RFC3339)
+		}
+		if hop.HasDelay {
+			delay := hop.Delay.Seconds()
+			hopRecord.DelaySeconds = &delay
+		}
+		record.Hops = append(record.Hops, hopRecord)
+	}
+	return record
+}
+
+type addressRecord struct {
+	Header        string `json:"header" yaml:"header"`
+	Group         string `json:"group,omitempty" yaml:"group,omitempty"`
+	Name          string `json:"name,omitempty" yaml:"name,omitempty"`
+	Address       string `json:"address,omitempty" yaml:"address,omitempty"`
+	LocalPart     string `json:"local_part,omitempty" yaml:"local_part,omitempty"`
+	Domain        string `json:"domain,omitempty" yaml:"domain,omitempty"`
+	UnicodeDomain string `json:"unicode_domain,omitempty" yaml:"unicode_domain,omitempty"`
+	Error         string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func newAddressRecord(header string, address utils.Address) addressRecord {
+	return addressRecord{
+		Header:        header,
+		Group:         address.Group,
+		Name:          address.Name,
+		Address:       address.AddrSpec(),
+		LocalPart:     address.LocalPart,
+		Domain:        address.Domain,
+		UnicodeDomain: address.UnicodeDomain,
+	}
+}
@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/ProtonMail/go-mime"
   "github.com/manifoldco/promptui"
@@ -15,6 +18,8 @@ func selectPromptAction(label string, items []string) (int, string, error) {
 			CursorPos:    0,
 			HideSelected: false,
 			HideHelp:     true,
+			Stdin:        os.Stdin,
+			Stdout:       os.Stdout,
 	}
 
 	index, result, err := prompt.Run()
@@ -42,9 +47,9 @@ func selectFuncPrompt(decodeOnly bool) error {
 		if err != nil {
 			return err
 		}
-		return decodeEmlPrompt(result)
+		return decodeFilePrompt(result)
 	case funcOptions[2]:
-		return encodePrompt("", "", "")
+		return encodePrompt("", "", "", encodeOptions{})
 	}
 	return nil
 }
@@ -75,6 +80,8 @@ func chooseFilePrompt() (string, error) {
 	prompt := promptui.Prompt{
 		Label:       "Enter the path to the .eml file",
 		HideEntered: false,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
 	}
 
 	result, err := prompt.Run()
@@ -85,26 +92,67 @@ func chooseFilePrompt() (string, error) {
 	return result, nil
 }
 
-func decodeEmlPrompt(filename string) error {
-	decodedHeaders, err := utils.DecodeHeaders(filename)
+// decodeFilePrompt prompts for a header of the message in filename, which
+// may be an Outlook .msg file as with decode -f. The messages of a mailbox
+// are printed instead.
+func decodeFilePrompt(filename string) error {
+	return forEachMessage(filename, string(utils.FormatAuto), func(r io.Reader, out *messageOutput) error {
+		if out.inMailbox() {
+			return decodeEmlPrint(r, out, nil)
+		}
+		return decodeEmlPrompt(r)
+	})
+}
+
+func decodeEmlPrompt(r io.Reader) error {
+	decodedHeaders, err := utils.DecodeHeadersFrom(r)
 	if err != nil {
 		return err
 	}
-	var headerKeys []string
-	for key := range decodedHeaders {
-		headerKeys = append(headerKeys, key)
-	}
-	_, choice, err := selectPromptAction("Choose a header to decode", headerKeys)
+	index, _, err := selectPromptAction("Choose a header to decode", headerLabels(decodedHeaders))
 	if err != nil {
 		return err
 	}
-	decoded := decodedHeaders[choice]
+	decoded := decodedHeaders[index].Decoded
 
 	fmt.Println(decoded)
 	return nil
 }
 
-func encodePrompt(text, charset, encoding string) error {
+// headerLabels returns the prompt items for headers in file order, numbering
+// repeated names so that duplicates can be told apart.
+func headerLabels(headers []utils.Header) []string {
+	counts := make(map[string]int)
+	for _, header := range headers {
+		counts[strings.ToLower(header.Name)]++
+	}
+	seen := make(map[string]int)
+	var labels []string
+	for _, header := range headers {
+		key := strings.ToLower(header.Name)
+		seen[key]++
+		if counts[key] > 1 {
+			labels = append(labels, fmt.Sprintf("%s (%d/%d)", header.Name, seen[key], counts[key]))
+		} else {
+			labels = append(labels, header.Name)
+		}
+	}
+	return labels
+}
+
+func charsetPrompt() (string, error) {
+	prompt := promptui.Prompt{
+		Label:       "Enter a charset name",
+		HideEntered: false,
+		Validate: func(input string) error {
+			_, _, err := utils.LookupCharset(input)
+			return err
+		},
+	}
+	return prompt.Run()
+}
+
+func encodePrompt(text, charset, encoding string, opts encodeOptions) error {
 	if text == "" {
 		prompt := promptui.Prompt{
 			Label: "Enter text to encode",
@@ -114,30 +162,78 @@ func encodePrompt(text, charset, encoding string) error {
 		if err != nil {
 			return err
 		}
-		return encodePrompt(textInput, charset, encoding)
+		return encodePrompt(textInput, charset, encoding, opts)
 	} 
+	if opts.param != "" {
+		return encodeParam(text, charset, opts)
+	}
 	if charset == "" {
-		items := []string{"UTF-8", "ISO-2022-JP", "Shift_JIS"}
+		items := []string{"Auto", "UTF-8", "ISO-2022-JP", "Shift_JIS", "EUC-JP", "Other"}
 		_, charsetInput, err := selectPromptAction("Choose a charset", items)
 		if err != nil {
 			return err
 		}
-		return encodePrompt(text, charsetInput, encoding)
+		if charsetInput == "Other" {
+			charsetInput, err = charsetPrompt()
+			if err != nil {
+				return err
+			}
+		}
+		return encodePrompt(text, charsetInput, encoding, opts)
 	} 
 	if encoding == "" {
-		items := []string{"B", "Q"}
+		items := []string{"Auto", "B", "Q"}
 		_, encodingInput, err := selectPromptAction("Choose an encoding", items)
 		if err != nil {
 			return err
 		}
-		return encodePrompt(text, charset, encodingInput)
+		return encodePrompt(text, charset, encodingInput, opts)
 	}
 	
-	normalizedCharset := utils.NormalizeCharset(charset)
-	encoded, err := utils.EncodeHeader(text, normalizedCharset, encoding)
+	if isAuto(charset) {
+		charset = utils.AutoCharset(text)
+	}
+	source, target, err := utils.ApplyUnmappable(text, charset, opts.unmappable)
 	if err != nil {
+		err = fmt.Errorf("%v; use --unmappable to substitute, transliterate or switch to UTF-8", err)
+		if opts.verify {
+			return lossError(err, text, charset)
+		}
 		return err
 	}
-	fmt.Println(encoded)
-	return nil
-}
\ No newline at end of file
+	mimeCharset, _, err := utils.LookupCharset(target)
+	if err != nil {
+		return err
+	}
+	if isAuto(encoding) {
+		encoding, err = utils.AutoEncoding(source, target)
+		if err != nil {
+			return err
+		}
+	}
+	var encoded string
+	if opts.header != "" {
+		encoded, err = utils.EncodeHeaderField(opts.header, source, target, encoding)
+	} else {
+		encoded, err = utils.EncodeHeader(source, target, encoding)
+	}
+	if err != nil {
+		return err
+	}
+	record := encodeRecord{
+		Header:   opts.header,
+		Input:    text,
+		Charset:  mimeCharset,
+		Encoding: strings.ToUpper(encoding),
+		Encoded:  encoded,
+		Words:    newWordRecords(encoded),
+	}
+	if opts.verify {
+		verification, err := verifyEncoded(text, encoded, charset, target, opts.header)
+		if err != nil {
+			return err
+		}
+		record.Verify = verification
+	}
+	return writeEncodeRecord(record)
+}
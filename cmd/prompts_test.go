@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeFilePrompt(t *testing.T) {
+	tests := []struct {
+		name           string
+		file           string
+		expectOutput   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name:         "EML file",
+			file:         "../test_files/simple.eml",
+			expectOutput: "John Doe （ジョン\u3000ドゥー） <john@example.com>\n",
+		},
+		{
+			name:         "MSG file",
+			file:         "../test_files/sample.msg",
+			expectOutput: "山田 太郎 <taro@example.jp>\n",
+		},
+		{
+			name:           "Missing file",
+			file:           "../test_files/missing.eml",
+			expectError:    true,
+			expectedErrMsg: "stat ../test_files/missing.eml: no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Enter picks the first header
+			output, err := runPrompt(t, "\r", func() error {
+				return decodeFilePrompt(tt.file)
+			})
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				return
+			}
+			assert.NoError(t, err)
+			// the prompt is drawn before the decoded header
+			assert.True(t, strings.HasSuffix(output, "\x1b[?25h"+tt.expectOutput), "unexpected output %q", output)
+		})
+	}
+}
+
+// runPrompt runs f with input as the keys typed at the prompt and returns
+// what it wrote to stdout.
+func runPrompt(t *testing.T, input string, f func() error) (string, error) {
+	origStdin := os.Stdin
+	origStdout := os.Stdout
+	rIn, wIn, _ := os.Pipe()
+	rOut, wOut, _ := os.Pipe()
+	os.Stdin = rIn
+	os.Stdout = wOut
+	defer func() {
+		os.Stdin = origStdin
+		os.Stdout = origStdout
+	}()
+
+	_, err := wIn.WriteString(input)
+	assert.NoError(t, err)
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(rOut)
+		done <- data
+	}()
+	err = f()
+	wOut.Close()
+	wIn.Close()
+	return string(<-done), err
+}
@@ -13,7 +13,8 @@ var rootCmd = &cobra.Command{
 You can also run the command with arguments. For example:
 	gemm decode '=?ISO-2022-JP?B?GyRCJDMkcyRLJEEkTxsoQg==?='
 	gemm decode -f test.eml
-	gemm encode こんにちは`,
+	gemm encode こんにちは
+Add --output json or --output yaml for machine-readable output.`,
 	Version: "0.2.0",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return selectFuncPrompt(false)
@@ -28,6 +29,16 @@ func Execute() {
 }
 
 func init() {
+	addOutputFlag(rootCmd)
 	rootCmd.AddCommand(EncodeCmd())
 	rootCmd.AddCommand(DecodeCmd())
+	rootCmd.AddCommand(CharsetsCmd())
+	rootCmd.AddCommand(BodyCmd())
+	rootCmd.AddCommand(TreeCmd())
+	rootCmd.AddCommand(ExtractCmd())
+	rootCmd.AddCommand(AddrsCmd())
+	rootCmd.AddCommand(GrepCmd())
+	rootCmd.AddCommand(DkimCmd())
+	rootCmd.AddCommand(ArcCmd())
+	rootCmd.AddCommand(HopsCmd())
 }
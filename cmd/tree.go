@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yken2257/gemm/utils"
+)
+
+func TreeCmd() *cobra.Command {
+	var filename string
+	var format string
+	var properties bool
+
+	cmd := &cobra.Command{
+		Use:   "tree",
+		Short: "Show the MIME structure of a message",
+		Long: `Show the MIME structure of a message. Each part is listed with its index path,
+Content-Type, charset, transfer encoding, disposition, filename and decoded
+size:
+	gemm tree -f test.eml
+The index paths can be given to "gemm body --part". An Outlook .msg file is
+shown as the MIME message it converts to, with its bodies and attachments:
+	gemm tree -f mail.msg
+A TNEF part (winmail.dat, application/ms-tnef) from Exchange is expanded into
+its plain text, HTML or RTF body and its attachments under their original
+filenames. --properties also lists the MAPI properties it carries:
+	gemm tree -f winmail.eml --properties
+An mbox, MMDF or Maildir mailbox shows the tree of every message:
+	gemm tree -f archive.mbox --format mboxcl2`,
+		Version: rootCmd.Version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if filename == "" {
+				return fmt.Errorf("please specify a file with -f")
+			}
+			return forEachMessage(filename, format, func(r io.Reader, out *messageOutput) error {
+				root, err := utils.ParseMessage(r)
+				if err != nil {
+					return fmt.Errorf("failed to parse file '%s': %v", filename, err)
+				}
+
+				record := newPartRecord(root)
+				return out.write(record, func() {
+					printTree(record, "", "", properties)
+				})
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&filename, "file", "f", "", "file to read; use - for standard input")
+	cmd.Flags().BoolVar(&properties, "properties", false, "list the MAPI properties of TNEF parts and their attachments")
+	addFormatFlag(cmd, &format)
+	return cmd
+}
+
+// printTree prints a part and its children with box-drawing branches,
+// and with properties, the MAPI properties of the part below it.
+func printTree(record partRecord, prefix, childPrefix string, properties bool) {
+	fmt.Println(prefix + describePart(record))
+	if properties {
+		bar := "  "
+		if len(record.Children) > 0 {
+			bar = "│ "
+		}
+		for _, property := range record.Properties {
+			fmt.Println(childPrefix + bar + describeProperty(property))
+		}
+	}
+	for i, child := range record.Children {
+		if i == len(record.Children)-1 {
+			printTree(child, childPrefix+"└── ", childPrefix+"    ", properties)
+		} else {
+			printTree(child, childPrefix+"├── ", childPrefix+"│   ", properties)
+		}
+	}
+}
+
+var lineBreakEscaper = strings.NewReplacer("\r", `\r`, "\n", `\n`)
+
+// describeProperty formats a MAPI property as "PR_SUBJECT 0x0037001F: value"
+// on a single line.
+func describeProperty(property propertyRecord) string {
+	name := property.Tag
+	if property.Name != "" {
+		name = property.Name + " " + property.Tag
+	}
+	return name + ": " + lineBreakEscaper.Replace(property.Value)
+}
+
+func describePart(record partRecord) string {
+	fields := []string{}
+	if record.Path != "" {
+		fields = append(fields, record.Path)
+	}
+	fields = append(fields, record.ContentType)
+	if record.Charset != "" {
+		fields = append(fields, "charset="+record.Charset)
+	}
+	if record.TransferEncoding != "" {
+		fields = append(fields, record.TransferEncoding)
+	}
+	if record.Disposition != "" {
+		fields = append(fields, record.Disposition)
+	}
+	if record.Filename != "" {
+		fields = append(fields, fmt.Sprintf("filename=%q", record.Filename))
+	}
+	if record.Error != "" {
+		fields = append(fields, "error: "+record.Error)
+	} else {
+		fields = append(fields, fmt.Sprintf("%d bytes", record.Size))
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		expectOutput   string
+		expectError    bool
+		expectedErrMsg string
+	}{
+		{
+			name: "Nested message",
+			args: []string{"tree", "-f", "../test_files/nested.eml"},
+			expectOutput: `multipart/mixed 337 bytes
+├── 1 multipart/alternative 167 bytes
+│   ├── 1.1 text/plain charset=ISO-2022-JP base64 84 bytes
+│   └── 1.2 text/html charset=UTF-8 quoted-printable 83 bytes
+├── 2 application/pdf base64 attachment filename="請求書.pdf" 30 bytes
+├── 3 image/png base64 inline filename="画像.png" 15 bytes
+└── 4 message/rfc822 7bit 125 bytes
+    └── 4.1 text/plain charset=US-ASCII 7bit 30 bytes
+`,
+		},
+		{
+			name: "JSON",
+			args: []string{"tree", "-f", "../test_files/nested.eml", "-o", "json"},
+			expectOutput: `{
+  "path": "",
+  "content_type": "multipart/mixed",
+  "size": 337,
+  "children": [
+    {
+      "path": "1",
+      "content_type": "multipart/alternative",
+      "size": 167,
+      "children": [
+        {
+          "path": "1.1",
+          "content_type": "text/plain",
+          "charset": "ISO-2022-JP",
+          "transfer_encoding": "base64",
+          "size": 84
+        },
+        {
+          "path": "1.2",
+          "content_type": "text/html",
+          "charset": "UTF-8",
+          "transfer_encoding": "quoted-printable",
+          "size": 83
+        }
+      ]
+    },
+    {
+      "path": "2",
+      "content_type": "application/pdf",
+      "transfer_encoding": "base64",
+      "disposition": "attachment",
+      "filename": "請求書.pdf",
+      "size": 30
+    },
+    {
+      "path": "3",
+      "content_type": "image/png",
+      "transfer_encoding": "base64",
+      "disposition": "inline",
+      "filename": "画像.png",
+      "size": 15
+    },
+    {
+      "path": "4",
+      "content_type": "message/rfc822",
+      "transfer_encoding": "7bit",
+      "size": 125,
+      "children": [
+        {
+          "path": "4.1",
+          "content_type": "text/plain",
+          "charset": "US-ASCII",
+          "transfer_encoding": "7bit",
+          "size": 30
+        }
+      ]
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "Outlook message",
+			args: []string{"tree", "-f", "../test_files/sample.msg"},
+			expectOutput: `multipart/mixed 5417 bytes
+├── 1 multipart/alternative 111 bytes
+│   ├── 1.1 text/plain charset=UTF-8 quoted-printable 29 bytes
+│   └── 1.2 text/html charset=Windows-31J quoted-printable 82 bytes
+├── 2 text/plain base64 attachment filename="報告書.txt" 8 bytes
+├── 3 message/rfc822 7bit attachment filename="転送" 298 bytes
+│   └── 3.1 text/plain charset=UTF-8 quoted-printable 12 bytes
+└── 4 application/octet-stream base64 attachment filename="big.bin" 5000 bytes
+`,
+		},
+		{
+			name: "TNEF",
+			args: []string{"tree", "-f", "../test_files/tnef.eml"},
+			expectOutput: `multipart/mixed 1036 bytes
+├── 1 text/plain charset=UTF-8 7bit 19 bytes
+└── 2 application/ms-tnef base64 attachment filename="winmail.dat" 1017 bytes
+    ├── 2.1 text/plain charset=UTF-8 binary 17 bytes
+    ├── 2.2 text/html charset=UTF-8 binary 47 bytes
+    ├── 2.3 text/plain binary attachment filename="報告書.txt" 14 bytes
+    ├── 2.4 application/pdf binary attachment filename="資料.pdf" 15 bytes
+    └── 2.5 application/ms-tnef binary attachment filename="転送" 118 bytes
+        └── 2.5.1 text/plain charset=UTF-8 binary 14 bytes
+`,
+		},
+		{
+			name: "Damaged TNEF",
+			args: []string{"tree", "-f", "../test_files/tnef-damaged.eml"},
+			expectOutput: `multipart/mixed 1036 bytes
+├── 1 text/plain charset=UTF-8 7bit 19 bytes
+└── 2 application/ms-tnef base64 attachment filename="winmail.dat" error: part 2: attribute 9006 has a bad checksum
+`,
+		},
+		{
+			name: "TNEF properties",
+			args: []string{"tree", "-f", "../test_files/tnef.eml", "--properties"},
+			expectOutput: `multipart/mixed 1036 bytes
+├── 1 text/plain charset=UTF-8 7bit 19 bytes
+└── 2 application/ms-tnef base64 attachment filename="winmail.dat" 1017 bytes
+    │ PR_SUBJECT 0x0037001F: 会議資料
+    │ PR_IMPORTANCE 0x00170003: 2
+    │ PR_CLIENT_SUBMIT_TIME 0x00390040: 2023-11-14T22:13:20Z
+    │ PR_RTF_COMPRESSED 0x10090102: 6C010000370100004C5A4675F965A711007B5C727466315C61006E73695C616E... (368 bytes)
+    │ {00062008-0000-0000-C000-000000000046}:0x8554 0x8000001E: 16.0
+    ├── 2.1 text/plain charset=UTF-8 binary 17 bytes
+    ├── 2.2 text/html charset=UTF-8 binary 47 bytes
+    ├── 2.3 text/plain binary attachment filename="報告書.txt" 14 bytes
+    │     PR_ATTACH_LONG_FILENAME 0x3707001F: 報告書.txt
+    │     PR_ATTACH_METHOD 0x37050003: 1
+    ├── 2.4 application/pdf binary attachment filename="資料.pdf" 15 bytes
+    └── 2.5 application/ms-tnef binary attachment filename="転送" 118 bytes
+        │ PR_DISPLAY_NAME 0x3001001F: 転送
+        │ PR_ATTACH_METHOD 0x37050003: 5
+        │ PR_ATTACH_DATA 0x3701000D: 0703020000000000C000000000000046789F3E22341201069008000400000000... (134 bytes)
+        └── 2.5.1 text/plain charset=UTF-8 binary 14 bytes
+`,
+		},
+		{
+			name:           "No file",
+			args:           []string{"tree"},
+			expectError:    true,
+			expectedErrMsg: "please specify a file with -f",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, errorOutput, err := executeCommand(TreeCmd(), tt.args)
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+				assert.Equal(t, "Error: "+tt.expectedErrMsg+"\n", errorOutput)
+			} else {
+				assert.NoError(t, err)
+				assert.Empty(t, errorOutput)
+			}
+			assert.Equal(t, tt.expectOutput, output)
+		})
+	}
+
+	t.Run("TNEF properties JSON", func(t *testing.T) {
+		output, _, err := executeCommand(TreeCmd(), []string{"tree", "-f", "../test_files/tnef.eml", "-o", "json"})
+		assert.NoError(t, err)
+		var record partRecord
+		assert.NoError(t, json.Unmarshal([]byte(output), &record))
+		assert.Equal(t, partRecord{
+			Path:             "2.3",
+			ContentType:      "text/plain",
+			TransferEncoding: "binary",
+			Disposition:      "attachment",
+			Filename:         "報告書.txt",
+			Size:             14,
+			Properties: []propertyRecord{
+				{Tag: "0x3707001F", Name: "PR_ATTACH_LONG_FILENAME", Value: "報告書.txt"},
+				{Tag: "0x37050003", Name: "PR_ATTACH_METHOD", Value: "1"},
+			},
+		}, record.Children[1].Children[2])
+	})
+}
@@ -0,0 +1,183 @@
+#!/usr/bin/env python3
+"""Generates the Outlook .msg fixtures sample.msg and ansi.msg.
+
+Run from this directory: python3 mkmsg.py
+
+Both are compound files (MS-CFB) holding the property streams of MS-OXMSG.
+sample.msg has Unicode strings, a binary HTML body in cp932 and attachments,
+one of them an embedded message and one larger than the mini stream cutoff.
+ansi.msg has the 8 bit strings of a client without Unicode support, in the
+code page 932 given by PR_INTERNET_CPID.
+"""
+import struct
+
+SECTOR = 512
+MINI = 64
+CUTOFF = 4096
+ENDOFCHAIN = 0xFFFFFFFE
+FREESECT = 0xFFFFFFFF
+FATSECT = 0xFFFFFFFD
+NOSTREAM = 0xFFFFFFFF
+
+class Node:
+    def __init__(self, name, data=None, children=None):
+        self.name = name
+        self.data = data
+        self.children = children
+        self.left = self.right = self.child = NOSTREAM
+        self.start = ENDOFCHAIN
+        self.size = 0
+
+def S(name, data): return Node(name, data=data)
+def D(name, *children): return Node(name, children=list(children))
+
+def u16(s): return s.encode('utf-16-le')
+def prop(pid, ptype): return "__substg1.0_%04X%04X" % (pid, ptype)
+def ustr(pid, text): return S(prop(pid, 0x001F), u16(text))
+def astr(pid, text): return S(prop(pid, 0x001E), text.encode('cp932'))
+def binp(pid, data): return S(prop(pid, 0x0102), data)
+
+def props(header_size, entries):
+    b = b'\0' * header_size
+    for ptype, pid, value in entries:
+        b += struct.pack('<HHI', ptype, pid, 6) + value
+    return S("__properties_version1.0", b)
+
+def long(pid, v): return (0x0003, pid, struct.pack('<I', v) + b'\0'*4)
+def systime(pid, unix):
+    ticks = unix * 10000000 + 116444736000000000
+    return (0x0040, pid, struct.pack('<Q', ticks))
+
+def build(root):
+    # flatten
+    entries = [root]
+    def walk(node):
+        if node.children is None:
+            return
+        kids = sorted(node.children, key=lambda n: (len(n.name), n.name.upper()))
+        for k in kids:
+            entries.append(k)
+        def tree(lst):
+            if not lst: return NOSTREAM
+            mid = len(lst)//2
+            n = lst[mid]
+            n.left = tree(lst[:mid])
+            n.right = tree(lst[mid+1:])
+            return entries.index(n)
+        node.child = tree(kids)
+        for k in kids:
+            walk(k)
+    walk(root)
+
+    mini = bytearray(); minifat = []
+    big = []
+    for e in entries:
+        if e.children is not None: continue
+        e.size = len(e.data)
+        if e.size == 0:
+            e.start = ENDOFCHAIN
+        elif e.size < CUTOFF:
+            n = (e.size + MINI - 1)//MINI
+            e.start = len(mini)//MINI
+            for i in range(n):
+                minifat.append(e.start + i + 1 if i < n-1 else ENDOFCHAIN)
+            mini += e.data + b'\0' * (n*MINI - e.size)
+        else:
+            big.append(e)
+
+    def nsec(n): return (n + SECTOR - 1)//SECTOR
+    ndir = nsec(len(entries)*128)
+    nminifat = nsec(len(minifat)*4)
+    nmini = nsec(len(mini))
+    nbig = sum(nsec(e.size) for e in big)
+    nfat = 1
+    while True:
+        total = nfat + ndir + nminifat + nmini + nbig
+        if nfat*128 >= total: break
+        nfat += 1
+    fat = []
+    def chain(n):
+        start = len(fat)
+        for i in range(n):
+            fat.append(start + i + 1 if i < n-1 else ENDOFCHAIN)
+        return start if n else ENDOFCHAIN
+    for i in range(nfat): fat.append(FATSECT)
+    dirstart = chain(ndir)
+    minifatstart = chain(nminifat)
+    ministart = chain(nmini)
+    root.start = ministart; root.size = len(mini)
+    for e in big:
+        e.start = chain(nsec(e.size))
+    while len(fat) % 128: fat.append(FREESECT)
+
+    header = bytearray(512)
+    header[0:8] = bytes([0xD0,0xCF,0x11,0xE0,0xA1,0xB1,0x1A,0xE1])
+    struct.pack_into('<HHHHH', header, 0x18, 0x3E, 3, 0xFFFE, 9, 6)
+    struct.pack_into('<IIIIIIIII', header, 0x28, 0, nfat, dirstart, 0, CUTOFF, minifatstart if nminifat else ENDOFCHAIN, nminifat, ENDOFCHAIN, 0)
+    for i in range(109):
+        struct.pack_into('<I', header, 0x4C + 4*i, i if i < nfat else FREESECT)
+
+    out = bytearray(header)
+    out += b''.join(struct.pack('<I', x) for x in fat)
+    d = bytearray()
+    for e in entries:
+        b = bytearray(128)
+        name = u16(e.name)
+        b[0:len(name)] = name
+        struct.pack_into('<H', b, 64, len(name) + 2)
+        b[66] = 5 if e is root else (1 if e.children is not None else 2)
+        b[67] = 1
+        struct.pack_into('<III', b, 68, e.left, e.right, e.child)
+        struct.pack_into('<IQ', b, 116, e.start, e.size)
+        d += b
+    while len(d) % SECTOR:
+        b = bytearray(128)
+        struct.pack_into('<III', b, 68, NOSTREAM, NOSTREAM, NOSTREAM)
+        d += b
+    out += d
+    mf = b''.join(struct.pack('<I', x) for x in minifat)
+    out += mf + b'\xff' * (nminifat*SECTOR - len(mf))
+    out += mini + b'\0' * (nmini*SECTOR - len(mini))
+    for e in big:
+        out += e.data + b'\0' * (nsec(e.size)*SECTOR - e.size)
+    return bytes(out)
+
+html = '<html><head><meta charset="shift_jis"></head><body><p>本文です。</p></body></html>'.encode('cp932')
+bigdata = bytes((i * 7) % 256 for i in range(5000))
+
+embedded = D(prop(0x3701, 0x000D),
+    props(24, []),
+    ustr(0x007D, "Received: from mx.example.com\r\n\tby mail.example.jp; Mon, 1 Jan 2024 09:00:00 +0900\r\nFrom: Sato <sato@example.com>\r\nSubject: =?UTF-8?B?6L2i6YCB?=\r\nMessage-ID: <inner@example.com>\r\nContent-Type: text/plain;\r\n\tcharset=\"utf-8\"\r\nMIME-Version: 1.0\r\n\r\n"),
+    ustr(0x0037, "転送"),
+    ustr(0x1000, "inner body\r\n"),
+)
+
+root = D("Root Entry",
+    props(32, [systime(0x0039, 1704067200), long(0x3FDE, 932)]),
+    ustr(0x0037, "会議のお知らせ"),
+    ustr(0x0042, "山田 太郎"),
+    ustr(0x5D02, "taro@example.jp"),
+    ustr(0x1035, "<msg1@example.jp>"),
+    ustr(0x1000, "本文です。\r\nFrom here.\r\n"),
+    binp(0x1013, html),
+    D("__recip_version1.0_#00000000", props(8, [long(0x0C15, 1)]), ustr(0x3001, "Hanako"), ustr(0x39FE, "hanako@example.com")),
+    D("__recip_version1.0_#00000001", props(8, [long(0x0C15, 2)]), ustr(0x3001, "Doe, John"), ustr(0x39FE, "john@example.com")),
+    D("__attach_version1.0_#00000000", props(8, []), ustr(0x3707, "報告書.txt"), ustr(0x370E, "text/plain"), binp(0x3701, b"report\r\n")),
+    D("__attach_version1.0_#00000001", props(8, []), ustr(0x3001, "転送"), embedded),
+    D("__attach_version1.0_#00000002", props(8, []), ustr(0x3704, "big.bin"), binp(0x3701, bigdata)),
+)
+
+open("sample.msg", "wb").write(build(root))
+
+ansi = D("Root Entry",
+    props(32, [systime(0x0039, 1704067200), long(0x3FDE, 932)]),
+    astr(0x0037, "見積もりの件"),
+    astr(0x0042, "山田 太郎"),
+    astr(0x5D02, "taro@example.jp"),
+    astr(0x1000, "お見積もりを送ります。\r\n"),
+    astr(0x1013, "<html><body><p>お見積もり</p></body></html>"),
+    D("__recip_version1.0_#00000000", props(8, [long(0x0C15, 1)]), astr(0x3001, "花子"), astr(0x39FE, "hanako@example.com")),
+    D("__attach_version1.0_#00000000", props(8, []), astr(0x3707, "見積書.txt"), binp(0x3701, b"estimate\r\n")),
+)
+
+open("ansi.msg", "wb").write(build(ansi))
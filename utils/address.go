@@ -0,0 +1,377 @@
+package utils
+
+import (
+	"fmt"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+)
+
+// addressHeaders are the RFC 5322 header fields that hold address lists.
+var addressHeaders = map[string]bool{
+	"From":          true,
+	"Sender":        true,
+	"Reply-To":      true,
+	"To":            true,
+	"Cc":            true,
+	"Bcc":           true,
+	"Resent-From":   true,
+	"Resent-Sender": true,
+	"Resent-To":     true,
+	"Resent-Cc":     true,
+	"Resent-Bcc":    true,
+}
+
+// IsAddressHeader reports whether the header field name holds addresses.
+func IsAddressHeader(name string) bool {
+	return addressHeaders[textproto.CanonicalMIMEHeaderKey(name)]
+}
+
+type tokenKind int
+
+const (
+	atomToken    tokenKind = iota // an atom, dot-atom or domain literal
+	quotedToken                   // a quoted-string, text unquoted
+	commentToken                  // a comment, text without the outer parentheses
+	angleToken                    // an angle-addr, text without the brackets
+	specialToken                  // one of , : ; @ .
+	spaceToken
+)
+
+type addressToken struct {
+	kind tokenKind
+	text string
+}
+
+// addressSpecials are the RFC 5322 specials that end an atom.
+const addressSpecials = `()<>[]:;@\,."`
+
+// tokenizeAddresses splits an address header value into tokens. Quoted
+// strings, comments and angle-addrs are single tokens.
+func tokenizeAddresses(s string) ([]addressToken, error) {
+	var tokens []addressToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case isLinearWhiteSpace(c):
+			j := i
+			for j < len(s) && isLinearWhiteSpace(s[j]) {
+				j++
+			}
+			tokens = append(tokens, addressToken{spaceToken, s[i:j]})
+			i = j
+		case c == '"':
+			text, n, err := readDelimited(s[i:], '"', false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, addressToken{quotedToken, text})
+			i += n
+		case c == '(':
+			text, n, err := readDelimited(s[i:], ')', true)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, addressToken{commentToken, text})
+			i += n
+		case c == '<':
+			j := strings.IndexByte(s[i:], '>')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated angle-addr at offset %d", i)
+			}
+			tokens = append(tokens, addressToken{angleToken, s[i+1 : i+j]})
+			i += j + 1
+		case c == '[':
+			j := strings.IndexByte(s[i:], ']')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated domain literal at offset %d", i)
+			}
+			tokens = append(tokens, addressToken{atomToken, s[i : i+j+1]})
+			i += j + 1
+		case strings.IndexByte(",:;@.", c) >= 0:
+			tokens = append(tokens, addressToken{specialToken, string(c)})
+			i++
+		case strings.IndexByte(addressSpecials, c) >= 0:
+			return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+		default:
+			j := i
+			for j < len(s) && !isLinearWhiteSpace(s[j]) && strings.IndexByte(addressSpecials, s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, addressToken{atomToken, s[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// readDelimited reads the quoted-string or comment at the start of s up to
+// close and returns its text with quoted-pairs resolved and the number of
+// bytes read. Nested comments keep their parentheses.
+func readDelimited(s string, close byte, nested bool) (string, int, error) {
+	var b strings.Builder
+	depth := 1
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+			continue
+		case c == close:
+			depth--
+			if depth == 0 {
+				return b.String(), i + 1, nil
+			}
+		case nested && c == s[0]:
+			depth++
+		}
+		b.WriteByte(c)
+	}
+	return "", 0, fmt.Errorf("unterminated %c", s[0])
+}
+
+// EncodeAddressList encodes an address list such as the value of From or To
+// following RFC 2047 section 5: only display names and comments that need
+// it become encoded-words, addresses and ASCII words are left alone, and
+// display names with specials are quoted.
+func EncodeAddressList(s, charset, encoding string) (string, error) {
+	words, err := encodeAddressWords(s, charset, encoding, maxEncodedWordLength)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(words, " "), nil
+}
+
+// encodeAddressWords returns the words of the encoded address list for
+// FoldHeader. An encoded-word that starts the list is kept within first
+// characters when possible.
+func encodeAddressWords(s, charset, encoding string, first int) ([]string, error) {
+	if _, _, err := LookupCharset(charset); err != nil {
+		return nil, err
+	}
+	tokens, err := tokenizeAddresses(s)
+	if err != nil {
+		return nil, err
+	}
+	e := &addressEncoder{charset: charset, encoding: encoding, first: first}
+	var pending []addressToken
+	for _, token := range tokens {
+		switch {
+		case token.kind == angleToken:
+			if err := e.phrase(pending); err != nil {
+				return nil, err
+			}
+			pending = nil
+			e.add("<" + token.text + ">")
+		case token.kind == specialToken && token.text == ":":
+			if err := e.phrase(pending); err != nil {
+				return nil, err
+			}
+			pending = nil
+			e.attach(":")
+		case token.kind == specialToken && (token.text == "," || token.text == ";"):
+			if err := e.addrSpec(pending); err != nil {
+				return nil, err
+			}
+			pending = nil
+			e.attach(token.text)
+		default:
+			pending = append(pending, token)
+		}
+	}
+	if err := e.addrSpec(pending); err != nil {
+		return nil, err
+	}
+	return e.words, nil
+}
+
+type addressEncoder struct {
+	charset  string
+	encoding string
+	first    int
+	words    []string
+}
+
+func (e *addressEncoder) add(words ...string) {
+	e.words = append(e.words, words...)
+}
+
+// attach appends a separator to the previous word.
+func (e *addressEncoder) attach(separator string) {
+	if len(e.words) == 0 {
+		e.words = append(e.words, separator)
+		return
+	}
+	e.words[len(e.words)-1] += separator
+}
+
+// encode turns text into encoded-words for a phrase or comment.
+func (e *addressEncoder) encode(text string) ([]string, error) {
+	limit := maxEncodedWordLength
+	if len(e.words) == 0 {
+		limit = e.first
+	}
+	return encodeWords(text, e.charset, e.encoding, limit, true)
+}
+
+// comment encodes a comment if its text needs it.
+func (e *addressEncoder) comment(text string) error {
+	if !needsEncoding(text) {
+		e.add("(" + quoteComment(text) + ")")
+		return nil
+	}
+	words, err := e.encode(text)
+	if err != nil {
+		return err
+	}
+	words[0] = "(" + words[0]
+	words[len(words)-1] += ")"
+	e.add(words...)
+	return nil
+}
+
+// phrase encodes a display name. Runs of words that need encoding become
+// encoded-words together, so that the spaces between them survive, and the
+// other runs are written as atoms or, if they hold specials, quoted.
+func (e *addressEncoder) phrase(tokens []addressToken) error {
+	var run []string
+	quoted := false
+	encoded := false
+	flush := func() error {
+		if len(run) == 0 {
+			return nil
+		}
+		text, wasQuoted := strings.Join(run, " "), quoted
+		run, quoted = nil, false
+		if encoded {
+			words, err := e.encode(text)
+			if err != nil {
+				return err
+			}
+			e.add(words...)
+			return nil
+		}
+		if strings.ContainsAny(text, addressSpecials) || wasQuoted {
+			e.add(quotePhrase(text))
+			return nil
+		}
+		e.add(strings.Fields(text)...)
+		return nil
+	}
+
+	// words are joined across specials such as "." so that "Q." stays one word
+	var word strings.Builder
+	wordQuoted := false
+	endWord := func() error {
+		if word.Len() == 0 {
+			return nil
+		}
+		text := word.String()
+		word.Reset()
+		needs := needsEncoding(text)
+		if len(run) > 0 && needs != encoded {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		encoded = needs
+		quoted = quoted || wordQuoted
+		wordQuoted = false
+		run = append(run, text)
+		return nil
+	}
+	for _, token := range tokens {
+		switch token.kind {
+		case spaceToken:
+			if err := endWord(); err != nil {
+				return err
+			}
+		case commentToken:
+			if err := endWord(); err != nil {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := e.comment(token.text); err != nil {
+				return err
+			}
+		case quotedToken:
+			word.WriteString(token.text)
+			wordQuoted = true
+		default:
+			word.WriteString(token.text)
+		}
+	}
+	if err := endWord(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// addrSpec writes an address without angle brackets. Only its comments may
+// be encoded; RFC 2047 does not apply to the address itself.
+func (e *addressEncoder) addrSpec(tokens []addressToken) error {
+	var spec strings.Builder
+	endSpec := func() {
+		if spec.Len() > 0 {
+			e.add(spec.String())
+			spec.Reset()
+		}
+	}
+	for _, token := range tokens {
+		switch token.kind {
+		case spaceToken:
+		case commentToken:
+			endSpec()
+			if err := e.comment(token.text); err != nil {
+				return err
+			}
+		case quotedToken:
+			spec.WriteString(quotePhrase(token.text))
+		default:
+			spec.WriteString(token.text)
+		}
+	}
+	if address := spec.String(); !isASCII(address) {
+		return fmt.Errorf("cannot encode the address %q; RFC 2047 does not apply to addresses", address)
+	}
+	endSpec()
+	return nil
+}
+
+// quotePhrase returns text as a quoted-string.
+func quotePhrase(text string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(text); i++ {
+		if text[i] == '"' || text[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(text[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// quoteComment escapes the characters that would end a comment early.
+func quoteComment(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '(' || text[i] == ')' || text[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeAddressList(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Display name with an ASCII part",
+			input:    "John Doe （ジョン） <john@example.com>",
+			expected: "John Doe =?UTF-8?q?=EF=BC=88=E3=82=B8=E3=83=A7=E3=83=B3=EF=BC=89?= <john@example.com>",
+		},
+		{
+			name:     "Adjacent words are encoded together",
+			input:    "山田 太郎 <taro@example.jp>, jane@example.com",
+			expected: "=?UTF-8?q?=E5=B1=B1=E7=94=B0_=E5=A4=AA=E9=83=8E?= <taro@example.jp>, jane@example.com",
+		},
+		{
+			name:     "Specials are quoted",
+			input:    "John Q. Public <jqp@example.com>",
+			expected: `"John Q. Public" <jqp@example.com>`,
+		},
+		{
+			name:     "Quoted display name needing encoding",
+			input:    `"山田, 太郎" <t@example.jp>`,
+			expected: "=?UTF-8?q?=E5=B1=B1=E7=94=B0=2C_=E5=A4=AA=E9=83=8E?= <t@example.jp>",
+		},
+		{
+			name:     "Comment",
+			input:    "taro@example.jp (山田 太郎)",
+			expected: "taro@example.jp (=?UTF-8?q?=E5=B1=B1=E7=94=B0_=E5=A4=AA=E9=83=8E?=)",
+		},
+		{
+			name:     "Group",
+			input:    "チーム: a@example.com, 鈴木 <b@example.com>;",
+			expected: "=?UTF-8?q?=E3=83=81=E3=83=BC=E3=83=A0?=: a@example.com, =?UTF-8?q?=E9=88=B4=E6=9C=A8?= <b@example.com>;",
+		},
+		{
+			name:     "Empty group",
+			input:    "undisclosed-recipients:;",
+			expected: "undisclosed-recipients:;",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded, err := EncodeAddressList(tc.input, "UTF-8", "Q")
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			if encoded != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, encoded)
+			}
+		})
+	}
+
+	for _, input := range []string{"山田@example.jp", "John <john@example.com", `"unterminated <a@example.com>`} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := EncodeAddressList(input, "UTF-8", "B"); err == nil {
+				t.Fatalf("expected %s to be rejected", input)
+			}
+		})
+	}
+}
+
+func TestEncodeHeaderFieldAddresses(t *testing.T) {
+	input := "山田 太郎 <taro@example.jp>, 鈴木 花子 <hanako@example.jp>, 佐藤 次郎 <jiro@example.jp>"
+	field, err := EncodeHeaderField("To", input, "ISO-2022-JP", "B")
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	for _, line := range strings.Split(field, "\r\n") {
+		if len(line) > maxLineLength {
+			t.Fatalf("line longer than %d characters: %s", maxLineLength, line)
+		}
+	}
+	for _, address := range []string{"<taro@example.jp>,", "<hanako@example.jp>,", "<jiro@example.jp>"} {
+		if !strings.Contains(field, address) {
+			t.Fatalf("expected %s to be left alone in %s", address, field)
+		}
+	}
+	decoded, err := DecodeField(field)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if decoded != input {
+		t.Fatalf("expected round trip to give %s, got %s", input, decoded)
+	}
+}
@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Address is one mailbox of an address list. Group is the display name of
+// the group the mailbox belongs to, if any; a group without members is
+// returned as an Address with only Group set so that it is not lost.
+// LocalPart is unquoted, Domain is as written and UnicodeDomain has its IDN
+// labels converted to Unicode.
+type Address struct {
+	Group         string
+	Name          string
+	LocalPart     string
+	Domain        string
+	UnicodeDomain string
+}
+
+// AddrSpec returns the address as local-part@domain, quoting the local part
+// when it is not a dot-atom.
+func (a Address) AddrSpec() string {
+	if a.LocalPart == "" && a.Domain == "" {
+		return ""
+	}
+	local := a.LocalPart
+	if !isDotAtom(local) {
+		local = quotePhrase(local)
+	}
+	return local + "@" + a.Domain
+}
+
+// ParseAddressList parses the value of an address header such as From or To.
+// Besides RFC 5322 it accepts the obsolete syntax of section 4.4: routes in
+// angle-addrs, whitespace and comments around the dots of an address, empty
+// list elements and periods in display names. Encoded-words in display names
+// are decoded, and a comment after a bare address is used as its display
+// name, as old mailers wrote "user@example.com (Name)".
+func ParseAddressList(s string) ([]Address, error) {
+	tokens, err := tokenizeAddresses(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []Address
+	var pending []addressToken
+	var current *Address // a mailbox with an angle-addr, waiting for its separator
+	group, inGroup, members := "", false, 0
+
+	finish := func() error {
+		if current != nil {
+			addresses = append(addresses, *current)
+			current, pending = nil, nil
+			members++
+			return nil
+		}
+		if !hasWords(pending) {
+			// an empty list element is obsolete but harmless
+			pending = nil
+			return nil
+		}
+		address, err := parseAddrSpec(pending)
+		if err != nil {
+			return err
+		}
+		address.Group = group
+		if address.Name == "" {
+			address.Name = commentName(pending)
+		}
+		addresses = append(addresses, address)
+		pending = nil
+		members++
+		return nil
+	}
+
+	for _, token := range tokens {
+		switch {
+		case current != nil && token.kind != commentToken && token.kind != spaceToken &&
+			!(token.kind == specialToken && (token.text == "," || token.text == ";")):
+			return nil, fmt.Errorf("unexpected %q after <%s>", token.text, current.AddrSpec())
+		case token.kind == angleToken:
+			inner, err := tokenizeAddresses(token.text)
+			if err != nil {
+				return nil, err
+			}
+			address, err := parseAddrSpec(stripRoute(inner))
+			if err != nil {
+				return nil, err
+			}
+			address.Group = group
+			address.Name = decodePhrase(pending)
+			pending = nil
+			current = &address
+		case token.kind == specialToken && token.text == ":":
+			if inGroup {
+				return nil, fmt.Errorf("nested group in %q", s)
+			}
+			group, inGroup, members = decodePhrase(pending), true, 0
+			if group == "" {
+				return nil, fmt.Errorf("group without a display name in %q", s)
+			}
+			pending = nil
+		case token.kind == specialToken && token.text == ",":
+			if err := finish(); err != nil {
+				return nil, err
+			}
+		case token.kind == specialToken && token.text == ";":
+			if !inGroup {
+				return nil, fmt.Errorf("unexpected \";\" outside a group in %q", s)
+			}
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			if members == 0 {
+				addresses = append(addresses, Address{Group: group})
+			}
+			group, inGroup = "", false
+		default:
+			pending = append(pending, token)
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	if inGroup && members == 0 {
+		// a group missing its ";" is kept rather than rejected
+		addresses = append(addresses, Address{Group: group})
+	}
+	return addresses, nil
+}
+
+// parseAddrSpec reads local-part@domain from tokens, skipping whitespace and
+// comments as the obsolete syntax allows.
+func parseAddrSpec(tokens []addressToken) (Address, error) {
+	var local, domain strings.Builder
+	seenAt := false
+	for _, token := range tokens {
+		switch {
+		case token.kind == spaceToken || token.kind == commentToken:
+			continue
+		case token.kind == specialToken && token.text == "@":
+			if seenAt {
+				return Address{}, fmt.Errorf("more than one @ in address")
+			}
+			seenAt = true
+			continue
+		case token.kind == specialToken && token.text != ".":
+			return Address{}, fmt.Errorf("unexpected %q in address", token.text)
+		case token.kind == angleToken:
+			return Address{}, fmt.Errorf("unexpected <%s> in address", token.text)
+		}
+		if seenAt {
+			domain.WriteString(token.text)
+		} else {
+			local.WriteString(token.text)
+		}
+	}
+	address := Address{LocalPart: local.String(), Domain: domain.String()}
+	if !seenAt {
+		return Address{}, fmt.Errorf("missing @ in address %q", address.LocalPart)
+	}
+	if address.LocalPart == "" || address.Domain == "" {
+		return Address{}, fmt.Errorf("incomplete address %q", address.LocalPart+"@"+address.Domain)
+	}
+	unicode, err := DomainToUnicode(address.Domain)
+	if err != nil {
+		return Address{}, err
+	}
+	address.UnicodeDomain = unicode
+	return address, nil
+}
+
+// stripRoute drops an obsolete source route such as "@relay.example:" from
+// the tokens of an angle-addr.
+func stripRoute(tokens []addressToken) []addressToken {
+	for i, token := range tokens {
+		if token.kind == specialToken && token.text == ":" {
+			return tokens[i+1:]
+		}
+	}
+	return tokens
+}
+
+// decodePhrase returns the display name held by tokens with encoded-words
+// decoded. Encoded-words inside quoted-strings are decoded as well, since
+// many mailers send them.
+func decodePhrase(tokens []addressToken) string {
+	var b strings.Builder
+	space := false
+	for _, token := range tokens {
+		switch token.kind {
+		case spaceToken, commentToken:
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteString(token.text)
+	}
+	return DecodeValue(b.String())
+}
+
+// commentName returns the decoded text of the last comment in tokens.
+func commentName(tokens []addressToken) string {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if tokens[i].kind == commentToken {
+			return DecodeValue(strings.TrimSpace(tokens[i].text))
+		}
+	}
+	return ""
+}
+
+func hasWords(tokens []addressToken) bool {
+	for _, token := range tokens {
+		if token.kind != spaceToken && token.kind != commentToken {
+			return true
+		}
+	}
+	return false
+}
+
+// isDotAtom reports whether s is a dot-atom that needs no quoting.
+func isDotAtom(s string) bool {
+	if s == "" || s[0] == '.' || s[len(s)-1] == '.' || strings.Contains(s, "..") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] <= ' ' || s[i] == 0x7f || (s[i] != '.' && strings.IndexByte(addressSpecials, s[i]) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// DomainToUnicode converts the A-labels ("xn--...") of an internationalized
+// domain name to Unicode and leaves the other labels as they are.
+func DomainToUnicode(domain string) (string, error) {
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if len(label) < 4 || !strings.EqualFold(label[:4], "xn--") {
+			continue
+		}
+		// domains are case-insensitive; lowercase keeps the basic code points tidy
+		decoded, err := idna.Punycode.ToUnicode(strings.ToLower(label))
+		if err != nil {
+			return domain, fmt.Errorf("invalid IDN label %q: %v", label, err)
+		}
+		labels[i] = decoded
+	}
+	return strings.Join(labels, "."), nil
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAddressList(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []Address
+	}{
+		{
+			name:  "Encoded display names",
+			input: "=?ISO-2022-JP?B?GyRCOzNFRBsoQg==?= =?UTF-8?B?5aSq6YOO?= <taro@example.jp>, jane@example.com",
+			expected: []Address{
+				{Name: "山田太郎", LocalPart: "taro", Domain: "example.jp", UnicodeDomain: "example.jp"},
+				{LocalPart: "jane", Domain: "example.com", UnicodeDomain: "example.com"},
+			},
+		},
+		{
+			name:  "Quoted display name and local part",
+			input: `"Doe, John" <john@example.com>, "john doe"@example.com`,
+			expected: []Address{
+				{Name: "Doe, John", LocalPart: "john", Domain: "example.com", UnicodeDomain: "example.com"},
+				{LocalPart: "john doe", Domain: "example.com", UnicodeDomain: "example.com"},
+			},
+		},
+		{
+			name:  "Groups",
+			input: "undisclosed-recipients:;, Team: a@example.com, B <b@example.com>;",
+			expected: []Address{
+				{Group: "undisclosed-recipients"},
+				{Group: "Team", LocalPart: "a", Domain: "example.com", UnicodeDomain: "example.com"},
+				{Group: "Team", Name: "B", LocalPart: "b", Domain: "example.com", UnicodeDomain: "example.com"},
+			},
+		},
+		{
+			name:  "Obsolete syntax",
+			input: "John Q. Public <@relay.example,@mx.example:jqp@example.com>, , john . doe @ example . com (John Doe)",
+			expected: []Address{
+				{Name: "John Q. Public", LocalPart: "jqp", Domain: "example.com", UnicodeDomain: "example.com"},
+				{Name: "John Doe", LocalPart: "john.doe", Domain: "example.com", UnicodeDomain: "example.com"},
+			},
+		},
+		{
+			name:  "Internationalized domain",
+			input: "=?UTF-8?Q?=E4=BE=8B?= <info@xn--r8jz45g.xn--zckzah>",
+			expected: []Address{
+				{Name: "例", LocalPart: "info", Domain: "xn--r8jz45g.xn--zckzah", UnicodeDomain: "例え.テスト"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addresses, err := ParseAddressList(tc.input)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !reflect.DeepEqual(addresses, tc.expected) {
+				t.Fatalf("expected %+v, got %+v", tc.expected, addresses)
+			}
+		})
+	}
+
+	for _, input := range []string{"john", "John <john@example.com> extra", "a@b@c", "<john@example.com", "x@example.com;"} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := ParseAddressList(input); err == nil {
+				t.Fatalf("expected %s to be rejected", input)
+			}
+		})
+	}
+}
+
+func TestAddrSpec(t *testing.T) {
+	testCases := []struct {
+		address  Address
+		expected string
+	}{
+		{Address{LocalPart: "john.doe", Domain: "example.com"}, "john.doe@example.com"},
+		{Address{LocalPart: "john doe", Domain: "example.com"}, `"john doe"@example.com`},
+		{Address{Group: "undisclosed-recipients"}, ""},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.address.AddrSpec(); got != tc.expected {
+			t.Fatalf("expected %s, got %s", tc.expected, got)
+		}
+	}
+}
+
+func TestDomainToUnicode(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "example.com", expected: "example.com"},
+		{input: "xn--r8jz45g.xn--zckzah", expected: "例え.テスト"},
+		{input: "XN--BCHER-KVA.example", expected: "bücher.example"},
+		{input: "mail.xn--wgv71a119e.jp", expected: "mail.日本語.jp"},
+		{input: "xn--mnchen-3ya.de", expected: "münchen.de"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := DomainToUnicode(tc.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+
+	for _, input := range []string{"xn--a$b.com", "xn--99999999999.com"} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := DomainToUnicode(input); err == nil {
+				t.Fatalf("expected %s to be rejected", input)
+			}
+		})
+	}
+}
@@ -0,0 +1,441 @@
+package utils
+
+import (
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ARC chain validation states, the cv= values of RFC 8617.
+const (
+	ARCNone = "none"
+	ARCPass = "pass"
+	ARCFail = "fail"
+)
+
+// maxARCInstances is the highest instance number allowed by RFC 8617.
+const maxARCInstances = 50
+
+// arcSignedHeaders are the fields an ARC-Message-Signature signs when no
+// list is given, of which those present in the message are used.
+var arcSignedHeaders = append(append([]string{}, DefaultSignedHeaders...), "dkim-signature")
+
+// ARCSeal is a parsed ARC-Seal field.
+type ARCSeal struct {
+	Instance        int
+	Algorithm       string
+	Signature       []byte
+	Domain          string
+	Selector        string
+	ChainValidation string
+	Timestamp       time.Time
+	Tags            map[string]string
+}
+
+// ParseARCSeal parses the value of an ARC-Seal field.
+func ParseARCSeal(value string) (*ARCSeal, error) {
+	tags, err := parseTagList(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range []string{"i", "a", "b", "cv", "d", "s"} {
+		if _, ok := tags[tag]; !ok {
+			return nil, fmt.Errorf("missing tag %s=", tag)
+		}
+	}
+	if _, ok := tags["h"]; ok {
+		return nil, fmt.Errorf("h= is not allowed in an ARC-Seal")
+	}
+	seal := &ARCSeal{
+		Algorithm:       strings.ToLower(tags["a"]),
+		Domain:          strings.ToLower(strings.TrimSuffix(tags["d"], ".")),
+		Selector:        tags["s"],
+		ChainValidation: strings.ToLower(tags["cv"]),
+		Tags:            tags,
+	}
+	if seal.Instance, err = parseARCInstance(tags["i"]); err != nil {
+		return nil, err
+	}
+	switch seal.ChainValidation {
+	case ARCNone, ARCPass, ARCFail:
+	default:
+		return nil, fmt.Errorf("unknown chain validation cv=%s", tags["cv"])
+	}
+	if seal.Signature, err = base64.StdEncoding.DecodeString(removeFWS(tags["b"])); err != nil {
+		return nil, fmt.Errorf("invalid b=: %v", err)
+	}
+	if seal.Timestamp, err = parseDKIMTime(tags, "t"); err != nil {
+		return nil, err
+	}
+	return seal, nil
+}
+
+// ParseARCMessageSignature parses the value of an ARC-Message-Signature
+// field, which has the tags of a DKIM-Signature except v=, and i= for the
+// instance.
+func ParseARCMessageSignature(value string) (int, *DKIMSignature, error) {
+	tags, err := parseTagList(value)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, ok := tags["i"]; !ok {
+		return 0, nil, fmt.Errorf("missing tag i=")
+	}
+	instance, err := parseARCInstance(tags["i"])
+	if err != nil {
+		return 0, nil, err
+	}
+	dkimTags := map[string]string{"v": "1"}
+	for tag, value := range tags {
+		if tag != "i" && tag != "v" {
+			dkimTags[tag] = value
+		}
+	}
+	sig, err := newDKIMSignature(dkimTags)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, name := range sig.Headers {
+		if strings.EqualFold(name, "ARC-Seal") {
+			return 0, nil, fmt.Errorf("h= includes ARC-Seal")
+		}
+	}
+	sig.Version, sig.Identity, sig.Tags = "", "", tags
+	return instance, sig, nil
+}
+
+// parseARCInstance parses an i= value, which is from 1 to 50.
+func parseARCInstance(s string) (int, error) {
+	i, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || i < 1 || i > maxARCInstances {
+		return 0, fmt.Errorf("invalid instance i=%s", strings.TrimSpace(s))
+	}
+	return i, nil
+}
+
+// parseARCResults splits the value of an ARC-Authentication-Results field,
+// "i=1; authserv-id; results", into its parts.
+func parseARCResults(value string) (instance int, authServID, results string, err error) {
+	value = strings.TrimSpace(string(collapseWSP([]byte(strings.ReplaceAll(value, "\r\n", "")))))
+	tag, rest, _ := strings.Cut(value, ";")
+	name, i, found := strings.Cut(tag, "=")
+	if !found || strings.TrimSpace(name) != "i" {
+		return 0, "", "", fmt.Errorf("missing tag i=")
+	}
+	if instance, err = parseARCInstance(i); err != nil {
+		return 0, "", "", err
+	}
+	authServID, results, _ = strings.Cut(rest, ";")
+	return instance, strings.TrimSpace(authServID), strings.TrimSpace(results), nil
+}
+
+// arcSet is the three fields of one ARC instance.
+type arcSet struct {
+	results, signature, seal rawField
+}
+
+// arcFieldNames are the fields of an ARC set, in the order they are sealed.
+var arcFieldNames = []string{"ARC-Authentication-Results", "ARC-Message-Signature", "ARC-Seal"}
+
+// collectARCSets groups the ARC fields of a message by instance. Every
+// instance from 1 up must have exactly one of each field.
+func collectARCSets(fields []rawField) ([]arcSet, error) {
+	byInstance := map[int]*arcSet{}
+	for _, field := range fields {
+		var instance int
+		var err error
+		var slot func(*arcSet) *rawField
+		switch {
+		case strings.EqualFold(field.Name, "ARC-Authentication-Results"):
+			instance, _, _, err = parseARCResults(field.Value())
+			slot = func(s *arcSet) *rawField { return &s.results }
+		case strings.EqualFold(field.Name, "ARC-Message-Signature"):
+			instance, err = fieldInstance(field)
+			slot = func(s *arcSet) *rawField { return &s.signature }
+		case strings.EqualFold(field.Name, "ARC-Seal"):
+			instance, err = fieldInstance(field)
+			slot = func(s *arcSet) *rawField { return &s.seal }
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", field.Name, err)
+		}
+		set := byInstance[instance]
+		if set == nil {
+			set = &arcSet{}
+			byInstance[instance] = set
+		}
+		if slot(set).Raw != "" {
+			return nil, fmt.Errorf("more than one %s with i=%d", field.Name, instance)
+		}
+		*slot(set) = field
+	}
+
+	sets := make([]arcSet, len(byInstance))
+	for i := range sets {
+		set, ok := byInstance[i+1]
+		if !ok {
+			return nil, fmt.Errorf("ARC set i=%d is missing", i+1)
+		}
+		for j, field := range []rawField{set.results, set.signature, set.seal} {
+			if field.Raw == "" {
+				return nil, fmt.Errorf("ARC set i=%d has no %s", i+1, arcFieldNames[j])
+			}
+		}
+		sets[i] = *set
+	}
+	return sets, nil
+}
+
+// fieldInstance returns the i= value of an ARC-Message-Signature or
+// ARC-Seal field.
+func fieldInstance(field rawField) (int, error) {
+	tags, err := parseTagList(field.Value())
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := tags["i"]; !ok {
+		return 0, fmt.Errorf("missing tag i=")
+	}
+	return parseARCInstance(tags["i"])
+}
+
+// sealHash hashes what the ARC-Seal of the last set signs: the fields of
+// every set in order, or only those of the last if it has cv=fail, with
+// relaxed canonicalization.
+func sealHash(sets []arcSet, cv string, hash crypto.Hash) []byte {
+	if cv == ARCFail {
+		sets = sets[len(sets)-1:]
+	}
+	var fields []rawField
+	for i, set := range sets {
+		fields = append(fields, set.results, set.signature)
+		if i < len(sets)-1 {
+			fields = append(fields, set.seal)
+		}
+	}
+	return hashFields(fields, sets[len(sets)-1].seal, CanonRelaxed, hash)
+}
+
+// ARCSetResult describes one ARC set of a message.
+type ARCSetResult struct {
+	Instance   int
+	AuthServID string
+	Results    string
+	// Seal is nil when the ARC-Seal could not be parsed.
+	Seal *ARCSeal
+	// MessageSignature is the result of verifying the ARC-Message-Signature.
+	MessageSignature DKIMResult
+	SealStatus       string
+	SealErr          error
+}
+
+// ARCResult is the result of validating the ARC chain of a message.
+type ARCResult struct {
+	// Status is none without ARC sets, and otherwise pass or fail with the
+	// reason in Err.
+	Status string
+	Err    error
+	// OldestPass is the oldest instance from which every
+	// ARC-Message-Signature verifies, or 0 if all of them do. It only
+	// means something for a chain that passes.
+	OldestPass int
+	Sets       []ARCSetResult
+}
+
+// ValidateARC validates the ARC chain of a message as in RFC 8617 section
+// 5.2, looking keys up with resolver. An error is returned only if the
+// message cannot be read.
+func ValidateARC(message []byte, resolver TXTResolver) (*ARCResult, error) {
+	fields, body, err := splitMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	result, _ := validateARC(fields, body, resolver)
+	return result, nil
+}
+
+func validateARC(fields []rawField, body []byte, resolver TXTResolver) (*ARCResult, []arcSet) {
+	result := &ARCResult{Status: ARCNone}
+	sets, err := collectARCSets(fields)
+	if err != nil {
+		result.Status, result.Err = ARCFail, err
+		return result, nil
+	}
+	if len(sets) == 0 {
+		return result, sets
+	}
+	result.Status = ARCPass
+	fail := func(err error) {
+		if result.Status != ARCFail {
+			result.Status, result.Err = ARCFail, err
+		}
+	}
+
+	n := len(sets)
+	result.Sets = make([]ARCSetResult, n)
+	for i, set := range sets {
+		r := &result.Sets[i]
+		r.Instance = i + 1
+		_, r.AuthServID, r.Results, _ = parseARCResults(set.results.Value())
+		seal, err := ParseARCSeal(set.seal.Value())
+		if err != nil {
+			r.SealStatus, r.SealErr = DKIMPermError, err
+			fail(fmt.Errorf("ARC-Seal i=%d: %v", i+1, err))
+			continue
+		}
+		r.Seal = seal
+	}
+	if seal := result.Sets[n-1].Seal; seal != nil && seal.ChainValidation == ARCFail {
+		fail(fmt.Errorf("ARC-Seal i=%d has cv=fail", n))
+	}
+	for i, r := range result.Sets {
+		want := ARCPass
+		if i == 0 {
+			want = ARCNone
+		}
+		if r.Seal != nil && r.Seal.ChainValidation != want {
+			fail(fmt.Errorf("ARC-Seal i=%d has cv=%s", i+1, r.Seal.ChainValidation))
+		}
+	}
+
+	oldest := n + 1
+	for i := n - 1; i >= 0; i-- {
+		field := sets[i].signature
+		r := &result.Sets[i]
+		if _, sig, err := ParseARCMessageSignature(field.Value()); err != nil {
+			r.MessageSignature = DKIMResult{Raw: strings.TrimSpace(field.Value()), Status: DKIMPermError, Err: err}
+		} else {
+			r.MessageSignature = verifySignatureField(fields, body, field, sig, resolver)
+		}
+		if r.MessageSignature.Status == DKIMPass && oldest == i+2 {
+			oldest = i + 1
+		}
+		if i == n-1 && r.MessageSignature.Status != DKIMPass {
+			fail(fmt.Errorf("ARC-Message-Signature i=%d: %s: %v", n, r.MessageSignature.Status, r.MessageSignature.Err))
+		}
+	}
+	if oldest > 1 && oldest <= n {
+		result.OldestPass = oldest
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		r := &result.Sets[i]
+		if r.Seal == nil {
+			continue
+		}
+		r.SealStatus, r.SealErr = verifySeal(sets[:i+1], r.Seal, resolver)
+		if r.SealStatus != DKIMPass {
+			fail(fmt.Errorf("ARC-Seal i=%d: %s: %v", i+1, r.SealStatus, r.SealErr))
+		}
+	}
+	return result, sets
+}
+
+// verifySeal verifies the ARC-Seal of the last of sets.
+func verifySeal(sets []arcSet, seal *ARCSeal, resolver TXTResolver) (string, error) {
+	key, hash, status, err := signingKey(resolver, seal.Algorithm, seal.Selector, seal.Domain)
+	if err != nil {
+		return status, err
+	}
+	digest := sealHash(sets, seal.ChainValidation, hash)
+	if err := verifySignature(key.PublicKey, hash, digest, seal.Signature); err != nil {
+		return DKIMFail, fmt.Errorf("signature does not verify")
+	}
+	return DKIMPass, nil
+}
+
+// ARCOptions configure SealARC. The ARC-Message-Signature is made as a
+// DKIM-Signature would be, without i=, l= and x=; the ARC-Seal uses the
+// same key, domain, selector and timestamp.
+type ARCOptions struct {
+	DKIMOptions
+	// AuthServID names the sealer in the ARC-Authentication-Results field.
+	AuthServID string
+	// Results are the authentication results of the sealer, such as
+	// "dkim=pass header.d=example.jp"; "none" if empty.
+	Results []string
+}
+
+// SealARC adds an ARC set to a message, on top of it and with the line
+// endings of the message. The existing chain is validated with resolver
+// to find the cv= value; a chain that has already failed is not sealed.
+func SealARC(message []byte, opts ARCOptions, resolver TXTResolver) ([]byte, error) {
+	if opts.AuthServID == "" {
+		return nil, fmt.Errorf("an authserv-id is required")
+	}
+	fields, body, err := splitMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	chain, sets := validateARC(fields, body, resolver)
+	if sets == nil && chain.Status == ARCFail {
+		return nil, fmt.Errorf("the ARC chain is malformed: %v", chain.Err)
+	}
+	n := len(sets)
+	if n > 0 && chain.Sets[n-1].Seal != nil && chain.Sets[n-1].Seal.ChainValidation == ARCFail {
+		return nil, fmt.Errorf("the ARC chain has already failed")
+	}
+	if n >= maxARCInstances {
+		return nil, fmt.Errorf("the ARC chain already has %d sets", n)
+	}
+	instance := strconv.Itoa(n+1) + ";"
+
+	f := &fieldFolder{}
+	f.b.WriteString("ARC-Authentication-Results:")
+	f.col = f.b.Len()
+	f.tag("i=" + instance)
+	results := opts.Results
+	if len(results) == 0 {
+		results = []string{"none"}
+	}
+	f.tag(opts.AuthServID + ";")
+	for i, result := range results {
+		if i < len(results)-1 {
+			result += ";"
+		}
+		f.tag(result)
+	}
+	aar := rawField{Name: "ARC-Authentication-Results", Raw: f.b.String() + "\r\n"}
+
+	signOpts := opts.DKIMOptions
+	signOpts.Identity, signOpts.BodyLength, signOpts.Expiration = "", false, time.Time{}
+	for _, name := range signOpts.Headers {
+		if strings.EqualFold(strings.TrimSpace(name), "ARC-Seal") {
+			return nil, fmt.Errorf("the ARC-Message-Signature must not sign ARC-Seal")
+		}
+	}
+	ams, err := signatureField("ARC-Message-Signature", "i="+instance, arcSignedHeaders, fields, body, signOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, _ := signingAlgorithm(opts.Key)
+	f = &fieldFolder{}
+	f.b.WriteString("ARC-Seal:")
+	f.col = f.b.Len()
+	f.tag("i=" + instance)
+	f.tag("a=" + algorithm + ";")
+	f.tag("cv=" + chain.Status + ";")
+	f.tag("d=" + opts.Domain + ";")
+	f.tag("s=" + opts.Selector + ";")
+	if !opts.Timestamp.IsZero() {
+		f.tag("t=" + strconv.FormatInt(opts.Timestamp.Unix(), 10) + ";")
+	}
+	f.tag("b=")
+	sets = append(sets, arcSet{
+		results:   aar,
+		signature: rawField{Name: "ARC-Message-Signature", Raw: ams},
+		seal:      rawField{Name: "ARC-Seal", Raw: f.b.String() + "\r\n"},
+	})
+	signature, err := signDigest(opts.Key, sealHash(sets, chain.Status, crypto.SHA256))
+	if err != nil {
+		return nil, err
+	}
+	f.value(base64.StdEncoding.EncodeToString(signature))
+	return prependFields(message, f.b.String()+"\r\n"+ams+aar.Raw), nil
+}
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateARC(t *testing.T) {
+	message, err := os.ReadFile("../test_files/arc.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadZoneFile("../test_files/dkim.zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ValidateARC(message, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != ARCPass || result.OldestPass != 0 || len(result.Sets) != 2 {
+		t.Fatalf("got %s (%v), oldest pass %d, %d sets", result.Status, result.Err, result.OldestPass, len(result.Sets))
+	}
+	set := result.Sets[1]
+	if set.AuthServID != "mx.example.com" || set.Results != "dkim=fail header.d=example.jp header.s=ed2024; arc=pass smtp.remote-ip=192.0.2.1" {
+		t.Errorf("got authserv-id %q and results %q", set.AuthServID, set.Results)
+	}
+	if set.Seal.ChainValidation != ARCPass || set.Seal.Algorithm != "rsa-sha256" || set.Seal.Selector != "rsa2024" {
+		t.Errorf("got seal %+v", set.Seal)
+	}
+	// the list broke the DKIM signatures that ARC vouches for
+	dkim, _ := VerifyDKIM(message, keys)
+	for _, r := range dkim {
+		if r.Status != DKIMFail {
+			t.Errorf("DKIM: got %s, want fail", r.Status)
+		}
+	}
+
+	none, _ := ValidateARC([]byte("From: a@example.jp\r\n\r\nbody\r\n"), keys)
+	if none.Status != ARCNone {
+		t.Errorf("unsealed: got %s", none.Status)
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(string) string
+		reason string
+	}{
+		{
+			name:   "Modified body",
+			modify: func(s string) string { return strings.Replace(s, "info@lists.example.jp", "info@example.com", 1) },
+			reason: "ARC-Message-Signature i=2: fail: body hash does not match",
+		},
+		{
+			name:   "Modified seal",
+			modify: func(s string) string { return strings.Replace(s, "cv=none", "cv=pass", 1) },
+			reason: "ARC-Seal i=1 has cv=pass",
+		},
+		{
+			name:   "Modified results",
+			modify: func(s string) string { return strings.Replace(s, "dkim=pass", "dkim=none", 1) },
+			reason: "ARC-Seal i=2: fail: signature does not verify",
+		},
+		{
+			name:   "Missing seal",
+			modify: func(s string) string { return s[strings.Index(s, "ARC-Message-Signature: i=2"):] },
+			reason: "ARC set i=2 has no ARC-Seal",
+		},
+		{
+			name:   "Removed sets",
+			modify: func(s string) string { return s[strings.Index(s, "DKIM-Signature"):] },
+			reason: "",
+		},
+		{
+			name: "Gap",
+			modify: func(s string) string {
+				return strings.NewReplacer("i=1;", "i=3;").Replace(s)
+			},
+			reason: "ARC set i=1 is missing",
+		},
+		{
+			name: "Duplicate",
+			modify: func(s string) string {
+				return "ARC-Seal: i=2; a=rsa-sha256; cv=pass; d=example.jp; s=rsa2024; b=\r\n" + s
+			},
+			reason: "more than one ARC-Seal with i=2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ValidateARC([]byte(tc.modify(string(message))), keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.reason == "" {
+				if result.Status != ARCNone {
+					t.Errorf("got %s, want none", result.Status)
+				}
+				return
+			}
+			if result.Status != ARCFail || result.Err == nil || result.Err.Error() != tc.reason {
+				t.Errorf("got %s (%v), want fail (%s)", result.Status, result.Err, tc.reason)
+			}
+		})
+	}
+}
+
+func TestSealARC(t *testing.T) {
+	message, err := os.ReadFile("../test_files/simple.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadZoneFile("../test_files/dkim.zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := LoadDKIMKey("../test_files/dkim-rsa.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, err := LoadDKIMKey("../test_files/dkim-ed25519.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edOpts := ARCOptions{
+		DKIMOptions: DKIMOptions{Domain: "example.jp", Selector: "ed2024", Key: edKey, Timestamp: time.Now()},
+		AuthServID:  "lists.example.jp",
+		Results:     []string{"dkim=none", "spf=pass smtp.mailfrom=example.com"},
+	}
+	rsaOpts := ARCOptions{
+		DKIMOptions: DKIMOptions{Domain: "example.jp", Selector: "rsa2024", Key: rsaKey},
+		AuthServID:  "mx.example.jp",
+		Results:     []string{"arc=pass"},
+	}
+	validate := func(message []byte) *ARCResult {
+		t.Helper()
+		result, err := ValidateARC(message, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	sealed, err := SealARC(message, edOpts, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(sealed, message) || bytes.Contains(sealed, []byte("\r\n")) {
+		t.Errorf("the set is not added on top with the line endings of the message")
+	}
+	for _, line := range strings.Split(string(sealed[:len(sealed)-len(message)]), "\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line longer than %d characters: %q", maxLineLength, line)
+		}
+	}
+	if !bytes.HasPrefix(sealed, []byte("ARC-Seal: i=1; a=ed25519-sha256; cv=none; d=example.jp; s=ed2024;")) {
+		t.Errorf("got %s", sealed[:80])
+	}
+	if result := validate(sealed); result.Status != ARCPass || len(result.Sets) != 1 {
+		t.Fatalf("one set: got %s (%v)", result.Status, result.Err)
+	} else if set := result.Sets[0]; set.Results != "dkim=none; spf=pass smtp.mailfrom=example.com" {
+		t.Errorf("got results %q", set.Results)
+	}
+
+	twice, err := SealARC(sealed, rsaOpts, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := validate(twice)
+	if result.Status != ARCPass || len(result.Sets) != 2 || result.Sets[1].Seal.ChainValidation != ARCPass {
+		t.Fatalf("two sets: got %s (%v)", result.Status, result.Err)
+	}
+
+	t.Run("Oldest pass", func(t *testing.T) {
+		opts := rsaOpts
+		opts.Headers = []string{"from", "subject"}
+		sealed, err := SealARC(sealed, opts, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// To is signed by the first ARC-Message-Signature only
+		modified := bytes.Replace(sealed, []byte("\nTo: "), []byte("\nTo: list@example.jp, "), 1)
+		result := validate(modified)
+		if result.Status != ARCPass || result.OldestPass != 2 {
+			t.Errorf("got %s (%v), oldest pass %d", result.Status, result.Err, result.OldestPass)
+		}
+		if status := result.Sets[0].MessageSignature.Status; status != DKIMFail {
+			t.Errorf("first ARC-Message-Signature: got %s", status)
+		}
+	})
+
+	t.Run("Failed chain", func(t *testing.T) {
+		broken := append(append([]byte{}, twice...), "appended\n"...)
+		sealed, err := SealARC(broken, edOpts, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := validate(sealed)
+		if result.Status != ARCFail || result.Err.Error() != "ARC-Seal i=3 has cv=fail" {
+			t.Errorf("got %s (%v)", result.Status, result.Err)
+		}
+		if status := result.Sets[2].SealStatus; status != DKIMPass {
+			t.Errorf("the cv=fail seal: got %s (%v)", status, result.Sets[2].SealErr)
+		}
+		if _, err := SealARC(sealed, rsaOpts, keys); err == nil || err.Error() != "the ARC chain has already failed" {
+			t.Errorf("sealing a failed chain: got %v", err)
+		}
+	})
+
+	t.Run("Sealing ARC-Seal", func(t *testing.T) {
+		opts := edOpts
+		opts.Headers = []string{"from", "arc-seal"}
+		if _, err := SealARC(message, opts, keys); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
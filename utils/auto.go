@@ -0,0 +1,41 @@
+package utils
+
+import "unicode/utf8"
+
+// AutoCharset returns the narrowest charset that carries s unchanged:
+// US-ASCII when s is plain ASCII, which needs no encoding unless it looks
+// like an encoded-word, ISO-2022-JP when it can represent s, and UTF-8
+// otherwise.
+func AutoCharset(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "US-ASCII"
+	}
+	if losses, err := CharsetLosses(s, "ISO-2022-JP"); err == nil && len(losses) == 0 {
+		return "ISO-2022-JP"
+	}
+	return "UTF-8"
+}
+
+// AutoEncoding returns "B" or "Q", whichever encodes s in charset into fewer
+// characters. Ties go to Q, which stays partly readable.
+func AutoEncoding(s, charset string) (string, error) {
+	b, err := EncodeHeader(s, charset, "B")
+	if err != nil {
+		return "", err
+	}
+	q, err := EncodeHeader(s, charset, "Q")
+	if err != nil {
+		return "", err
+	}
+	if len(b) < len(q) {
+		return "B", nil
+	}
+	return "Q", nil
+}
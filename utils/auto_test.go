@@ -0,0 +1,53 @@
+package utils
+
+import "testing"
+
+func TestAutoCharset(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "Hello world", expected: "US-ASCII"},
+		{input: "=?UTF-8?B?abc?=", expected: "US-ASCII"},
+		{input: "こんにちは", expected: "ISO-2022-JP"},
+		{input: "こんにちは～", expected: "UTF-8"},
+		{input: "こんにちは〜", expected: "ISO-2022-JP"},
+		{input: "㈱", expected: "UTF-8"},
+		{input: "ｶﾅ", expected: "UTF-8"},
+		{input: "Grüße", expected: "UTF-8"},
+		{input: "😀", expected: "UTF-8"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			if got := AutoCharset(tc.input); got != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAutoEncoding(t *testing.T) {
+	testCases := []struct {
+		input    string
+		charset  string
+		expected string
+	}{
+		{input: "こんにちは", charset: "ISO-2022-JP", expected: "Q"},
+		{input: "こんにちは", charset: "UTF-8", expected: "B"},
+		{input: "Café au lait", charset: "UTF-8", expected: "Q"},
+		{input: "Hello", charset: "US-ASCII", expected: "Q"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input+" "+tc.charset, func(t *testing.T) {
+			got, err := AutoEncoding(tc.input, tc.charset)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// cfbSignature starts every Compound File Binary file, the OLE2 container
+// Outlook .msg files are stored in.
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	cfbHeaderSize   = 512
+	cfbMaxSector    = 0xFFFFFFFA
+	cfbEndOfChain   = 0xFFFFFFFE
+	cfbNoStream     = 0xFFFFFFFF
+	cfbEntrySize    = 128
+	cfbStorage      = 1
+	cfbStream       = 2
+	cfbRoot         = 5
+	cfbHeaderDIFATs = 109
+)
+
+// cfbEntry is a storage or stream in the directory of a compound file.
+type cfbEntry struct {
+	name     string
+	kind     byte
+	start    uint32
+	size     uint64
+	children []*cfbEntry
+	// left, right and child are directory IDs of the red-black tree
+	left, right, child uint32
+}
+
+// find returns the entry directly below e with the given name, which is
+// compared case-insensitively as in the directory itself.
+func (e *cfbEntry) find(name string) *cfbEntry {
+	for _, child := range e.children {
+		if strings.EqualFold(child.name, name) {
+			return child
+		}
+	}
+	return nil
+}
+
+// compoundFile is a Compound File Binary file read into memory, as
+// described in [MS-CFB].
+type compoundFile struct {
+	data           []byte
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint64
+	fat            []uint32
+	miniFAT        []uint32
+	miniStream     []byte
+	root           *cfbEntry
+}
+
+// isCompoundFile reports whether data starts with the CFB signature.
+func isCompoundFile(data []byte) bool {
+	return bytes.HasPrefix(data, cfbSignature)
+}
+
+// readCompoundFile parses the header, allocation tables and directory of a
+// compound file.
+func readCompoundFile(data []byte) (*compoundFile, error) {
+	if len(data) < cfbHeaderSize || !isCompoundFile(data) {
+		return nil, fmt.Errorf("not a compound file")
+	}
+	le := binary.LittleEndian
+	sectorShift := le.Uint16(data[0x1E:])
+	miniShift := le.Uint16(data[0x20:])
+	if sectorShift != 9 && sectorShift != 12 {
+		return nil, fmt.Errorf("unsupported sector size 2^%d", sectorShift)
+	}
+	if miniShift != 6 {
+		return nil, fmt.Errorf("unsupported mini sector size 2^%d", miniShift)
+	}
+	cf := &compoundFile{
+		data:           data,
+		sectorSize:     1 << sectorShift,
+		miniSectorSize: 1 << miniShift,
+		miniCutoff:     uint64(le.Uint32(data[0x38:])),
+	}
+	numFAT := le.Uint32(data[0x2C:])
+	firstDir := le.Uint32(data[0x30:])
+	firstMiniFAT := le.Uint32(data[0x3C:])
+	firstDIFAT := le.Uint32(data[0x44:])
+	numDIFAT := le.Uint32(data[0x48:])
+
+	// the sectors of the FAT are listed in the header and then in a chain
+	// of DIFAT sectors, each ending with the next one
+	var fatSectors []uint32
+	for i := 0; i < cfbHeaderDIFATs; i++ {
+		if sector := le.Uint32(data[0x4C+4*i:]); sector <= cfbMaxSector {
+			fatSectors = append(fatSectors, sector)
+		}
+	}
+	// a damaged chain may loop, and numDIFAT may be anything, so the chain
+	// is also cut at a sector seen before or once it is longer than the file
+	perDIFAT := cf.sectorSize/4 - 1
+	sectors := uint32(len(data)/cf.sectorSize - 1)
+	seen := make(map[uint32]bool)
+	for sector, n := firstDIFAT, uint32(0); sector <= cfbMaxSector && n < numDIFAT; n++ {
+		if seen[sector] || n >= sectors {
+			return nil, fmt.Errorf("broken DIFAT chain at %d", sector)
+		}
+		seen[sector] = true
+		b, err := cf.sector(sector)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perDIFAT; i++ {
+			if s := le.Uint32(b[4*i:]); s <= cfbMaxSector {
+				fatSectors = append(fatSectors, s)
+			}
+		}
+		sector = le.Uint32(b[4*perDIFAT:])
+	}
+	if uint32(len(fatSectors)) < numFAT {
+		return nil, fmt.Errorf("compound file lists %d of its %d FAT sectors", len(fatSectors), numFAT)
+	}
+	for _, sector := range fatSectors[:numFAT] {
+		b, err := cf.sector(sector)
+		if err != nil {
+			return nil, err
+		}
+		cf.fat = append(cf.fat, uint32s(b)...)
+	}
+
+	dir, err := cf.readChain(cf.fat, firstDir, cf.sector)
+	if err != nil {
+		return nil, fmt.Errorf("directory: %v", err)
+	}
+	entries := cf.parseDirectory(dir)
+	if len(entries) == 0 || entries[0].kind != cfbRoot {
+		return nil, fmt.Errorf("compound file has no root entry")
+	}
+	cf.root = entries[0]
+	if err := linkChildren(entries, cf.root, make(map[uint32]bool)); err != nil {
+		return nil, err
+	}
+
+	if firstMiniFAT <= cfbMaxSector {
+		miniFAT, err := cf.readChain(cf.fat, firstMiniFAT, cf.sector)
+		if err != nil {
+			return nil, fmt.Errorf("mini FAT: %v", err)
+		}
+		cf.miniFAT = uint32s(miniFAT)
+	}
+	if cf.root.start <= cfbMaxSector {
+		miniStream, err := cf.readChain(cf.fat, cf.root.start, cf.sector)
+		if err != nil {
+			return nil, fmt.Errorf("mini stream: %v", err)
+		}
+		if uint64(len(miniStream)) > cf.root.size {
+			miniStream = miniStream[:cf.root.size]
+		}
+		cf.miniStream = miniStream
+	}
+	return cf, nil
+}
+
+// sector returns the sector with the given number; sector 0 follows the
+// header, which takes up a whole sector.
+func (cf *compoundFile) sector(n uint32) ([]byte, error) {
+	offset := (int64(n) + 1) * int64(cf.sectorSize)
+	if n > cfbMaxSector || offset+int64(cf.sectorSize) > int64(len(cf.data)) {
+		return nil, fmt.Errorf("sector %d is out of range", n)
+	}
+	return cf.data[offset : offset+int64(cf.sectorSize)], nil
+}
+
+// miniSector returns a sector of the mini stream.
+func (cf *compoundFile) miniSector(n uint32) ([]byte, error) {
+	offset := int64(n) * int64(cf.miniSectorSize)
+	if offset+int64(cf.miniSectorSize) > int64(len(cf.miniStream)) {
+		return nil, fmt.Errorf("mini sector %d is out of range", n)
+	}
+	return cf.miniStream[offset : offset+int64(cf.miniSectorSize)], nil
+}
+
+// readChain concatenates the sectors of the chain starting at start in the
+// allocation table fat.
+func (cf *compoundFile) readChain(fat []uint32, start uint32, read func(uint32) ([]byte, error)) ([]byte, error) {
+	var b []byte
+	for sector, n := start, 0; sector != cfbEndOfChain; n++ {
+		if int(sector) >= len(fat) || n > len(fat) {
+			return nil, fmt.Errorf("broken sector chain at %d", sector)
+		}
+		data, err := read(sector)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, data...)
+		sector = fat[sector]
+	}
+	return b, nil
+}
+
+// parseDirectory decodes the 128 byte entries of the directory stream.
+func (cf *compoundFile) parseDirectory(dir []byte) []*cfbEntry {
+	le := binary.LittleEndian
+	var entries []*cfbEntry
+	for offset := 0; offset+cfbEntrySize <= len(dir); offset += cfbEntrySize {
+		b := dir[offset : offset+cfbEntrySize]
+		nameLength := int(le.Uint16(b[64:]))
+		if nameLength > 64 {
+			nameLength = 64
+		}
+		units := make([]uint16, 0, 32)
+		for i := 0; i+1 < nameLength; i += 2 {
+			if u := le.Uint16(b[i:]); u != 0 {
+				units = append(units, u)
+			}
+		}
+		size := le.Uint64(b[120:])
+		if cf.sectorSize == 512 {
+			// version 3 files may leave garbage in the high half
+			size &= 0xFFFFFFFF
+		}
+		entries = append(entries, &cfbEntry{
+			name:  string(utf16.Decode(units)),
+			kind:  b[66],
+			left:  le.Uint32(b[68:]),
+			right: le.Uint32(b[72:]),
+			child: le.Uint32(b[76:]),
+			start: le.Uint32(b[116:]),
+			size:  size,
+		})
+	}
+	return entries
+}
+
+// linkChildren fills in the children of storage from the red-black tree of
+// its child entries, recursing into the storages below it.
+func linkChildren(entries []*cfbEntry, storage *cfbEntry, seen map[uint32]bool) error {
+	var walk func(id uint32) error
+	walk = func(id uint32) error {
+		if id == cfbNoStream {
+			return nil
+		}
+		if int(id) >= len(entries) || seen[id] {
+			return fmt.Errorf("broken directory at entry %d", id)
+		}
+		seen[id] = true
+		entry := entries[id]
+		if err := walk(entry.left); err != nil {
+			return err
+		}
+		if entry.kind == cfbStorage || entry.kind == cfbStream {
+			storage.children = append(storage.children, entry)
+		}
+		if entry.kind == cfbStorage {
+			if err := linkChildren(entries, entry, seen); err != nil {
+				return err
+			}
+		}
+		return walk(entry.right)
+	}
+	if err := walk(storage.child); err != nil {
+		return err
+	}
+	sort.Slice(storage.children, func(i, j int) bool {
+		return storage.children[i].name < storage.children[j].name
+	})
+	return nil
+}
+
+// stream returns the contents of a stream entry, which lives in the mini
+// stream when it is smaller than the cutoff.
+func (cf *compoundFile) stream(e *cfbEntry) ([]byte, error) {
+	if e.size == 0 {
+		return nil, nil
+	}
+	var b []byte
+	var err error
+	if e.size < cf.miniCutoff {
+		b, err = cf.readChain(cf.miniFAT, e.start, cf.miniSector)
+	} else {
+		b, err = cf.readChain(cf.fat, e.start, cf.sector)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stream %s: %v", e.name, err)
+	}
+	if uint64(len(b)) < e.size {
+		return nil, fmt.Errorf("stream %s is truncated", e.name)
+	}
+	return b[:e.size], nil
+}
+
+func uint32s(b []byte) []uint32 {
+	values := make([]uint32, len(b)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return values
+}
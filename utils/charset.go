@@ -0,0 +1,275 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ProtonMail/go-mime"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+)
+
+// charsetAliases maps normalized spellings that are common in mail but not
+// registered with IANA to a registered name.
+var charsetAliases = map[string]string{
+	"utf8":      "UTF-8",
+	"ascii":     "US-ASCII",
+	"usascii":   "US-ASCII",
+	"iso2022jp": "ISO-2022-JP",
+	"shiftjis":  "Shift_JIS",
+	"sjis":      "Shift_JIS",
+	"eucjp":     "EUC-JP",
+	"ujis":      "EUC-JP",
+	"euckr":     "EUC-KR",
+	"cp936":     "GBK",
+	"gb18030":   "GB18030",
+	"big5":      "Big5",
+	"cp950":     "Big5",
+	"koi8r":     "KOI8-R",
+	"koi8u":     "KOI8-U",
+}
+
+// jisVariants are the Microsoft flavours of the Japanese charsets, which add
+// the NEC special characters such as ① and ㈱ and the IBM extensions to
+// JIS X 0208. The x/text encoders already implement these flavours, so the
+// registered charsets are restricted to JIS X 0208 by jisRepertoire and
+// take the JIS forms of jisStandardForms through jisEncoding instead.
+// ISO-2022-JP-MS is not registered and is labelled ISO-2022-JP, as Outlook
+// does.
+var jisVariants = map[string]struct {
+	name string
+	enc  encoding.Encoding
+}{
+	"cp932":       {"Windows-31J", japanese.ShiftJIS},
+	"windows31j":  {"Windows-31J", japanese.ShiftJIS},
+	"mskanji":     {"Windows-31J", japanese.ShiftJIS},
+	"iso2022jpms": {"ISO-2022-JP", japanese.ISO2022JP},
+}
+
+// jisStandardForms maps the characters that the JIS X 0208 mapping gives to
+// some codes of rows 1 and 2 to the ones the Microsoft mapping gives instead,
+// which are the only ones the x/text codecs know. The wave dash 〜 at 1-33
+// is ～ to Microsoft, for example.
+var jisStandardForms = map[rune]rune{
+	'〜': '～',
+	'−': '－',
+	'‖': '∥',
+	'—': '―',
+	'¢': '￠',
+	'£': '￡',
+	'¬': '￢',
+}
+
+var (
+	windowsCharsetPattern = regexp.MustCompile(`^(cp|win|windows)(874|125[0-8])$`)
+	isoCharsetPattern     = regexp.MustCompile(`^iso8859([0-9]{1,2})$`)
+)
+
+func NormalizeCharset(input string) string {
+	input = strings.ToLower(input)
+	input = strings.ReplaceAll(input, "-", "")
+	input = strings.ReplaceAll(input, "_", "")
+	return input
+}
+
+// LookupCharset resolves a charset name or alias to its preferred MIME name
+// and encoding. Only charsets that leave ASCII untouched are accepted, since
+// encoded-words must stay readable as ASCII.
+func LookupCharset(name string) (string, encoding.Encoding, error) {
+	if variant, ok := jisVariants[NormalizeCharset(name)]; ok {
+		return variant.name, variant.enc, nil
+	}
+	enc, err := ianaindex.MIME.Encoding(name)
+	if err != nil || enc == nil {
+		enc, err = ianaindex.MIME.Encoding(charsetAlias(name))
+	}
+	if err != nil || enc == nil || !isASCIICompatible(enc) {
+		return "", nil, fmt.Errorf("unsupported charset: %s", name)
+	}
+	mimeName, err := ianaindex.MIME.Name(enc)
+	if err != nil {
+		return "", nil, fmt.Errorf("unsupported charset: %s", name)
+	}
+	if mimeName == "Shift_JIS" || mimeName == "ISO-2022-JP" {
+		enc = jisEncoding{enc}
+	}
+	return mimeName, enc, nil
+}
+
+// jisEncoding is a registered Japanese charset whose encoder also takes the
+// JIS forms of jisStandardForms, writing them with the codes of the
+// Microsoft forms. Decoding still gives the Microsoft forms.
+type jisEncoding struct {
+	encoding.Encoding
+}
+
+func (e jisEncoding) NewEncoder() *encoding.Encoder {
+	toMicrosoft := runes.Map(func(r rune) rune {
+		if microsoft, ok := jisStandardForms[r]; ok {
+			return microsoft
+		}
+		return r
+	})
+	return &encoding.Encoder{Transformer: transform.Chain(toMicrosoft, e.Encoding.NewEncoder())}
+}
+
+// DecodeCharset converts b from charset to UTF-8. Without a charset, b is
+// returned as is if it is valid UTF-8.
+func DecodeCharset(b []byte, charset string) ([]byte, error) {
+	if charset == "" {
+		if utf8.Valid(b) {
+			return b, nil
+		}
+		return nil, fmt.Errorf("text is not UTF-8 and has no charset")
+	}
+	_, enc, err := LookupCharset(charset)
+	if err != nil {
+		// go-mime knows a few more labels seen in the wild
+		return gomime.DecodeCharset(b, "text/plain", map[string]string{"charset": charset})
+	}
+	return enc.NewDecoder().Bytes(b)
+}
+
+// charsetAlias returns the registered name for a known alias of name, or the
+// name itself.
+func charsetAlias(name string) string {
+	normalized := NormalizeCharset(name)
+	if alias, ok := charsetAliases[normalized]; ok {
+		return alias
+	}
+	if match := windowsCharsetPattern.FindStringSubmatch(normalized); match != nil {
+		return "windows-" + match[2]
+	}
+	if match := isoCharsetPattern.FindStringSubmatch(normalized); match != nil {
+		return "ISO-8859-" + match[1]
+	}
+	return name
+}
+
+func isASCIICompatible(enc encoding.Encoding) bool {
+	var ascii strings.Builder
+	for c := byte(' '); c <= '~'; c++ {
+		ascii.WriteByte(c)
+	}
+	encoded, err := enc.NewEncoder().String(ascii.String())
+	return err == nil && encoded == ascii.String()
+}
+
+// SupportedCharsets returns the MIME names of every charset LookupCharset
+// accepts, sorted alphabetically.
+func SupportedCharsets() []string {
+	var all []encoding.Encoding
+	for _, encodings := range [][]encoding.Encoding{
+		unicode.All,
+		charmap.All,
+		japanese.All,
+		korean.All,
+		simplifiedchinese.All,
+		traditionalchinese.All,
+	} {
+		all = append(all, encodings...)
+	}
+
+	// US-ASCII is registered but not part of any of the lists above
+	if _, ascii, err := LookupCharset("US-ASCII"); err == nil {
+		all = append(all, ascii)
+	}
+
+	seen := make(map[string]bool)
+	names := []string{"ISO-2022-JP-MS"}
+	for _, enc := range all {
+		name, err := ianaindex.MIME.Name(enc)
+		if enc == japanese.ShiftJIS {
+			// x/text implements the Microsoft flavour of Shift_JIS
+			names = append(names, "Windows-31J")
+		}
+		if err != nil || name == "" || seen[name] || !isASCIICompatible(enc) {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+	return names
+}
+
+// jisRepertoire returns the characters a registered Japanese charset can
+// carry when the x/text encoder accepts more, or nil if the encoder is
+// exact.
+func jisRepertoire(name string) func(rune) bool {
+	if _, ok := jisVariants[NormalizeCharset(name)]; ok {
+		return nil
+	}
+	mimeName, _, err := LookupCharset(name)
+	if err != nil {
+		return nil
+	}
+	switch mimeName {
+	case "Shift_JIS":
+		return func(r rune) bool { return inJISX0208(r, true) }
+	case "ISO-2022-JP":
+		return func(r rune) bool { return inJISX0208(r, false) }
+	}
+	return nil
+}
+
+// inJISX0208 reports whether r is ASCII or a character of JIS X 0208 proper,
+// which is rows 1 to 8 and 16 to 84. Half-width katakana from JIS X 0201 are
+// accepted when kana is set, as in Shift_JIS.
+func inJISX0208(r rune, kana bool) bool {
+	if r < utf8.RuneSelf {
+		return true
+	}
+	if microsoft, ok := jisStandardForms[r]; ok {
+		r = microsoft
+	}
+	b, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(string(r)))
+	if err != nil {
+		return false
+	}
+	if len(b) == 1 {
+		return kana
+	}
+	lead, trail := int(b[0]), int(b[1])
+	var row int
+	if lead <= 0x9f {
+		row = (lead-0x81)*2 + 1
+	} else {
+		row = (lead-0xc1)*2 + 1
+	}
+	if trail >= 0x9f {
+		row++
+	}
+	return (row >= 1 && row <= 8) || (row >= 16 && row <= 84)
+}
+
+// StrictJIS returns s, decoded from charset, as a decoder that follows the
+// JIS X 0208 mapping reads it: for Shift_JIS and ISO-2022-JP the Microsoft
+// forms of jisStandardForms become the JIS ones, so ～ reads as 〜. s is
+// returned as is for other charsets.
+func StrictJIS(s, charset string) string {
+	if jisRepertoire(charset) == nil {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		for form, microsoft := range jisStandardForms {
+			if r == microsoft {
+				return form
+			}
+		}
+		return r
+	}, s)
+}
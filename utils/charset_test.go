@@ -0,0 +1,66 @@
+package utils
+
+import "testing"
+
+func TestLookupCharset(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "UTF-8", expected: "UTF-8"},
+		{input: "utf8", expected: "UTF-8"},
+		{input: "iso2022jp", expected: "ISO-2022-JP"},
+		{input: "sjis", expected: "Shift_JIS"},
+		{input: "cp932", expected: "Windows-31J"},
+		{input: "Windows-31J", expected: "Windows-31J"},
+		{input: "ISO-2022-JP-MS", expected: "ISO-2022-JP"},
+		{input: "eucjp", expected: "EUC-JP"},
+		{input: "GB18030", expected: "GB18030"},
+		{input: "big5", expected: "Big5"},
+		{input: "euc_kr", expected: "EUC-KR"},
+		{input: "latin1", expected: "ISO-8859-1"},
+		{input: "iso8859-15", expected: "ISO-8859-15"},
+		{input: "cp1252", expected: "windows-1252"},
+		{input: "KOI8-R", expected: "KOI8-R"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			name, enc, err := LookupCharset(tc.input)
+			if err != nil {
+				t.Fatalf("failed to look up: %v", err)
+			}
+			if name != tc.expected || enc == nil {
+				t.Fatalf("expected %s, got %s", tc.expected, name)
+			}
+		})
+	}
+
+	for _, input := range []string{"UTF-16", "IBM037", "no-such-charset"} {
+		t.Run(input, func(t *testing.T) {
+			if _, _, err := LookupCharset(input); err == nil {
+				t.Fatalf("expected %s to be rejected", input)
+			}
+		})
+	}
+}
+
+func TestSupportedCharsets(t *testing.T) {
+	names := SupportedCharsets()
+	for _, name := range names {
+		if _, _, err := LookupCharset(name); err != nil {
+			t.Fatalf("listed charset %s cannot be looked up: %v", name, err)
+		}
+	}
+	for _, expected := range []string{"UTF-8", "US-ASCII", "ISO-2022-JP", "EUC-JP", "GB18030", "Big5", "EUC-KR", "KOI8-R", "Windows-31J", "ISO-2022-JP-MS"} {
+		found := false
+		for _, name := range names {
+			if name == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected %s to be listed", expected)
+		}
+	}
+}
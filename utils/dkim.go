@@ -0,0 +1,655 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers crypto.SHA256
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIM verification results, as named by RFC 8601.
+const (
+	DKIMPass      = "pass"
+	DKIMFail      = "fail"
+	DKIMPermError = "permerror"
+	DKIMTempError = "temperror"
+)
+
+// Canonicalization algorithms of RFC 6376 section 3.4.
+const (
+	CanonSimple  = "simple"
+	CanonRelaxed = "relaxed"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted, as required by RFC 8301.
+const minRSAKeyBits = 1024
+
+// rawField is a header field as it appears in the message, with its
+// folding and the CRLF ending its last line.
+type rawField struct {
+	Name string
+	Raw  string
+}
+
+// Value returns the part of the field after the colon.
+func (f rawField) Value() string {
+	return f.Raw[strings.Index(f.Raw, ":")+1:]
+}
+
+// splitMessage splits a message into its header fields and body. Bare LF
+// line endings, as in messages saved on Unix, are turned into CRLF first,
+// since signatures are computed over CRLF.
+func splitMessage(data []byte) ([]rawField, []byte, error) {
+	data = toCRLF(data)
+	var header []byte
+	var body []byte
+	if bytes.HasPrefix(data, []byte("\r\n")) {
+		body = data[2:]
+	} else if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 {
+		header, body = data[:i+2], data[i+4:]
+	} else {
+		header = data
+	}
+
+	var fields []rawField
+	for len(header) > 0 {
+		end := bytes.Index(header, []byte("\r\n"))
+		if end < 0 {
+			end = len(header)
+		} else {
+			end += 2
+		}
+		line := string(header[:end])
+		header = header[end:]
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(fields) == 0 {
+				return nil, nil, fmt.Errorf("malformed header: continuation line without a field")
+			}
+			fields[len(fields)-1].Raw += line
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, nil, fmt.Errorf("malformed header: %q", strings.TrimRight(line, "\r\n"))
+		}
+		fields = append(fields, rawField{Name: strings.TrimRight(line[:colon], " \t"), Raw: line})
+	}
+	if len(fields) == 0 {
+		return nil, nil, fmt.Errorf("no header found")
+	}
+	return fields, body, nil
+}
+
+// toCRLF turns every bare LF into CRLF.
+func toCRLF(data []byte) []byte {
+	if !bytes.Contains(data, []byte("\n")) || bytes.Count(data, []byte("\n")) == bytes.Count(data, []byte("\r\n")) {
+		return data
+	}
+	var b bytes.Buffer
+	b.Grow(len(data) + bytes.Count(data, []byte("\n")))
+	for i, c := range data {
+		if c == '\n' && (i == 0 || data[i-1] != '\r') {
+			b.WriteByte('\r')
+		}
+		b.WriteByte(c)
+	}
+	return b.Bytes()
+}
+
+// parseTagList parses a tag=value list of RFC 6376 section 3.2, as used by
+// DKIM-Signature fields and key records. Whitespace around tags and values
+// is dropped.
+func parseTagList(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, spec := range strings.Split(s, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		eq := strings.Index(spec, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("tag without a value: %q", strings.TrimSpace(spec))
+		}
+		name := strings.TrimSpace(spec[:eq])
+		if name == "" {
+			return nil, fmt.Errorf("value without a tag: %q", strings.TrimSpace(spec))
+		}
+		if _, ok := tags[name]; ok {
+			return nil, fmt.Errorf("duplicate tag %s=", name)
+		}
+		tags[name] = strings.TrimSpace(spec[eq+1:])
+	}
+	return tags, nil
+}
+
+// removeFWS drops the folding whitespace allowed inside base64 values.
+func removeFWS(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// DKIMSignature is a parsed DKIM-Signature field.
+type DKIMSignature struct {
+	Version     string
+	Algorithm   string
+	Signature   []byte
+	BodyHash    []byte
+	Domain      string
+	Selector    string
+	Headers     []string
+	HeaderCanon string
+	BodyCanon   string
+	Identity    string
+	BodyLength  int64 // -1 without l=
+	Timestamp   time.Time
+	Expiration  time.Time
+	Tags        map[string]string
+}
+
+// Canonicalization returns the c= value in its full form such as
+// "relaxed/simple".
+func (s *DKIMSignature) Canonicalization() string {
+	return s.HeaderCanon + "/" + s.BodyCanon
+}
+
+// ParseDKIMSignature parses the value of a DKIM-Signature field and checks
+// the tags that RFC 6376 requires.
+func ParseDKIMSignature(value string) (*DKIMSignature, error) {
+	tags, err := parseTagList(value)
+	if err != nil {
+		return nil, err
+	}
+	return newDKIMSignature(tags)
+}
+
+func newDKIMSignature(tags map[string]string) (*DKIMSignature, error) {
+	var err error
+	for _, tag := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[tag]; !ok {
+			return nil, fmt.Errorf("missing tag %s=", tag)
+		}
+	}
+	sig := &DKIMSignature{
+		Version:    tags["v"],
+		Algorithm:  strings.ToLower(tags["a"]),
+		Domain:     strings.ToLower(strings.TrimSuffix(tags["d"], ".")),
+		Selector:   tags["s"],
+		BodyLength: -1,
+		Tags:       tags,
+	}
+	if sig.Version != "1" {
+		return nil, fmt.Errorf("unsupported version v=%s", sig.Version)
+	}
+	if sig.Signature, err = base64.StdEncoding.DecodeString(removeFWS(tags["b"])); err != nil {
+		return nil, fmt.Errorf("invalid b=: %v", err)
+	}
+	if sig.BodyHash, err = base64.StdEncoding.DecodeString(removeFWS(tags["bh"])); err != nil {
+		return nil, fmt.Errorf("invalid bh=: %v", err)
+	}
+	for _, name := range strings.Split(tags["h"], ":") {
+		if name = strings.TrimSpace(name); name != "" {
+			sig.Headers = append(sig.Headers, name)
+		}
+	}
+	signsFrom := false
+	for _, name := range sig.Headers {
+		signsFrom = signsFrom || strings.EqualFold(name, "From")
+	}
+	if !signsFrom {
+		return nil, fmt.Errorf("h= does not include From")
+	}
+
+	sig.HeaderCanon, sig.BodyCanon = CanonSimple, CanonSimple
+	if c, ok := tags["c"]; ok {
+		if sig.HeaderCanon, sig.BodyCanon, err = ParseCanonicalization(c); err != nil {
+			return nil, err
+		}
+	}
+
+	sig.Identity = "@" + sig.Domain
+	if i, ok := tags["i"]; ok {
+		if err := checkIdentity(i, sig.Domain); err != nil {
+			return nil, err
+		}
+		sig.Identity = i
+	}
+	if l, ok := tags["l"]; ok {
+		if sig.BodyLength, err = strconv.ParseInt(l, 10, 64); err != nil || sig.BodyLength < 0 {
+			return nil, fmt.Errorf("invalid l=%s", l)
+		}
+	}
+	if q, ok := tags["q"]; ok && !strings.Contains(strings.ToLower(q), "dns/txt") {
+		return nil, fmt.Errorf("unsupported query method q=%s", q)
+	}
+	if sig.Timestamp, err = parseDKIMTime(tags, "t"); err != nil {
+		return nil, err
+	}
+	if sig.Expiration, err = parseDKIMTime(tags, "x"); err != nil {
+		return nil, err
+	}
+	if !sig.Timestamp.IsZero() && !sig.Expiration.IsZero() && sig.Expiration.Before(sig.Timestamp) {
+		return nil, fmt.Errorf("x= is before t=")
+	}
+	return sig, nil
+}
+
+// checkIdentity checks that the domain of the identity i= is the signing
+// domain d= or one of its subdomains.
+func checkIdentity(identity, domain string) error {
+	at := strings.LastIndex(identity, "@")
+	if at < 0 {
+		return fmt.Errorf("invalid i=%s", identity)
+	}
+	identityDomain := strings.ToLower(identity[at+1:])
+	domain = strings.ToLower(domain)
+	if identityDomain != domain && !strings.HasSuffix(identityDomain, "."+domain) {
+		return fmt.Errorf("i=%s is not in the domain d=%s", identity, domain)
+	}
+	return nil
+}
+
+// ParseCanonicalization parses a c= value such as "relaxed/simple". The
+// body algorithm defaults to simple when only the header one is given.
+func ParseCanonicalization(c string) (header, body string, err error) {
+	header, body, found := strings.Cut(strings.ToLower(strings.TrimSpace(c)), "/")
+	if !found {
+		body = CanonSimple
+	}
+	for _, canon := range []string{header, body} {
+		if canon != CanonSimple && canon != CanonRelaxed {
+			return "", "", fmt.Errorf("unknown canonicalization c=%s", c)
+		}
+	}
+	return header, body, nil
+}
+
+func parseDKIMTime(tags map[string]string, tag string) (time.Time, error) {
+	value, ok := tags[tag]
+	if !ok {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s=%s", tag, value)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// hashFor returns the hash of the signing algorithm a=.
+func hashFor(algorithm string) (crypto.Hash, string, error) {
+	switch algorithm {
+	case "rsa-sha256":
+		return crypto.SHA256, "rsa", nil
+	case "ed25519-sha256":
+		return crypto.SHA256, "ed25519", nil
+	case "rsa-sha1":
+		return 0, "", fmt.Errorf("rsa-sha1 is no longer accepted (RFC 8301)")
+	}
+	return 0, "", fmt.Errorf("unsupported algorithm a=%s", algorithm)
+}
+
+// DKIMKey is a public key record published at
+// selector._domainkey.domain.
+type DKIMKey struct {
+	KeyType   string
+	PublicKey crypto.PublicKey
+	Hashes    []string
+	Flags     []string
+	Services  []string
+}
+
+// Testing reports whether the key has the t=y flag, meaning the domain is
+// testing DKIM.
+func (k *DKIMKey) Testing() bool {
+	for _, flag := range k.Flags {
+		if flag == "y" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDKIMKey parses a DKIM key record. A key with an empty p= has been
+// revoked.
+func ParseDKIMKey(record string) (*DKIMKey, error) {
+	tags, err := parseTagList(record)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, fmt.Errorf("unsupported key version v=%s", v)
+	}
+	key := &DKIMKey{KeyType: "rsa"}
+	if k, ok := tags["k"]; ok {
+		key.KeyType = strings.ToLower(k)
+	}
+	splitList := func(s string) []string {
+		var list []string
+		for _, item := range strings.Split(s, ":") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, strings.ToLower(item))
+			}
+		}
+		return list
+	}
+	key.Hashes = splitList(tags["h"])
+	key.Flags = splitList(tags["t"])
+	key.Services = splitList(tags["s"])
+
+	p, ok := tags["p"]
+	if !ok {
+		return nil, fmt.Errorf("key record has no p=")
+	}
+	data, err := base64.StdEncoding.DecodeString(removeFWS(p))
+	if err != nil {
+		return nil, fmt.Errorf("invalid p=: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("key has been revoked")
+	}
+	switch key.KeyType {
+	case "rsa":
+		publicKey, err := x509.ParsePKIXPublicKey(data)
+		if err != nil {
+			// some records hold a bare RSAPublicKey
+			if publicKey, err = x509.ParsePKCS1PublicKey(data); err != nil {
+				return nil, fmt.Errorf("p= is not an RSA public key")
+			}
+		}
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("p= is not an RSA key")
+		}
+		if rsaKey.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key of %d bits is too short", rsaKey.N.BitLen())
+		}
+		key.PublicKey = rsaKey
+	case "ed25519":
+		if len(data) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Ed25519 key is %d bytes, not %d", len(data), ed25519.PublicKeySize)
+		}
+		key.PublicKey = ed25519.PublicKey(data)
+	default:
+		return nil, fmt.Errorf("unsupported key type k=%s", key.KeyType)
+	}
+	return key, nil
+}
+
+// lookupDKIMKey fetches and parses the key of a signature. A key that is
+// missing or unusable is a permanent error; a failed lookup is temporary.
+func lookupDKIMKey(resolver TXTResolver, selector, domain string) (*DKIMKey, string, error) {
+	name := selector + "._domainkey." + domain
+	records, err := resolver.LookupTXT(name)
+	if errors.Is(err, ErrNoRecord) {
+		return nil, DKIMPermError, fmt.Errorf("no key for %s", name)
+	}
+	if err != nil {
+		return nil, DKIMTempError, fmt.Errorf("key lookup for %s: %v", name, err)
+	}
+	if len(records) != 1 {
+		return nil, DKIMPermError, fmt.Errorf("%d key records for %s", len(records), name)
+	}
+	key, err := ParseDKIMKey(records[0])
+	if err != nil {
+		return nil, DKIMPermError, fmt.Errorf("key %s: %v", name, err)
+	}
+	return key, "", nil
+}
+
+// signingKey looks up the key of selector and domain and checks that it
+// can verify signatures of the algorithm a=, returning the hash to use.
+func signingKey(resolver TXTResolver, algorithm, selector, domain string) (*DKIMKey, crypto.Hash, string, error) {
+	hash, keyType, err := hashFor(algorithm)
+	if err != nil {
+		return nil, 0, DKIMPermError, err
+	}
+	key, status, err := lookupDKIMKey(resolver, selector, domain)
+	if err != nil {
+		return nil, 0, status, err
+	}
+	if key.KeyType != keyType {
+		return nil, 0, DKIMPermError, fmt.Errorf("a=%s does not match the %s key", algorithm, key.KeyType)
+	}
+	if len(key.Hashes) > 0 && !containsString(key.Hashes, "sha256") {
+		return nil, 0, DKIMPermError, fmt.Errorf("key does not allow sha256")
+	}
+	return key, hash, "", nil
+}
+
+// CanonicalizeBody applies the body canonicalization of RFC 6376 section
+// 3.4.3 or 3.4.4 to a body with CRLF line endings.
+func CanonicalizeBody(body []byte, canon string) []byte {
+	if canon == CanonRelaxed {
+		lines := bytes.SplitAfter(body, []byte("\r\n"))
+		var b bytes.Buffer
+		for _, line := range lines {
+			content := bytes.TrimSuffix(line, []byte("\r\n"))
+			b.Write(bytes.TrimRight(collapseWSP(content), " "))
+			if len(content) < len(line) {
+				b.WriteString("\r\n")
+			}
+		}
+		body = b.Bytes()
+		// trailing empty lines go, but a last line without CRLF gets one
+		body = bytes.TrimRight(body, "\r\n")
+		if len(body) == 0 {
+			return nil
+		}
+		return append(body, '\r', '\n')
+	}
+	// trailing empty lines go, and an empty body is a single CRLF
+	for bytes.HasSuffix(body, []byte("\r\n\r\n")) {
+		body = body[:len(body)-2]
+	}
+	if !bytes.HasSuffix(body, []byte("\r\n")) {
+		body = append(append([]byte{}, body...), '\r', '\n')
+	}
+	return body
+}
+
+// collapseWSP replaces every run of spaces and tabs with a single space.
+func collapseWSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	inWSP := false
+	for _, c := range b {
+		if c == ' ' || c == '\t' {
+			if !inWSP {
+				out = append(out, ' ')
+			}
+			inWSP = true
+			continue
+		}
+		inWSP = false
+		out = append(out, c)
+	}
+	return out
+}
+
+// CanonicalizeHeader applies the header canonicalization of RFC 6376
+// section 3.4.1 or 3.4.2 to a field with its CRLF.
+func CanonicalizeHeader(raw, canon string) string {
+	if canon != CanonRelaxed {
+		return raw
+	}
+	colon := strings.Index(raw, ":")
+	name := strings.ToLower(strings.TrimRight(raw[:colon], " \t"))
+	value := strings.NewReplacer("\r\n", "").Replace(raw[colon+1:])
+	value = strings.Trim(string(collapseWSP([]byte(value))), " ")
+	return name + ":" + value + "\r\n"
+}
+
+// selectHeaders returns the fields named by h= in order. A name that occurs
+// several times picks its instances from the bottom up, and names beyond
+// the last instance select nothing, as in RFC 6376 section 5.4.2.
+func selectHeaders(fields []rawField, names []string) []rawField {
+	used := make([]bool, len(fields))
+	var selected []rawField
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].Name, name) {
+				used[i] = true
+				selected = append(selected, fields[i])
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// stripSignature removes the value of the b= tag from a signature field,
+// which is how the field is signed.
+func stripSignature(raw string) string {
+	colon := strings.Index(raw, ":")
+	var b strings.Builder
+	b.WriteString(raw[:colon+1])
+	specs := strings.Split(raw[colon+1:], ";")
+	for i, spec := range specs {
+		if i > 0 {
+			b.WriteString(";")
+		}
+		eq := strings.Index(spec, "=")
+		if eq >= 0 && strings.TrimSpace(spec[:eq]) == "b" {
+			spec = spec[:eq+1]
+		}
+		b.WriteString(spec)
+	}
+	return b.String()
+}
+
+// headerHash hashes the selected fields and the signature field itself,
+// without its b= value and final CRLF.
+func headerHash(fields []rawField, names []string, signature rawField, canon string, hash crypto.Hash) []byte {
+	return hashFields(selectHeaders(fields, names), signature, canon, hash)
+}
+
+// hashFields hashes fields in order followed by the signature field, as
+// headerHash does.
+func hashFields(fields []rawField, signature rawField, canon string, hash crypto.Hash) []byte {
+	h := hash.New()
+	for _, field := range fields {
+		h.Write([]byte(CanonicalizeHeader(field.Raw, canon)))
+	}
+	signed := CanonicalizeHeader(stripSignature(signature.Raw), canon)
+	h.Write([]byte(strings.TrimSuffix(signed, "\r\n")))
+	return h.Sum(nil)
+}
+
+// bodyHash hashes the canonicalized body, cut to length unless it is
+// negative.
+func bodyHash(body []byte, canon string, length int64, hash crypto.Hash) ([]byte, error) {
+	canonical := CanonicalizeBody(body, canon)
+	if length >= 0 {
+		if length > int64(len(canonical)) {
+			return nil, fmt.Errorf("l=%d is longer than the body of %d bytes", length, len(canonical))
+		}
+		canonical = canonical[:length]
+	}
+	h := hash.New()
+	h.Write(canonical)
+	return h.Sum(nil), nil
+}
+
+// verifySignature checks sig against the hash of the signed data.
+func verifySignature(key crypto.PublicKey, hash crypto.Hash, digest, sig []byte) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, hash, digest, sig)
+	case ed25519.PublicKey:
+		// RFC 8463 signs the hash with PureEdDSA
+		if !ed25519.Verify(key, digest, sig) {
+			return fmt.Errorf("ed25519: verification error")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key %T", key)
+}
+
+// DKIMResult is the result of verifying one DKIM-Signature field.
+// Signature is nil when the field could not be parsed.
+type DKIMResult struct {
+	Signature *DKIMSignature
+	Raw       string
+	Status    string
+	Err       error
+	// Testing is set when the key declares the domain to be testing DKIM.
+	Testing bool
+}
+
+// VerifyDKIM verifies every DKIM-Signature field of a message, looking keys
+// up with resolver. An error is returned only if the message cannot be
+// read; the outcome of each signature is in its result.
+func VerifyDKIM(message []byte, resolver TXTResolver) ([]DKIMResult, error) {
+	fields, body, err := splitMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	var results []DKIMResult
+	for _, field := range fields {
+		if !strings.EqualFold(field.Name, "DKIM-Signature") {
+			continue
+		}
+		results = append(results, verifyField(fields, body, field, resolver))
+	}
+	return results, nil
+}
+
+func verifyField(fields []rawField, body []byte, field rawField, resolver TXTResolver) DKIMResult {
+	sig, err := ParseDKIMSignature(field.Value())
+	if err != nil {
+		return DKIMResult{Raw: strings.TrimSpace(field.Value()), Status: DKIMPermError, Err: err}
+	}
+	return verifySignatureField(fields, body, field, sig, resolver)
+}
+
+// verifySignatureField verifies the parsed signature of a DKIM-Signature or
+// ARC-Message-Signature field.
+func verifySignatureField(fields []rawField, body []byte, field rawField, sig *DKIMSignature, resolver TXTResolver) DKIMResult {
+	result := DKIMResult{Signature: sig, Raw: strings.TrimSpace(field.Value())}
+	fail := func(status string, err error) DKIMResult {
+		result.Status, result.Err = status, err
+		return result
+	}
+	if !sig.Expiration.IsZero() && time.Now().After(sig.Expiration) {
+		return fail(DKIMPermError, fmt.Errorf("signature expired at %s", sig.Expiration.Format(time.RFC3339)))
+	}
+	key, hash, status, err := signingKey(resolver, sig.Algorithm, sig.Selector, sig.Domain)
+	if err != nil {
+		return fail(status, err)
+	}
+	result.Testing = key.Testing()
+
+	computed, err := bodyHash(body, sig.BodyCanon, sig.BodyLength, hash)
+	if err != nil {
+		return fail(DKIMPermError, err)
+	}
+	if !bytes.Equal(computed, sig.BodyHash) {
+		return fail(DKIMFail, fmt.Errorf("body hash does not match"))
+	}
+	digest := headerHash(fields, sig.Headers, field, sig.HeaderCanon, hash)
+	if err := verifySignature(key.PublicKey, hash, digest, sig.Signature); err != nil {
+		return fail(DKIMFail, fmt.Errorf("signature does not verify"))
+	}
+	result.Status = DKIMPass
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
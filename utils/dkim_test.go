@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDKIM(t *testing.T) {
+	message, err := os.ReadFile("../test_files/dkim.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone, err := LoadZoneFile("../test_files/dkim.zone")
+	if err != nil {
+		t.Fatalf("failed to load the zone file: %v", err)
+	}
+	keys, err := LoadTXTJSON("../test_files/dkim.json")
+	if err != nil {
+		t.Fatalf("failed to load the JSON keys: %v", err)
+	}
+	lf := bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+
+	testCases := []struct {
+		name     string
+		message  []byte
+		resolver TXTResolver
+		expected []string
+	}{
+		{"Zone file", message, zone, []string{"pass", "pass"}},
+		{"JSON keys", message, keys, []string{"pass", "pass"}},
+		{"LF line endings", lf, zone, []string{"pass", "pass"}},
+		{
+			// relaxed body canonicalization ignores changes to whitespace
+			name:     "Whitespace changed",
+			message:  bytes.Replace(message, []byte("tabs \r\n"), []byte("tabs\r\n"), 1),
+			resolver: zone,
+			expected: []string{"pass", "fail: body hash does not match"},
+		},
+		{
+			name:     "Subject changed",
+			message:  bytes.Replace(message, []byte("Subject: =?UTF-8?B?44GK55+l44KJ44Gb?="), []byte("Subject: hello"), 1),
+			resolver: zone,
+			expected: []string{"fail: signature does not verify", "fail: signature does not verify"},
+		},
+		{
+			name:     "Folding changed",
+			message:  bytes.Replace(message, []byte("To: hanako@example.com"), []byte("To:  hanako@example.com"), 1),
+			resolver: zone,
+			expected: []string{"pass", "fail: signature does not verify"},
+		},
+		{
+			name:     "No keys",
+			message:  message,
+			resolver: TXTRecords{},
+			expected: []string{"permerror: no key for ed2024._domainkey.example.jp", "permerror: no key for rsa2024._domainkey.example.jp"},
+		},
+		{
+			name:     "Revoked key",
+			message:  message,
+			resolver: TXTRecords{"ed2024._domainkey.example.jp": {"v=DKIM1; k=ed25519; p="}, "rsa2024._domainkey.example.jp": {"v=DKIM1; p=" + strings.Repeat("A", 8)}},
+			expected: []string{"permerror: key ed2024._domainkey.example.jp: key has been revoked", "permerror: key rsa2024._domainkey.example.jp: p= is not an RSA public key"},
+		},
+		{
+			name:     "Key type mismatch",
+			message:  message,
+			resolver: TXTRecords{"ed2024._domainkey.example.jp": zone["rsa2024._domainkey.example.jp"], "rsa2024._domainkey.example.jp": zone["ed2024._domainkey.example.jp"]},
+			expected: []string{"permerror: a=ed25519-sha256 does not match the rsa key", "permerror: a=rsa-sha256 does not match the ed25519 key"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := VerifyDKIM(tc.message, tc.resolver)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, result := range results {
+				status := result.Status
+				if result.Err != nil {
+					status += ": " + result.Err.Error()
+				}
+				got = append(got, status)
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.expected, "\n") {
+				t.Errorf("expected\n%s\ngot\n%s", strings.Join(tc.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseDKIMSignature(t *testing.T) {
+	valid := "v=1; a=rsa-sha256; d=example.jp; s=sel; h=From:To; bh=AAAA; b=AA\r\n AA"
+	sig, err := ParseDKIMSignature(valid)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sig.Canonicalization() != "simple/simple" || sig.Identity != "@example.jp" || sig.BodyLength != -1 || len(sig.Signature) != 3 {
+		t.Errorf("unexpected signature %+v", sig)
+	}
+
+	testCases := []struct {
+		input       string
+		expectedErr string
+	}{
+		{"v=1; a=rsa-sha256; d=example.jp; h=from; bh=; b=", "missing tag s="},
+		{"v=2; a=rsa-sha256; d=example.jp; s=sel; h=from; bh=; b=", "unsupported version v=2"},
+		{"v=1; a=rsa-sha256; d=example.jp; s=sel; h=to; bh=; b=", "h= does not include From"},
+		{"v=1; a=rsa-sha256; d=example.jp; s=sel; h=from; bh=; b=; c=fancy", "unknown canonicalization c=fancy"},
+		{"v=1; a=rsa-sha256; d=example.jp; s=sel; h=from; bh=; b=; i=@example.com", "i=@example.com is not in the domain d=example.jp"},
+		{"v=1; a=rsa-sha256; d=example.jp; s=sel; h=from; bh=; b=; l=x", "invalid l=x"},
+		{"v=1; v=1", "duplicate tag v="},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expectedErr, func(t *testing.T) {
+			_, err := ParseDKIMSignature(tc.input)
+			if err == nil || err.Error() != tc.expectedErr {
+				t.Errorf("expected error %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeBody(t *testing.T) {
+	testCases := []struct {
+		body    string
+		simple  string
+		relaxed string
+	}{
+		{"", "\r\n", ""},
+		{"\r\n\r\n", "\r\n", ""},
+		{"a  b \t\r\nc\r\n\r\n", "a  b \t\r\nc\r\n", "a b\r\nc\r\n"},
+		{"no newline", "no newline\r\n", "no newline\r\n"},
+	}
+	for _, tc := range testCases {
+		if got := string(CanonicalizeBody([]byte(tc.body), CanonSimple)); got != tc.simple {
+			t.Errorf("simple %q: expected %q, got %q", tc.body, tc.simple, got)
+		}
+		if got := string(CanonicalizeBody([]byte(tc.body), CanonRelaxed)); got != tc.relaxed {
+			t.Errorf("relaxed %q: expected %q, got %q", tc.body, tc.relaxed, got)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSignedHeaders are the fields signed when no list is given, of
+// which those present in the message are used.
+var DefaultSignedHeaders = []string{
+	"from", "reply-to", "subject", "date", "to", "cc", "message-id",
+	"in-reply-to", "references", "mime-version", "content-type",
+	"content-transfer-encoding",
+}
+
+// DKIMOptions configure SignDKIM.
+type DKIMOptions struct {
+	Domain   string
+	Selector string
+	Key      crypto.Signer
+	// HeaderCanon and BodyCanon default to relaxed.
+	HeaderCanon string
+	BodyCanon   string
+	// Headers lists the fields to sign; DefaultSignedHeaders if empty.
+	Headers []string
+	// OverSign signs every field once more than it occurs, so that an
+	// instance added later breaks the signature.
+	OverSign bool
+	// BodyLength adds l= with the length of the canonicalized body.
+	BodyLength bool
+	// Identity is the i= value, if any.
+	Identity string
+	// Timestamp and Expiration are the t= and x= values, if not zero.
+	Timestamp  time.Time
+	Expiration time.Time
+}
+
+// LoadDKIMKey reads a private key for signing: a PEM encoded PKCS #8 RSA
+// or Ed25519 key, a PKCS #1 RSA key, or the base64 Ed25519 seed used by
+// some signers.
+func LoadDKIMKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err == nil && len(seed) == ed25519.SeedSize {
+			return ed25519.NewKeyFromSeed(seed), nil
+		}
+		return nil, fmt.Errorf("%s: no PEM encoded key found", path)
+	}
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("%s: RSA key of %d bits is too short", path, key.N.BitLen())
+		}
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+}
+
+// signingAlgorithm returns the a= value for a key.
+func signingAlgorithm(key crypto.Signer) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return "rsa-sha256", nil
+	case ed25519.PrivateKey:
+		return "ed25519-sha256", nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+// SignDKIM signs a message and returns it with the DKIM-Signature field
+// added on top. The field is folded to lines of at most 78 characters and
+// uses the line endings of the message.
+func SignDKIM(message []byte, opts DKIMOptions) ([]byte, error) {
+	field, err := DKIMSignatureField(message, opts)
+	if err != nil {
+		return nil, err
+	}
+	return prependFields(message, field), nil
+}
+
+// prependFields adds fields, which end in CRLF, on top of a message, with
+// the line endings of the message.
+func prependFields(message []byte, fields string) []byte {
+	if !bytes.Contains(message, []byte("\r\n")) {
+		fields = strings.ReplaceAll(fields, "\r\n", "\n")
+	}
+	return append([]byte(fields), message...)
+}
+
+// DKIMSignatureField returns the DKIM-Signature field, ending in CRLF, for
+// a message.
+func DKIMSignatureField(message []byte, opts DKIMOptions) (string, error) {
+	fields, body, err := splitMessage(message)
+	if err != nil {
+		return "", err
+	}
+	return signatureField("DKIM-Signature", "v=1;", DefaultSignedHeaders, fields, body, opts)
+}
+
+// signatureField signs the fields and body of a message with a field of
+// the given name, whose first tag is first, signing the fields of defaults
+// unless opts lists them. The ARC-Message-Signature is a DKIM-Signature
+// starting with i= instead of v=.
+func signatureField(name, first string, defaults []string, fields []rawField, body []byte, opts DKIMOptions) (string, error) {
+	if opts.Domain == "" || opts.Selector == "" {
+		return "", fmt.Errorf("a domain and a selector are required")
+	}
+	if opts.Key == nil {
+		return "", fmt.Errorf("a private key is required")
+	}
+	if opts.Identity != "" {
+		if err := checkIdentity(opts.Identity, opts.Domain); err != nil {
+			return "", err
+		}
+	}
+	algorithm, err := signingAlgorithm(opts.Key)
+	if err != nil {
+		return "", err
+	}
+	headerCanon, bodyCanon := opts.HeaderCanon, opts.BodyCanon
+	if headerCanon == "" {
+		headerCanon = CanonRelaxed
+	}
+	if bodyCanon == "" {
+		bodyCanon = CanonRelaxed
+	}
+	for _, canon := range []string{headerCanon, bodyCanon} {
+		if canon != CanonSimple && canon != CanonRelaxed {
+			return "", fmt.Errorf("canonicalization must be simple or relaxed, not %q", canon)
+		}
+	}
+
+	names := signedHeaderNames(fields, opts.Headers, defaults, opts.OverSign)
+	signsFrom := false
+	for _, name := range names {
+		signsFrom = signsFrom || name == "from"
+	}
+	if !signsFrom {
+		return "", fmt.Errorf("the signed headers must include From")
+	}
+
+	canonical := CanonicalizeBody(body, bodyCanon)
+	bh := crypto.SHA256.New()
+	bh.Write(canonical)
+
+	f := &fieldFolder{}
+	f.b.WriteString(name + ":")
+	f.col = f.b.Len()
+	f.tag(first)
+	f.tag("a=" + algorithm + ";")
+	f.tag("c=" + headerCanon + "/" + bodyCanon + ";")
+	f.tag("d=" + opts.Domain + ";")
+	f.tag("s=" + opts.Selector + ";")
+	if opts.Identity != "" {
+		f.tag("i=" + opts.Identity + ";")
+	}
+	if !opts.Timestamp.IsZero() {
+		f.tag("t=" + strconv.FormatInt(opts.Timestamp.Unix(), 10) + ";")
+	}
+	if !opts.Expiration.IsZero() {
+		f.tag("x=" + strconv.FormatInt(opts.Expiration.Unix(), 10) + ";")
+	}
+	if opts.BodyLength {
+		f.tag("l=" + strconv.Itoa(len(canonical)) + ";")
+	}
+	for i, name := range names {
+		switch {
+		case len(names) == 1:
+			f.tag("h=" + name + ";")
+		case i == 0:
+			f.tag("h=" + name + ":")
+		case i == len(names)-1:
+			f.word(name + ";")
+		default:
+			f.word(name + ":")
+		}
+	}
+	f.tag("bh=" + base64.StdEncoding.EncodeToString(bh.Sum(nil)) + ";")
+	f.tag("b=")
+
+	unsigned := rawField{Name: name, Raw: f.b.String() + "\r\n"}
+	digest := headerHash(fields, names, unsigned, headerCanon, crypto.SHA256)
+	signature, err := signDigest(opts.Key, digest)
+	if err != nil {
+		return "", err
+	}
+	f.value(base64.StdEncoding.EncodeToString(signature))
+	return f.b.String() + "\r\n", nil
+}
+
+// signDigest signs the SHA-256 hash of the signed data.
+func signDigest(key crypto.Signer, digest []byte) ([]byte, error) {
+	if key, ok := key.(ed25519.PrivateKey); ok {
+		// RFC 8463 signs the hash with PureEdDSA
+		return ed25519.Sign(key, digest), nil
+	}
+	return key.Sign(rand.Reader, digest, crypto.SHA256)
+}
+
+// signedHeaderNames returns the h= list: the requested names, or those of
+// defaults present in the message, each repeated for every instance
+// of the field and, when overSign is set, once more.
+func signedHeaderNames(fields []rawField, requested, defaults []string, overSign bool) []string {
+	counts := map[string]int{}
+	for _, field := range fields {
+		counts[strings.ToLower(field.Name)]++
+	}
+	explicit := len(requested) > 0
+	if !explicit {
+		requested = defaults
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range requested {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		n := counts[name]
+		if n == 0 && !explicit {
+			continue
+		}
+		if n == 0 || overSign {
+			// a missing field signed as empty also keeps one from being added
+			n++
+		}
+		for i := 0; i < n; i++ {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fieldFolder writes a header field, folding it before a word that would
+// make the line longer than maxLineLength.
+type fieldFolder struct {
+	b   strings.Builder
+	col int
+}
+
+func (f *fieldFolder) fold() {
+	f.b.WriteString("\r\n\t")
+	f.col = 1
+}
+
+// tag writes a tag=value, separated from the previous one by a space.
+func (f *fieldFolder) tag(s string) {
+	if f.col+1+len(s) > maxLineLength {
+		f.fold()
+	} else {
+		f.b.WriteByte(' ')
+		f.col++
+	}
+	f.b.WriteString(s)
+	f.col += len(s)
+}
+
+// word writes s directly after what precedes it, as in a list of names.
+func (f *fieldFolder) word(s string) {
+	if f.col+len(s) > maxLineLength {
+		f.fold()
+	}
+	f.b.WriteString(s)
+	f.col += len(s)
+}
+
+// value writes a base64 value, breaking it wherever a line is full.
+func (f *fieldFolder) value(s string) {
+	for len(s) > 0 {
+		room := maxLineLength - f.col
+		if room <= 0 {
+			f.fold()
+			continue
+		}
+		if room > len(s) {
+			room = len(s)
+		}
+		f.b.WriteString(s[:room])
+		f.col += room
+		s = s[room:]
+	}
+}
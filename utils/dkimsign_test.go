@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignDKIM(t *testing.T) {
+	message, err := os.ReadFile("../test_files/simple.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadZoneFile("../test_files/dkim.zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := LoadDKIMKey("../test_files/dkim-rsa.pem")
+	if err != nil {
+		t.Fatalf("failed to load the RSA key: %v", err)
+	}
+	edKey, err := LoadDKIMKey("../test_files/dkim-ed25519.pem")
+	if err != nil {
+		t.Fatalf("failed to load the Ed25519 key: %v", err)
+	}
+	rsaOpts := DKIMOptions{Domain: "example.jp", Selector: "rsa2024", Key: rsaKey}
+	edOpts := DKIMOptions{Domain: "example.jp", Selector: "ed2024", Key: edKey}
+
+	withCanon := func(opts DKIMOptions, header, body string) DKIMOptions {
+		opts.HeaderCanon, opts.BodyCanon = header, body
+		return opts
+	}
+	testCases := []struct {
+		name   string
+		opts   DKIMOptions
+		modify func([]byte) []byte
+		status string
+	}{
+		{"RSA relaxed", rsaOpts, nil, DKIMPass},
+		{"RSA simple", withCanon(rsaOpts, CanonSimple, CanonSimple), nil, DKIMPass},
+		{"Ed25519 relaxed/simple", withCanon(edOpts, CanonRelaxed, CanonSimple), nil, DKIMPass},
+		{
+			name:   "Added From",
+			opts:   rsaOpts,
+			modify: func(b []byte) []byte { return append([]byte("From: evil@example.com\r\n"), b...) },
+			status: DKIMPass,
+		},
+		{
+			name:   "Added From over-signed",
+			opts:   DKIMOptions{Domain: "example.jp", Selector: "rsa2024", Key: rsaKey, OverSign: true},
+			modify: func(b []byte) []byte { return append([]byte("From: evil@example.com\r\n"), b...) },
+			status: DKIMFail,
+		},
+		{
+			name:   "Appended body",
+			opts:   edOpts,
+			modify: func(b []byte) []byte { return append(b, "appended\r\n"...) },
+			status: DKIMFail,
+		},
+		{
+			name:   "Appended body with l=",
+			opts:   DKIMOptions{Domain: "example.jp", Selector: "ed2024", Key: edKey, BodyLength: true},
+			modify: func(b []byte) []byte { return append(b, "appended\r\n"...) },
+			status: DKIMPass,
+		},
+		{
+			name: "Timestamps and identity",
+			opts: DKIMOptions{
+				Domain: "example.jp", Selector: "ed2024", Key: edKey, Identity: "noreply@mail.example.jp",
+				Timestamp: time.Now(), Expiration: time.Now().Add(time.Hour),
+			},
+			status: DKIMPass,
+		},
+		{
+			name: "Expired",
+			opts: DKIMOptions{
+				Domain: "example.jp", Selector: "ed2024", Key: edKey,
+				Timestamp: time.Now().Add(-2 * time.Hour), Expiration: time.Now().Add(-time.Hour),
+			},
+			status: DKIMPermError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			signed, err := SignDKIM(message, tc.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, line := range strings.Split(string(signed[:bytes.Index(signed, message)]), "\n") {
+				if len(strings.TrimSuffix(line, "\r")) > maxLineLength {
+					t.Errorf("line longer than %d characters: %s", maxLineLength, line)
+				}
+			}
+			if tc.modify != nil {
+				signed = tc.modify(signed)
+			}
+			results, err := VerifyDKIM(signed, keys)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(results) != 1 || results[0].Status != tc.status {
+				t.Errorf("expected %s, got %+v", tc.status, results)
+			}
+		})
+	}
+}
+
+func TestSignDKIMHeaders(t *testing.T) {
+	key, err := LoadDKIMKey("../test_files/dkim-ed25519.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("From: a@example.jp\nTo: b@example.jp\nTo: c@example.jp\nSubject: hi\n\nbody\n")
+
+	testCases := []struct {
+		name     string
+		headers  []string
+		overSign bool
+		expected string
+	}{
+		{"Default", nil, false, "from:subject:to:to"},
+		{"Over-signed", nil, true, "from:from:subject:subject:to:to:to"},
+		{"Requested", []string{"From", "Reply-To", "to"}, false, "from:reply-to:to:to"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := DKIMOptions{Domain: "example.jp", Selector: "ed2024", Key: key, Headers: tc.headers, OverSign: tc.overSign}
+			signed, err := SignDKIM(message, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if bytes.Contains(signed, []byte("\r\n")) {
+				t.Errorf("expected the LF line endings of the message to be kept")
+			}
+			fields, _, err := splitMessage(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := ParseDKIMSignature(fields[0].Value())
+			if err != nil {
+				t.Fatalf("failed to parse the signature: %v", err)
+			}
+			if got := strings.Join(sig.Headers, ":"); got != tc.expected {
+				t.Errorf("expected h=%s, got h=%s", tc.expected, got)
+			}
+		})
+	}
+
+	_, err = SignDKIM(message, DKIMOptions{Domain: "example.jp", Selector: "ed2024", Key: key, Headers: []string{"subject"}})
+	if err == nil || err.Error() != "the signed headers must include From" {
+		t.Errorf("expected an error without From, got %v", err)
+	}
+	_, err = SignDKIM(message, DKIMOptions{Domain: "example.jp", Selector: "ed2024", Key: key, Identity: "a@example.jp.evil"})
+	if err == nil || err.Error() != "i=a@example.jp.evil is not in the domain d=example.jp" {
+		t.Errorf("expected an error for an identity outside the domain, got %v", err)
+	}
+}
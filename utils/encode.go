@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+)
+
+const (
+	// maxEncodedWordLength is the longest encoded-word allowed by RFC 2047.
+	maxEncodedWordLength = 75
+	// maxLineLength is the line length RFC 5322 asks header lines to stay within.
+	maxLineLength = 78
+)
+
+// EncodeHeader encodes s as a sequence of encoded-words separated by single
+// spaces. Each word holds whole characters, is at most 75 characters long and,
+// for ISO-2022-JP, starts and ends in ASCII with its own escape sequences.
+func EncodeHeader(s, charset, encoding string) (string, error) {
+	words, err := encodeWords(s, charset, encoding, maxEncodedWordLength, false)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(words, " "), nil
+}
+
+// EncodeHeaderField encodes s like EncodeHeader and returns a complete
+// "Name: value" header field folded so that no line exceeds 78 characters.
+// Address headers such as From and To are encoded with EncodeAddressList
+// rules instead.
+func EncodeHeaderField(name, s, charset, encoding string) (string, error) {
+	// room left on the first line after "Name: "
+	first := maxLineLength - len(name) - 2
+	if first > maxEncodedWordLength {
+		first = maxEncodedWordLength
+	}
+	var words []string
+	var err error
+	if IsAddressHeader(name) {
+		words, err = encodeAddressWords(s, charset, encoding, first)
+	} else {
+		words, err = encodeWords(s, charset, encoding, first, false)
+	}
+	if err != nil {
+		return "", err
+	}
+	return FoldHeader(name, words), nil
+}
+
+// FoldHeader joins words into a "Name: value" header field, starting a new
+// continuation line whenever the next word would pass 78 characters.
+func FoldHeader(name string, words []string) string {
+	var b strings.Builder
+	b.WriteString(name + ":")
+	lineLength := len(name) + 1
+	for _, word := range words {
+		if lineLength+1+len(word) > maxLineLength {
+			b.WriteString("\r\n")
+			lineLength = 0
+		}
+		b.WriteString(" " + word)
+		lineLength += 1 + len(word)
+	}
+	return b.String()
+}
+
+// encodeWords splits s on character boundaries into encoded-words. The first
+// word is kept within first characters when possible and the rest within 75.
+// Text that needs no encoding is returned as its space-separated words.
+// Words for a phrase or comment use the stricter Q encoding RFC 2047
+// section 5 asks for there.
+func encodeWords(s, charset, encoding string, first int, phrase bool) ([]string, error) {
+	mappedCharset, enc, err := LookupCharset(charset)
+	if err != nil {
+		return nil, err
+	}
+	upperEncoding := strings.ToUpper(encoding)
+	if upperEncoding != "B" && upperEncoding != "Q" {
+		return nil, fmt.Errorf("invalid encoding")
+	}
+	// check the whole text once so that unmappable characters are reported
+	// before any splitting happens
+	losses, err := unmappableRunes(s, charset)
+	if err != nil {
+		return nil, err
+	}
+	if len(losses) > 0 {
+		return nil, &UnmappableError{Charset: mappedCharset, Rune: losses[0].Rune, Offset: losses[0].Offset}
+	}
+	if !needsEncoding(s) {
+		return strings.Split(s, " "), nil
+	}
+
+	prefix := "=?" + mappedCharset + "?" + strings.ToLower(upperEncoding) + "?"
+	// the offsets where the characters of s start, and its end
+	bounds := make([]int, 0, len(s)+1)
+	for i := range s {
+		bounds = append(bounds, i)
+	}
+	bounds = append(bounds, len(s))
+
+	limit := first
+	var words []string
+	for start := 0; start < len(bounds)-1; {
+		var err error
+		fits := func(n int) bool {
+			encoded, encodeErr := encodeWord(prefix, s[bounds[start]:bounds[start+n]], enc, upperEncoding, phrase)
+			if encodeErr != nil {
+				err = encodeErr
+				return false
+			}
+			return len(encoded) <= limit
+		}
+		// an encoded-word never gets shorter as characters are added, so the
+		// count is doubled until the word is too long and the last step is
+		// searched; this keeps the work in proportion to the word
+		rest := len(bounds) - 1 - start
+		fitting, tooLong := 0, 1
+		for tooLong <= rest && fits(tooLong) {
+			fitting, tooLong = tooLong, tooLong*2
+		}
+		if tooLong > rest {
+			tooLong = rest + 1
+		}
+		count := fitting + sort.Search(tooLong-fitting-1, func(n int) bool { return !fits(fitting + n + 1) })
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			if limit != maxEncodedWordLength {
+				// not even one character fits on the first line; give up the
+				// first line budget and let folding move the word down
+				limit = maxEncodedWordLength
+				continue
+			}
+			count = 1
+		}
+		end := start + count
+		word, err := encodeWord(prefix, s[bounds[start]:bounds[end]], enc, upperEncoding, phrase)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+		limit = maxEncodedWordLength
+		start = end
+	}
+	return words, nil
+}
+
+// encodeWord converts text with enc and wraps it in a single encoded-word.
+func encodeWord(prefix, text string, enc encoding.Encoding, wordEncoding string, phrase bool) (string, error) {
+	encodedBytes, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		return "", err
+	}
+	if wordEncoding == "B" {
+		return prefix + base64.StdEncoding.EncodeToString(encodedBytes) + "?=", nil
+	}
+	return prefix + qEncode(encodedBytes, phrase) + "?=", nil
+}
+
+// qEncode applies the Q encoding of RFC 2047 section 4.2. In a phrase only
+// letters, digits and "!*+-/" may appear as is.
+func qEncode(b []byte, phrase bool) string {
+	const upperhex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for _, c := range b {
+		switch {
+		case c == ' ':
+			sb.WriteByte('_')
+		case phrase && !isPhraseSafe(c):
+			sb.WriteByte('=')
+			sb.WriteByte(upperhex[c>>4])
+			sb.WriteByte(upperhex[c&0x0f])
+		case c >= '!' && c <= '~' && c != '=' && c != '?' && c != '_':
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte('=')
+			sb.WriteByte(upperhex[c>>4])
+			sb.WriteByte(upperhex[c&0x0f])
+		}
+	}
+	return sb.String()
+}
+
+func isPhraseSafe(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("!*+-/", c) >= 0
+}
+
+// needsEncoding reports whether s contains characters that cannot appear in
+// a header as is, or something that would be mistaken for an encoded-word.
+func needsEncoding(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < ' ' || c > '~') && c != '\t' {
+			return true
+		}
+	}
+	return containsEncodedWord(s)
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ProtonMail/go-mime"
+)
+
+func TestEncodeHeader(t *testing.T) {
+	long := "【重要】来週の定例会議の議題と資料についてのご案内および出欠確認のお願い（至急）"
+	testCases := []struct {
+		name     string
+		input    string
+		charset  string
+		encoding string
+		expected string
+	}{
+		{
+			name:     "Short UTF-8",
+			input:    "こんにちは",
+			charset:  "utf8",
+			encoding: "B",
+			expected: "=?UTF-8?b?44GT44KT44Gr44Gh44Gv?=",
+		},
+		{
+			name:     "Short ISO-2022-JP",
+			input:    "こんにちは",
+			charset:  "iso2022jp",
+			encoding: "B",
+			expected: "=?ISO-2022-JP?b?GyRCJDMkcyRLJEEkTxsoQg==?=",
+		},
+		{
+			name:     "ASCII only",
+			input:    "Hello world",
+			charset:  "utf8",
+			encoding: "Q",
+			expected: "Hello world",
+		},
+		{name: "Long ISO-2022-JP B", input: long, charset: "iso2022jp", encoding: "B"},
+		{name: "Long ISO-2022-JP Q", input: long, charset: "iso2022jp", encoding: "Q"},
+		{name: "Long Shift_JIS B", input: long, charset: "shiftjis", encoding: "B"},
+		{name: "Long UTF-8 Q", input: long, charset: "utf8", encoding: "Q"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded, err := EncodeHeader(tc.input, tc.charset, tc.encoding)
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			if tc.expected != "" && encoded != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, encoded)
+			}
+			for _, word := range strings.Split(encoded, " ") {
+				if len(word) > maxEncodedWordLength {
+					t.Fatalf("encoded-word longer than %d characters: %s", maxEncodedWordLength, word)
+				}
+				// every word must decode on its own
+				if _, err := gomime.DecodeHeader(word); err != nil {
+					t.Fatalf("failed to decode %s: %v", word, err)
+				}
+				if tc.charset == "iso2022jp" && tc.encoding == "B" && !strings.HasPrefix(word, "=?ISO-2022-JP?b?GyRC") {
+					t.Fatalf("encoded-word does not start with an escape sequence: %s", word)
+				}
+			}
+			decoded, err := gomime.DecodeHeader(encoded)
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if decoded != tc.input {
+				t.Fatalf("expected round trip to give %s, got %s", tc.input, decoded)
+			}
+		})
+	}
+}
+
+func TestEncodeWordsFill(t *testing.T) {
+	long := strings.Repeat("【重要】来週の定例会議についてのご案内 ", 20)
+	for _, charset := range []string{"iso2022jp", "shiftjis", "utf8"} {
+		for _, encoding := range []string{"B", "Q"} {
+			words, err := encodeWords(long, charset, encoding, 30, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, enc, _ := LookupCharset(charset)
+			prefix := words[0][:strings.LastIndex(words[0][:len(words[0])-2], "?")+1]
+			rest := long
+			for i, word := range words {
+				limit := maxEncodedWordLength
+				if i == 0 {
+					limit = 30
+				}
+				if len(word) > limit {
+					t.Fatalf("%s %s: word %d is longer than %d: %s", charset, encoding, i, limit, word)
+				}
+				text, err := gomime.DecodeHeader(word)
+				if err != nil || !strings.HasPrefix(rest, text) {
+					t.Fatalf("%s %s: word %d decodes to %q, %v", charset, encoding, i, text, err)
+				}
+				rest = rest[len(text):]
+				if rest == "" {
+					break
+				}
+				// the word takes as many characters as fit
+				_, size := utf8.DecodeRuneInString(rest)
+				if longer, _ := encodeWord(prefix, text+rest[:size], enc, encoding, false); len(longer) <= limit {
+					t.Fatalf("%s %s: word %d could also hold %q", charset, encoding, i, rest[:size])
+				}
+			}
+			if rest != "" {
+				t.Fatalf("%s %s: %q is not encoded", charset, encoding, rest)
+			}
+		}
+	}
+}
+
+func TestEncodeHeaderField(t *testing.T) {
+	input := "【重要】来週の定例会議の議題と資料についてのご案内および出欠確認のお願い（至急）"
+	for _, name := range []string{"Subject", "X-A-Very-Long-Header-Name-That-Leaves-Little-Room-On-The-First-Line"} {
+		t.Run(name, func(t *testing.T) {
+			field, err := EncodeHeaderField(name, input, "iso2022jp", "B")
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			if !strings.HasPrefix(field, name+":") {
+				t.Fatalf("expected field to start with %s:, got %s", name, field)
+			}
+			lines := strings.Split(field, "\r\n")
+			if len(lines) < 2 {
+				t.Fatalf("expected folded field, got %s", field)
+			}
+			for _, line := range lines {
+				if len(line) > maxLineLength {
+					t.Fatalf("line longer than %d characters: %s", maxLineLength, line)
+				}
+			}
+			decoded, err := gomime.DecodeHeader(strings.TrimPrefix(strings.ReplaceAll(field, "\r\n", ""), name+":"))
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if strings.TrimSpace(decoded) != input {
+				t.Fatalf("expected round trip to give %s, got %s", input, decoded)
+			}
+		})
+	}
+}
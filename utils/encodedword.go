@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"regexp"
+
+	"github.com/ProtonMail/go-mime"
+)
+
+// EncodedWord is a single RFC 2047 encoded-word found in a header value.
+// Offset is the byte offset of the word within the value.
+type EncodedWord struct {
+	Word     string
+	Charset  string
+	Encoding string
+	Text     string
+	Decoded  string
+	Offset   int
+	Err      error
+}
+
+// encodedWord is the RFC 2047 encoded-word syntax shared by the decoder and
+// the encoder: the charset is a token without especials, with
+// an optional RFC 2231 language suffix, the encoding is B or Q in either
+// case, and the encoded-text is printable ASCII other than "?".
+const encodedWord = `=\?([A-Za-z0-9!#$%&'*+\-^_` + "`" + `{|}~]+)\?([BbQq])\?([!->@-~]*)\?=`
+
+var (
+	encodedWordPattern     = regexp.MustCompile(encodedWord)
+	fullEncodedWordPattern = regexp.MustCompile(`^` + encodedWord + `$`)
+)
+
+// IsEncodedWord reports whether s is exactly one encoded-word.
+func IsEncodedWord(s string) bool {
+	return fullEncodedWordPattern.MatchString(s)
+}
+
+func containsEncodedWord(s string) bool {
+	return encodedWordPattern.MatchString(s)
+}
+
+// ParseEncodedWords returns every encoded-word in s, each decoded on its own
+// so that a broken word does not hide the others.
+func ParseEncodedWords(s string) []EncodedWord {
+	var words []EncodedWord
+	for _, match := range encodedWordPattern.FindAllStringSubmatchIndex(s, -1) {
+		word := EncodedWord{
+			Word:     s[match[0]:match[1]],
+			Charset:  s[match[2]:match[3]],
+			Encoding: s[match[4]:match[5]],
+			Text:     s[match[6]:match[7]],
+			Offset:   match[0],
+		}
+		word.Decoded, word.Err = gomime.DecodeHeader(word.Word)
+		words = append(words, word)
+	}
+	return words
+}
+
+// DecodeValue returns a header value with its encoded-words decoded, or the
+// value as it is when they cannot be decoded.
+func DecodeValue(raw string) string {
+	if !containsEncodedWord(raw) {
+		return raw
+	}
+	decoded, err := gomime.DecodeHeader(raw)
+	if err != nil {
+		return raw
+	}
+	return decoded
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// SanitizeFilename turns a filename taken from a message into a safe name
+// for the local file system. Directory components are dropped so that names
+// like "../../.bashrc" cannot escape the target directory, and characters
+// that are unsafe on common file systems are replaced with "_".
+func SanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsControl(r), strings.ContainsRune(`<>:"|?*`, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	// leading dots would make a hidden file or ".." itself
+	return strings.TrimLeft(strings.TrimSpace(b.String()), ".")
+}
+
+// preferredExtensions overrides mime.ExtensionsByType, which sorts its
+// result and so may suggest ".asc" for text/plain.
+var preferredExtensions = map[string]string{
+	"text/plain":     ".txt",
+	"text/html":      ".html",
+	"message/rfc822": ".eml",
+}
+
+// DefaultFilename returns a name for a part that has none, built from its
+// index path and an extension for its media type.
+func DefaultFilename(part *Part) string {
+	name := "part"
+	if part.Path != "" {
+		name += "-" + part.Path
+	}
+	if ext, ok := preferredExtensions[part.MediaType]; ok {
+		return name + ext
+	}
+	if extensions, err := mime.ExtensionsByType(part.MediaType); err == nil && len(extensions) > 0 {
+		return name + extensions[0]
+	}
+	return name + ".bin"
+}
+
+// UniqueFilename returns name, or name with a counter such as "a (1).pdf",
+// so that it clashes neither with a file in dir nor with a name in taken.
+func UniqueFilename(dir, name string, taken map[string]bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 1; ; i++ {
+		if !taken[candidate] {
+			if _, err := os.Lstat(filepath.Join(dir, candidate)); os.IsNotExist(err) {
+				return candidate
+			}
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "請求書.pdf", expected: "請求書.pdf"},
+		{input: "../../etc/passwd", expected: "passwd"},
+		{input: `..\..\Windows\win.ini`, expected: "win.ini"},
+		{input: "/absolute/path.txt", expected: "path.txt"},
+		{input: "..", expected: ""},
+		{input: ".bashrc", expected: "bashrc"},
+		{input: "a:b*c?.txt", expected: "a_b_c_.txt"},
+		{input: "tab\tname.txt", expected: "tab_name.txt"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			if sanitized := SanitizeFilename(tc.input); sanitized != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, sanitized)
+			}
+		})
+	}
+}
+
+func TestUniqueFilename(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.pdf"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	taken := map[string]bool{"a (1).pdf": true}
+
+	if name := UniqueFilename(dir, "a.pdf", taken); name != "a (2).pdf" {
+		t.Fatalf("expected a (2).pdf, got %s", name)
+	}
+	if name := UniqueFilename(dir, "b.pdf", taken); name != "b.pdf" {
+		t.Fatalf("expected b.pdf, got %s", name)
+	}
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// HasGlobMeta reports whether pattern contains glob metacharacters.
+func HasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[`)
+}
+
+// IsGlob reports whether name is a glob pattern to expand rather than a
+// path: it has glob metacharacters and no file of that name exists, so that
+// a file such as "report[1].eml" is still read as it is.
+func IsGlob(name string) bool {
+	if !HasGlobMeta(name) {
+		return false
+	}
+	_, err := os.Stat(name)
+	return os.IsNotExist(err)
+}
+
+// WalkError is a file or directory that could not be read during a walk.
+type WalkError struct {
+	Path string
+	Err  error
+}
+
+func (e *WalkError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *WalkError) Unwrap() error {
+	return e.Err
+}
+
+// skipUnreadable records err for the entry at p of a walk from root and
+// returns what lets the walk go on without it. An error at root itself is
+// returned, as there is nothing else to walk.
+func skipUnreadable(root, p string, d fs.DirEntry, err error, skipped *[]*WalkError) error {
+	if p == root {
+		return err
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	*skipped = append(*skipped, &WalkError{Path: p, Err: err})
+	if d != nil && d.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+// Glob returns the regular files matching pattern in lexical order. Besides
+// the syntax of path.Match, a "**" path element matches any number of
+// directories, so "mail/**/*.eml" finds .eml files at any depth under mail.
+// Files and directories that cannot be read do not stop the walk; they are
+// returned in skipped.
+func Glob(pattern string) (files []string, skipped []*WalkError, err error) {
+	pattern = filepath.ToSlash(pattern)
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return nil, nil, err
+	}
+	elements := strings.Split(pattern, "/")
+	// walk from the longest leading path without metacharacters
+	n := 0
+	for n < len(elements)-1 && !HasGlobMeta(elements[n]) {
+		n++
+	}
+	root := strings.Join(elements[:n], "/")
+	switch {
+	case root == "" && strings.HasPrefix(pattern, "/"):
+		root = "/"
+	case root == "":
+		root = "."
+	}
+	rest := elements[n:]
+
+	err = filepath.WalkDir(filepath.FromSlash(root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return skipUnreadable(filepath.FromSlash(root), p, d, err, &skipped)
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(root), p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := strings.Split(filepath.ToSlash(rel), "/")
+		switch {
+		case d.IsDir() && !matchDirectory(rest, name):
+			return filepath.SkipDir
+		case d.Type().IsRegular() && matchElements(rest, name):
+			files = append(files, p)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	return files, skipped, err
+}
+
+// matchElements matches the elements of a path against those of a pattern,
+// letting "**" stand for zero or more elements.
+func matchElements(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchElements(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], name[0]); !matched {
+		return false
+	}
+	return matchElements(pattern[1:], name[1:])
+}
+
+// matchDirectory reports whether files under the directory dir may match
+// pattern, so that other directories need not be walked.
+func matchDirectory(pattern, dir []string) bool {
+	for i, element := range dir {
+		if i < len(pattern) && pattern[i] == "**" {
+			return true
+		}
+		if i >= len(pattern)-1 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[i], element); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// WalkFiles returns the regular files under dir in lexical order, skipping
+// hidden files and directories such as .git. Like Glob, it returns what
+// cannot be read in skipped.
+func WalkFiles(dir string) (files []string, skipped []*WalkError, err error) {
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return skipUnreadable(dir, p, d, err, &skipped)
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, skipped, err
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.eml", "b.txt", "x/c.eml", "x/y/d.eml", "x/y/e.txt", ".hidden/f.eml"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+
+	testCases := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"*.eml", join("a.eml")},
+		{"*/*.eml", join(".hidden/f.eml", "x/c.eml")},
+		{"**/*.eml", join(".hidden/f.eml", "a.eml", "x/c.eml", "x/y/d.eml")},
+		{"x/**/*.txt", join("x/y/e.txt")},
+		{"x/**", join("x/c.eml", "x/y/d.eml", "x/y/e.txt")},
+		{"missing/**/*.eml", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			files, skipped, err := Glob(filepath.Join(dir, tc.pattern))
+			if err != nil || skipped != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(files, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, files)
+			}
+		})
+	}
+
+	if _, _, err := Glob(filepath.Join(dir, "[")); err == nil {
+		t.Fatalf("expected an error for a malformed pattern")
+	}
+
+	files, skipped, err := WalkFiles(dir)
+	if err != nil || skipped != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := join("a.eml", "b.txt", "x/c.eml", "x/y/d.eml", "x/y/e.txt"); !reflect.DeepEqual(files, expected) {
+		t.Fatalf("expected %v, got %v", expected, files)
+	}
+}
+
+func TestWalkUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/1.eml", "b/2.eml", "c/3.eml"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unreadable := filepath.Join(dir, "b")
+	if err := os.Chmod(unreadable, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(unreadable, 0o755)
+	if _, err := os.ReadDir(unreadable); err == nil {
+		t.Skip("directory permissions are not enforced for this user")
+	}
+	expected := []string{filepath.Join(dir, "a", "1.eml"), filepath.Join(dir, "c", "3.eml")}
+
+	check := func(files []string, skipped []*WalkError, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Fatalf("expected %v, got %v", expected, files)
+		}
+		if len(skipped) != 1 || skipped[0].Path != unreadable || !os.IsPermission(skipped[0].Err) {
+			t.Fatalf("expected %s to be skipped, got %v", unreadable, skipped)
+		}
+	}
+	check(Glob(filepath.Join(dir, "**", "*.eml")))
+	check(WalkFiles(dir))
+}
+
+func TestIsGlob(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "report[1].eml")
+	if err := os.WriteFile(existing, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		expected bool
+	}{
+		{existing, false},
+		{filepath.Join(dir, "report[2].eml"), true},
+		{filepath.Join(dir, "*.eml"), true},
+		{filepath.Join(dir, "plain.eml"), false},
+	}
+	for _, tc := range testCases {
+		if got := IsGlob(tc.name); got != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
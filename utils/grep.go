@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"regexp"
+	"regexp/syntax"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MatchOptions control how a HeaderMatcher compares a pattern with header
+// values.
+type MatchOptions struct {
+	// Fixed treats the pattern as a literal string instead of a regexp.
+	Fixed bool
+	// IgnoreCase folds case in both the pattern and the value.
+	IgnoreCase bool
+	// Normalize applies NFKC to both, so that full-width and half-width
+	// forms such as "ＡＢＣ" and "ABC" or "ｶﾞ" and "ガ" match each other.
+	Normalize bool
+}
+
+// HeaderMatcher matches decoded header values against a pattern.
+type HeaderMatcher struct {
+	pattern   *regexp.Regexp
+	normalize bool
+}
+
+// NewHeaderMatcher compiles pattern with the given options.
+func NewHeaderMatcher(pattern string, opts MatchOptions) (*HeaderMatcher, error) {
+	if opts.Fixed {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	if opts.Normalize {
+		// only the literal text is normalized, so that full-width
+		// punctuation such as "（" stays a character to match instead of
+		// turning into regexp syntax
+		re, err := syntax.Parse(pattern, syntax.Perl)
+		if err != nil {
+			return nil, err
+		}
+		normalizeLiterals(re)
+		pattern = re.String()
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &HeaderMatcher{pattern: re, normalize: opts.Normalize}, nil
+}
+
+// normalizeLiterals applies NFKC to the literal strings of a parsed regexp.
+func normalizeLiterals(re *syntax.Regexp) {
+	if re.Op == syntax.OpLiteral {
+		re.Rune = []rune(norm.NFKC.String(string(re.Rune)))
+	}
+	for _, sub := range re.Sub {
+		normalizeLiterals(sub)
+	}
+}
+
+// Match reports whether the decoded value matches.
+func (m *HeaderMatcher) Match(value string) bool {
+	if m.normalize {
+		value = norm.NFKC.String(value)
+	}
+	return m.pattern.MatchString(value)
+}
@@ -0,0 +1,44 @@
+package utils
+
+import "testing"
+
+func TestHeaderMatcher(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pattern  string
+		opts     MatchOptions
+		value    string
+		expected bool
+	}{
+		{"Regexp", "ご飯.*か", MatchOptions{}, "Re: ご飯に行きませんか？", true},
+		{"Regexp does not fold case", "re:", MatchOptions{}, "Re: hello", false},
+		{"Ignore case", "re:", MatchOptions{IgnoreCase: true}, "Re: hello", true},
+		{"Fixed", "a.c", MatchOptions{Fixed: true}, "abc", false},
+		{"Fixed literal", "a.c", MatchOptions{Fixed: true}, "xa.cx", true},
+		{"Full-width without normalize", "ABC", MatchOptions{}, "ＡＢＣ", false},
+		{"Full-width", "ABC", MatchOptions{Normalize: true}, "ＡＢＣ", true},
+		{"Half-width katakana", "ガイド", MatchOptions{Normalize: true}, "ｶﾞｲﾄﾞ", true},
+		{"Full-width pattern", "ｈｅｌｌｏ", MatchOptions{Normalize: true, IgnoreCase: true}, "HELLO", true},
+		{"Full-width parentheses", "（株）", MatchOptions{Normalize: true}, "(株)テスト", true},
+		{"Full-width parentheses are not a group", "（株）", MatchOptions{Normalize: true}, "株式会社テスト", false},
+		{"Full-width parenthesis alone", "（", MatchOptions{Normalize: true}, "（株）", true},
+		{"Enclosed ideograph", "㈱テスト", MatchOptions{Normalize: true}, "（株）テスト", true},
+		{"Regexp with normalize", "ｶﾞ.*ﾄﾞ$", MatchOptions{Normalize: true}, "ガイド", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matcher, err := NewHeaderMatcher(tc.pattern, tc.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := matcher.Match(tc.value); got != tc.expected {
+				t.Fatalf("expected %v for %q against %q, got %v", tc.expected, tc.pattern, tc.value, got)
+			}
+		})
+	}
+
+	if _, err := NewHeaderMatcher("(", MatchOptions{}); err == nil {
+		t.Fatalf("expected an error for an invalid pattern")
+	}
+}
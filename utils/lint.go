@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Problem is a single finding of LintHeader. Column is the one-based byte
+// column in the raw header value where the problem starts.
+type Problem struct {
+	Column  int
+	Word    string
+	Message string
+}
+
+// lintWordPattern is looser than encodedWordPattern so that words with a
+// broken charset or encoding are still found and reported.
+var lintWordPattern = regexp.MustCompile(`=\?([^?\s]*)\?([^?\s]*)\?([^?\s]*)\?=`)
+
+// lintWordStartPattern finds where encoded-words begin, including ones that
+// lintWordPattern misses because they contain whitespace or are unterminated.
+var lintWordStartPattern = regexp.MustCompile(`=\?[^?\s]+\?[BbQq]\?`)
+
+// LintHeader checks every encoded-word in a raw header value against
+// RFC 2047 and returns the problems found, ordered by column.
+func LintHeader(raw string) []Problem {
+	var problems []Problem
+	report := func(offset int, word, format string, args ...interface{}) {
+		problems = append(problems, Problem{Column: offset + 1, Word: word, Message: fmt.Sprintf(format, args...)})
+	}
+
+	quoted := quotedRanges(raw)
+	matches := lintWordPattern.FindAllStringSubmatchIndex(raw, -1)
+
+	starts := make(map[int]bool)
+	for _, match := range matches {
+		starts[match[0]] = true
+	}
+	for _, start := range lintWordStartPattern.FindAllStringIndex(raw, -1) {
+		if !starts[start[0]] {
+			report(start[0], "", "encoded-word is not terminated by \"?=\" or contains whitespace")
+		}
+	}
+	for i, match := range matches {
+		start, end := match[0], match[1]
+		word := raw[start:end]
+		charset := raw[match[2]:match[3]]
+		encoding := raw[match[4]:match[5]]
+		text := raw[match[6]:match[7]]
+
+		if len(word) > maxEncodedWordLength {
+			report(start, word, "encoded-word is %d characters long; the limit is %d", len(word), maxEncodedWordLength)
+		}
+
+		if quoted[start] {
+			report(start, word, "encoded-word inside a quoted-string is not decoded by conforming readers")
+		} else {
+			if start > 0 && !isLinearWhiteSpace(raw[start-1]) && raw[start-1] != '(' {
+				if i > 0 && matches[i-1][1] == start {
+					report(start, word, "encoded-word is not separated from the preceding encoded-word by whitespace")
+				} else {
+					report(start, word, "encoded-word is not separated from the preceding text by whitespace")
+				}
+			}
+			next := i+1 < len(matches) && matches[i+1][0] == end
+			if end < len(raw) && !isLinearWhiteSpace(raw[end]) && raw[end] != ')' && !next {
+				report(end, word, "encoded-word is not separated from the following text by whitespace")
+			}
+		}
+
+		var decoded []byte
+		var offset int
+		var err error
+		switch strings.ToUpper(encoding) {
+		case "B":
+			decoded, offset, err = lintBDecode(text)
+		case "Q":
+			decoded, offset, err = lintQDecode(text)
+		default:
+			report(match[4], word, "unknown encoding %q; must be B or Q", encoding)
+			continue
+		}
+		if err != nil {
+			report(match[6]+offset, word, "%v", err)
+			continue
+		}
+
+		// RFC 2231 allows a language tag after the charset, as in UTF-8*ja
+		charsetName := strings.SplitN(charset, "*", 2)[0]
+		mimeName, enc, err := LookupCharset(charsetName)
+		if err != nil {
+			report(match[2], word, "unknown charset %q", charset)
+			continue
+		}
+		if mimeName == "UTF-8" {
+			if !utf8.Valid(decoded) {
+				report(match[6], word, "bytes are not valid %s", mimeName)
+			}
+			continue
+		}
+		converted, err := enc.NewDecoder().Bytes(decoded)
+		if err != nil || bytes.ContainsRune(converted, utf8.RuneError) {
+			report(match[6], word, "bytes are not valid %s", mimeName)
+			continue
+		}
+		if mimeName == "ISO-2022-JP" && !endsInASCII(decoded) {
+			report(match[6], word, "ISO-2022-JP text does not switch back to ASCII before the end of the encoded-word")
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Column < problems[j].Column
+	})
+	return problems
+}
+
+// lintBDecode decodes B encoded text, returning the offset of the first
+// problem within text on failure.
+func lintBDecode(text string) ([]byte, int, error) {
+	if len(text)%4 != 0 {
+		return nil, 0, errors.New("base64 text is not padded to a multiple of 4 characters")
+	}
+	decoded, err := base64.StdEncoding.Strict().DecodeString(text)
+	if err != nil {
+		var corrupt base64.CorruptInputError
+		if errors.As(err, &corrupt) {
+			offset := int(corrupt)
+			if offset < len(text) && text[offset] == '=' {
+				return nil, offset, errors.New("misplaced base64 padding")
+			}
+			return nil, offset, errors.New("illegal character in base64 text")
+		}
+		return nil, 0, err
+	}
+	return decoded, 0, nil
+}
+
+// lintQDecode decodes Q encoded text, returning the offset of the first
+// problem within text on failure.
+func lintQDecode(text string) ([]byte, int, error) {
+	var decoded []byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '_':
+			decoded = append(decoded, ' ')
+		case c == '=':
+			if i+2 >= len(text) {
+				return nil, i, errors.New("truncated escape sequence in Q text")
+			}
+			b, ok := unhex(text[i+1], text[i+2])
+			if !ok {
+				return nil, i, fmt.Errorf("invalid escape sequence %q in Q text", text[i:i+3])
+			}
+			decoded = append(decoded, b)
+			i += 2
+		case c > ' ' && c <= '~' && c != '?':
+			decoded = append(decoded, c)
+		default:
+			return nil, i, fmt.Errorf("illegal character %q in Q text", c)
+		}
+	}
+	return decoded, 0, nil
+}
+
+func unhex(hi, lo byte) (byte, bool) {
+	var b byte
+	for _, c := range []byte{hi, lo} {
+		b <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			b |= c - '0'
+		case c >= 'A' && c <= 'F':
+			b |= c - 'A' + 10
+		case c >= 'a' && c <= 'f':
+			b |= c - 'a' + 10
+		default:
+			return 0, false
+		}
+	}
+	return b, true
+}
+
+// quotedRanges marks the bytes of s that lie inside a quoted-string.
+func quotedRanges(s string) []bool {
+	quoted := make([]bool, len(s))
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			quoted[i] = true
+			if i+1 < len(s) {
+				quoted[i+1] = true
+			}
+			i++
+			continue
+		case s[i] == '"':
+			inQuote = !inQuote
+		}
+		quoted[i] = inQuote
+	}
+	return quoted
+}
+
+// endsInASCII reports whether ISO-2022-JP bytes are back in ASCII or JIS X
+// 0201 Roman at their end.
+func endsInASCII(b []byte) bool {
+	last := bytes.LastIndexByte(b, 0x1b)
+	if last < 0 {
+		return true
+	}
+	rest := b[last:]
+	return bytes.HasPrefix(rest, []byte("\x1b(B")) || bytes.HasPrefix(rest, []byte("\x1b(J"))
+}
+
+func isLinearWhiteSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,80 @@
+package utils
+
+import "testing"
+
+func TestLintHeader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []Problem
+	}{
+		{
+			name:  "Valid",
+			input: "Re: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?= =?ISO-2022-JP?Q?=1B$B$3$s=1B(B?=",
+		},
+		{
+			name:     "Unknown charset",
+			input:    "=?X-UNKNOWN?B?44GT?=",
+			expected: []Problem{{Column: 3, Message: `unknown charset "X-UNKNOWN"`}},
+		},
+		{
+			name:     "Invalid base64 padding",
+			input:    "=?UTF-8?B?44GT44KT44Gr44Gh44G?=",
+			expected: []Problem{{Column: 11, Message: "base64 text is not padded to a multiple of 4 characters"}},
+		},
+		{
+			name:     "Misplaced base64 padding",
+			input:    "=?UTF-8?B?44GT4=KT?=",
+			expected: []Problem{{Column: 16, Message: "misplaced base64 padding"}},
+		},
+		{
+			name:     "Illegal character in Q text",
+			input:    "=?UTF-8?Q?caf\x7f?=",
+			expected: []Problem{{Column: 14, Message: `illegal character '\x7f' in Q text`}},
+		},
+		{
+			name:     "Whitespace in Q text",
+			input:    "=?UTF-8?Q?a b?=",
+			expected: []Problem{{Column: 1, Message: `encoded-word is not terminated by "?=" or contains whitespace`}},
+		},
+		{
+			name:     "Too long",
+			input:    "=?UTF-8?B?44GC44GC44GC44GC44GC44GC44GC44GC44GC44GC44GC44GC44GC44GC44GC44GC?=",
+			expected: []Problem{{Column: 1, Message: "encoded-word is 76 characters long; the limit is 75"}},
+		},
+		{
+			name:     "Missing whitespace between words",
+			input:    "=?UTF-8?B?44GT?==?UTF-8?B?44GT?=",
+			expected: []Problem{{Column: 17, Message: "encoded-word is not separated from the preceding encoded-word by whitespace"}},
+		},
+		{
+			name:     "Inside quoted string",
+			input:    `"=?UTF-8?B?44GT?=" <a@example.com>`,
+			expected: []Problem{{Column: 2, Message: "encoded-word inside a quoted-string is not decoded by conforming readers"}},
+		},
+		{
+			name:     "Invalid bytes for charset",
+			input:    "=?Shift_JIS?B?gg==?=",
+			expected: []Problem{{Column: 15, Message: "bytes are not valid Shift_JIS"}},
+		},
+		{
+			name:     "ISO-2022-JP not back in ASCII",
+			input:    "=?ISO-2022-JP?B?GyRCJDMkcw==?=",
+			expected: []Problem{{Column: 17, Message: "ISO-2022-JP text does not switch back to ASCII before the end of the encoded-word"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			problems := LintHeader(tc.input)
+			if len(problems) != len(tc.expected) {
+				t.Fatalf("expected %d problems, got %+v", len(tc.expected), problems)
+			}
+			for i, problem := range problems {
+				if problem.Column != tc.expected[i].Column || problem.Message != tc.expected[i].Message {
+					t.Fatalf("expected %+v, got %+v", tc.expected[i], problem)
+				}
+			}
+		})
+	}
+}
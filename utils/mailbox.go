@@ -0,0 +1,453 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MailboxFormat is the layout of a file or directory holding messages.
+type MailboxFormat string
+
+const (
+	// FormatAuto detects the format from the path and the first bytes.
+	FormatAuto MailboxFormat = "auto"
+	// FormatEML is a single message.
+	FormatEML MailboxFormat = "eml"
+	// FormatMboxo separates messages with "From " lines and quotes "From "
+	// in bodies as ">From ", so ">From " is unquoted when read.
+	FormatMboxo MailboxFormat = "mboxo"
+	// FormatMboxrd quotes every ">*From " line with one more ">".
+	FormatMboxrd MailboxFormat = "mboxrd"
+	// FormatMboxcl2 gives the body length in Content-Length and quotes
+	// nothing.
+	FormatMboxcl2 MailboxFormat = "mboxcl2"
+	// FormatMMDF wraps every message in lines of four Control-A characters.
+	FormatMMDF MailboxFormat = "mmdf"
+	// FormatMaildir is a directory with cur and new subdirectories holding
+	// one message per file.
+	FormatMaildir MailboxFormat = "maildir"
+	// FormatMSG is a single Outlook .msg file, converted with ConvertMSG.
+	FormatMSG MailboxFormat = "msg"
+)
+
+// MailboxFormats lists the formats accepted by ParseMailboxFormat.
+var MailboxFormats = []MailboxFormat{FormatAuto, FormatEML, FormatMboxo, FormatMboxrd, FormatMboxcl2, FormatMMDF, FormatMaildir, FormatMSG}
+
+// ParseMailboxFormat returns the format named s; "mbox" means mboxrd.
+func ParseMailboxFormat(s string) (MailboxFormat, error) {
+	if strings.EqualFold(s, "mbox") {
+		return FormatMboxrd, nil
+	}
+	for _, format := range MailboxFormats {
+		if strings.EqualFold(s, string(format)) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("format must be one of auto, eml, mbox, mboxo, mboxrd, mboxcl2, mmdf, maildir or msg")
+}
+
+// Message is one message read from a mailbox. Index counts from 1 and
+// Source is the file the message came from.
+type Message struct {
+	Index  int
+	Source string
+	Data   []byte
+}
+
+// MessageID returns the Message-ID of the message, or an empty string.
+func (m *Message) MessageID() string {
+	headers, err := ReadRawHeaders(bytes.NewReader(m.Data))
+	if err != nil {
+		return ""
+	}
+	for _, header := range headers {
+		if strings.EqualFold(header.Name, "Message-ID") {
+			return strings.TrimSpace(header.Raw)
+		}
+	}
+	return ""
+}
+
+const mmdfDelimiter = "\x01\x01\x01\x01"
+
+var contentLengthPattern = regexp.MustCompile(`(?im)^content-length:[ \t]*([0-9]+)[ \t]*\r?$`)
+
+// Mailbox reads the messages of a mailbox one at a time.
+type Mailbox struct {
+	Format MailboxFormat
+	source string
+	reader *bufio.Reader
+	closer io.Closer
+	next   string   // a "From " line read ahead of the message it starts
+	detect bool     // an mbox found by FormatAuto may still be mboxcl2
+	files  []string // the messages of a Maildir
+	index  int
+}
+
+// OpenMailbox opens the file or Maildir at path. With FormatAuto a
+// directory is read as a Maildir and a file by its first bytes: "From "
+// starts an mboxrd file, or an mboxcl2 file when the Content-Length of its
+// first message ends the body right before the next "From " line, four
+// Control-A characters an MMDF file, the compound file signature an Outlook
+// .msg file, and anything else a single message.
+func OpenMailbox(path string, format MailboxFormat) (*Mailbox, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		if format != FormatAuto && format != FormatMaildir {
+			return nil, fmt.Errorf("%s is a directory, not %s", path, format)
+		}
+		files, err := maildirFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		return &Mailbox{Format: FormatMaildir, source: path, files: files}, nil
+	}
+	if format == FormatMaildir {
+		return nil, fmt.Errorf("%s is not a Maildir directory", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := NewMailboxReader(f, path, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	m.closer = f
+	return m, nil
+}
+
+// NewMailboxReader reads a mailbox file from r, such as standard input.
+// source names r in Message.Source. Maildir needs OpenMailbox.
+func NewMailboxReader(r io.Reader, source string, format MailboxFormat) (*Mailbox, error) {
+	if format == FormatMaildir {
+		return nil, fmt.Errorf("a Maildir must be opened as a directory")
+	}
+	m := &Mailbox{Format: format, source: source, reader: bufio.NewReader(r)}
+	if format == FormatAuto {
+		start, _ := m.reader.Peek(len(cfbSignature))
+		switch {
+		case IsMSG(start):
+			m.Format = FormatMSG
+		case bytes.HasPrefix(start, []byte("From ")):
+			m.Format = FormatMboxrd
+			m.detect = true
+		case bytes.HasPrefix(start, []byte(mmdfDelimiter)):
+			m.Format = FormatMMDF
+		default:
+			m.Format = FormatEML
+		}
+	}
+	return m, nil
+}
+
+// IsSingle reports whether the mailbox is a single message file rather than
+// a mailbox holding several.
+func (m *Mailbox) IsSingle() bool {
+	return m.Format == FormatEML || m.Format == FormatMSG
+}
+
+// Close closes the underlying file, if any.
+func (m *Mailbox) Close() error {
+	if m.closer != nil {
+		return m.closer.Close()
+	}
+	return nil
+}
+
+// Next returns the next message, or io.EOF when there are no more.
+func (m *Mailbox) Next() (*Message, error) {
+	var data []byte
+	var err error
+	source := m.source
+	switch m.Format {
+	case FormatMaildir:
+		if m.index >= len(m.files) {
+			return nil, io.EOF
+		}
+		source = m.files[m.index]
+		data, err = os.ReadFile(source)
+	case FormatEML, FormatMSG:
+		if m.index > 0 {
+			return nil, io.EOF
+		}
+		data, err = io.ReadAll(m.reader)
+		if err == nil && m.Format == FormatMSG {
+			data, err = ConvertMSG(data)
+		}
+	case FormatMMDF:
+		data, err = m.nextMMDF()
+	case FormatMboxo, FormatMboxrd, FormatMboxcl2:
+		data, err = m.nextMbox()
+	default:
+		return nil, fmt.Errorf("unknown mailbox format %q", m.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.index++
+	return &Message{Index: m.index, Source: source, Data: data}, nil
+}
+
+// NextReader returns the next message like Next, but streams a single
+// message file from the underlying reader instead of reading it into memory.
+// Outlook .msg files and mailboxes are still read a message at a time.
+func (m *Mailbox) NextReader() (io.Reader, error) {
+	if m.Format != FormatEML {
+		message, err := m.Next()
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(message.Data), nil
+	}
+	if m.index > 0 {
+		return nil, io.EOF
+	}
+	m.index++
+	return m.reader, nil
+}
+
+// readLine returns the next line including its line ending, or io.EOF.
+func (m *Mailbox) readLine() (string, error) {
+	if m.next != "" {
+		line := m.next
+		m.next = ""
+		return line, nil
+	}
+	line, err := m.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		return line, nil
+	}
+	return line, err
+}
+
+// nextMbox reads one message of an mbox file starting at its "From " line.
+func (m *Mailbox) nextMbox() ([]byte, error) {
+	var line string
+	var err error
+	// skip blank lines between messages
+	for {
+		line, err = m.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimRight(line, "\r\n") != "" {
+			break
+		}
+	}
+	if !strings.HasPrefix(line, "From ") {
+		return nil, fmt.Errorf("message %d of %s does not start with a \"From \" line", m.index+1, m.source)
+	}
+
+	var buf bytes.Buffer
+	if m.Format == FormatMboxcl2 || m.detect {
+		data, ok, err := m.readContentLength(&buf)
+		m.detect = false
+		if err != nil || ok {
+			return data, err
+		}
+	}
+	for {
+		line, err = m.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, "From ") {
+			m.next = line
+			break
+		}
+		buf.WriteString(unquoteFrom(line, m.Format))
+	}
+	return trimSeparator(buf.Bytes()), nil
+}
+
+// readContentLength reads the header of an mboxcl2 message into buf and,
+// if it has a Content-Length, the body of that length. ok is false when the
+// header has no Content-Length, leaving the body to be read up to the next
+// "From " line. For the first message of an mbox found by FormatAuto, the
+// mailbox becomes mboxcl2 only when that body ends right before the next
+// "From " line or the end of the file; otherwise the body is put back to be
+// read as mboxrd.
+func (m *Mailbox) readContentLength(buf *bytes.Buffer) ([]byte, bool, error) {
+	length, err := m.readLengthHeader(buf)
+	if err == io.EOF {
+		return buf.Bytes(), true, nil
+	}
+	if err != nil || length < 0 {
+		return nil, false, err
+	}
+	body := make([]byte, length)
+	n, err := io.ReadFull(m.reader, body)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, false, err
+	}
+	if m.detect {
+		if n < length || !m.atMessageEnd() {
+			m.reader = bufio.NewReader(io.MultiReader(bytes.NewReader(body[:n]), m.reader))
+			return nil, false, nil
+		}
+		m.Format = FormatMboxcl2
+	}
+	buf.Write(body[:n])
+	return buf.Bytes(), true, nil
+}
+
+// readLengthHeader reads the header of an mbox message into buf and returns
+// its Content-Length, or -1 when it has none. It returns io.EOF when the
+// file ends within the header.
+func (m *Mailbox) readLengthHeader(buf *bytes.Buffer) (int, error) {
+	for {
+		line, err := m.readLine()
+		if err != nil {
+			return -1, err
+		}
+		buf.WriteString(line)
+		if strings.TrimRight(line, "\r\n") == "" {
+			break
+		}
+	}
+	match := contentLengthPattern.FindSubmatch(buf.Bytes())
+	if match == nil {
+		return -1, nil
+	}
+	length, err := strconv.Atoi(string(match[1]))
+	if err != nil {
+		return -1, nil
+	}
+	return length, nil
+}
+
+// atMessageEnd reports whether the reader is at the end of the file or at
+// the next "From " line, after at most a blank line.
+func (m *Mailbox) atMessageEnd() bool {
+	next, _ := m.reader.Peek(len("\r\nFrom "))
+	switch string(next) {
+	case "", "\n", "\r\n":
+		return true
+	}
+	for _, separator := range []string{"", "\n", "\r\n"} {
+		if bytes.HasPrefix(next, []byte(separator+"From ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextMMDF reads one message of an MMDF file between delimiter lines.
+func (m *Mailbox) nextMMDF() ([]byte, error) {
+	for {
+		line, err := m.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimRight(line, "\r\n") == mmdfDelimiter {
+			break
+		}
+		if strings.TrimSpace(line) != "" {
+			return nil, fmt.Errorf("message %d of %s does not start with an MMDF delimiter", m.index+1, m.source)
+		}
+	}
+	var buf bytes.Buffer
+	for {
+		line, err := m.readLine()
+		if err == io.EOF {
+			// a missing closing delimiter keeps what was read
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimRight(line, "\r\n") == mmdfDelimiter {
+			break
+		}
+		buf.WriteString(line)
+	}
+	return buf.Bytes(), nil
+}
+
+// unquoteFrom undoes the ">From " quoting of mboxo and mboxrd bodies.
+func unquoteFrom(line string, format MailboxFormat) string {
+	switch format {
+	case FormatMboxo:
+		if strings.HasPrefix(line, ">From ") {
+			return line[1:]
+		}
+	case FormatMboxrd:
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") && strings.HasPrefix(line, ">") {
+			return line[1:]
+		}
+	}
+	return line
+}
+
+// trimSeparator drops the blank line an mbox writer puts before the next
+// "From " line.
+func trimSeparator(b []byte) []byte {
+	for _, ending := range []string{"\r\n\r\n", "\n\n"} {
+		if bytes.HasSuffix(b, []byte(ending)) {
+			return b[:len(b)-len(ending)/2]
+		}
+	}
+	return b
+}
+
+// maildirFiles lists the messages in the cur and new directories of a
+// Maildir and of its Maildir++ subfolders, which are directories starting
+// with a dot. Files are ordered by folder and then by name, which starts
+// with the delivery time.
+func maildirFiles(dir string) ([]string, error) {
+	folders := []string{dir}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), ".") && entry.Name() != "." && entry.Name() != ".." {
+			folders = append(folders, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	var files []string
+	found := false
+	for _, folder := range folders {
+		for _, sub := range []string{"cur", "new"} {
+			entries, err := os.ReadDir(filepath.Join(folder, sub))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			found = true
+			var names []string
+			for _, entry := range entries {
+				if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+					names = append(names, entry.Name())
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				files = append(files, filepath.Join(folder, sub, name))
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not a Maildir: no cur or new directory", dir)
+	}
+	return files, nil
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readMailbox(t *testing.T, m *Mailbox) []string {
+	t.Helper()
+	var messages []string
+	for {
+		msg, err := m.Next()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		if msg.Index != len(messages)+1 {
+			t.Fatalf("expected index %d, got %d", len(messages)+1, msg.Index)
+		}
+		messages = append(messages, string(msg.Data))
+	}
+}
+
+func TestMailboxReader(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          string
+		format         MailboxFormat
+		expectedFormat MailboxFormat
+		expected       []string
+	}{
+		{
+			name: "mboxrd",
+			input: "From a@example.com Mon Jan  1 00:00:00 2024\n" +
+				"Subject: one\n\n>From here\n>>From there\n\n" +
+				"From b@example.com Mon Jan  1 00:00:00 2024\n" +
+				"Subject: two\n\nbody\n",
+			format:         FormatAuto,
+			expectedFormat: FormatMboxrd,
+			expected:       []string{"Subject: one\n\nFrom here\n>From there\n", "Subject: two\n\nbody\n"},
+		},
+		{
+			name: "mboxo",
+			input: "From a@example.com Mon Jan  1 00:00:00 2024\n" +
+				"Subject: one\n\n>From here\n>>From there\n",
+			format:         FormatMboxo,
+			expectedFormat: FormatMboxo,
+			expected:       []string{"Subject: one\n\nFrom here\n>>From there\n"},
+		},
+		{
+			name: "mboxcl2",
+			input: "From a@example.com Mon Jan  1 00:00:00 2024\n" +
+				"Subject: one\nContent-Length: 21\n\nFrom is not a split\n\n" +
+				"From b@example.com Mon Jan  1 00:00:00 2024\n" +
+				"Subject: two\r\n\r\n>From stays\r\n",
+			format:         FormatMboxcl2,
+			expectedFormat: FormatMboxcl2,
+			expected:       []string{"Subject: one\nContent-Length: 21\n\nFrom is not a split\n\n", "Subject: two\r\n\r\n>From stays\r\n"},
+		},
+		{
+			name: "Detected mboxcl2",
+			input: "From a@example.com Mon Jan  1 00:00:00 2024\n" +
+				"Subject: one\nContent-Length: 21\n\nFrom is not a split\n\n" +
+				"From b@example.com Mon Jan  1 00:00:00 2024\n" +
+				"Subject: two\n\n>From stays\n",
+			format:         FormatAuto,
+			expectedFormat: FormatMboxcl2,
+			expected:       []string{"Subject: one\nContent-Length: 21\n\nFrom is not a split\n\n", "Subject: two\n\n>From stays\n"},
+		},
+		{
+			name: "Inconsistent Content-Length",
+			input: "From a@example.com Mon Jan  1 00:00:00 2024\n" +
+				"Subject: one\nContent-Length: 5\n\n>From here\n\n" +
+				"From b@example.com Mon Jan  1 00:00:00 2024\n" +
+				"Subject: two\nContent-Length: 999\n\nbody\n",
+			format:         FormatAuto,
+			expectedFormat: FormatMboxrd,
+			expected:       []string{"Subject: one\nContent-Length: 5\n\nFrom here\n", "Subject: two\nContent-Length: 999\n\nbody\n"},
+		},
+		{
+			name:           "MMDF",
+			input:          "\x01\x01\x01\x01\nSubject: one\n\nbody\n\x01\x01\x01\x01\n\x01\x01\x01\x01\nSubject: two\n\nFrom x\n\x01\x01\x01\x01\n",
+			format:         FormatAuto,
+			expectedFormat: FormatMMDF,
+			expected:       []string{"Subject: one\n\nbody\n", "Subject: two\n\nFrom x\n"},
+		},
+		{
+			name:           "Single message",
+			input:          "Subject: one\r\n\r\nbody\r\n",
+			format:         FormatAuto,
+			expectedFormat: FormatEML,
+			expected:       []string{"Subject: one\r\n\r\nbody\r\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewMailboxReader(strings.NewReader(tc.input), "test", tc.format)
+			if err != nil {
+				t.Fatalf("failed to open: %v", err)
+			}
+			if messages := readMailbox(t, m); !reflect.DeepEqual(messages, tc.expected) {
+				t.Fatalf("expected %q, got %q", tc.expected, messages)
+			}
+			if m.Format != tc.expectedFormat {
+				t.Fatalf("expected format %s, got %s", tc.expectedFormat, m.Format)
+			}
+		})
+	}
+}
+
+func TestMaildir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"cur/1700000002.M2.host:2,S":      "Message-ID: <2@example.com>\n\ntwo\n",
+		"cur/1700000001.M1.host:2,S":      "Message-ID: <1@example.com>\n\none\n",
+		"new/1700000003.M3.host":          "Message-ID: <3@example.com>\n\nthree\n",
+		".Archive/cur/1600000000.M0.host": "Message-ID: <0@example.com>\n\narchived\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := OpenMailbox(dir, FormatAuto)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer m.Close()
+	var ids []string
+	for {
+		msg, err := m.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		ids = append(ids, msg.MessageID())
+	}
+	expected := []string{"<1@example.com>", "<2@example.com>", "<3@example.com>", "<0@example.com>"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected %v, got %v", expected, ids)
+	}
+
+	if _, err := OpenMailbox(t.TempDir(), FormatAuto); err == nil {
+		t.Fatalf("expected an empty directory to be rejected")
+	}
+}
+
+func TestMailboxNextReader(t *testing.T) {
+	input := "Subject: one\r\n\r\nbody\r\n"
+	m, err := NewMailboxReader(strings.NewReader(input), "test", FormatAuto)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	r, err := m.NextReader()
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	// a single message is streamed rather than read into memory
+	if r != io.Reader(m.reader) {
+		t.Errorf("expected the mailbox reader, got %T", r)
+	}
+	if data, _ := io.ReadAll(r); string(data) != input {
+		t.Errorf("expected %q, got %q", input, data)
+	}
+	if _, err := m.NextReader(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
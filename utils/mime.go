@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Part is a node of the MIME tree of a message. Path is the IMAP style index
+// of the part such as "1.2"; the root of a multipart message has an empty
+// path and a single part message is "1". Body holds the part as it appears
+// in the message, still transfer-encoded, and is nil for multipart parts.
+// Properties holds the MAPI properties of a TNEF part and of the
+// attachments taken from it. Err is set on a TNEF part that could not be
+// read, which is then kept as a leaf.
+type Part struct {
+	Path       string
+	Header     textproto.MIMEHeader
+	MediaType  string
+	Params     map[string]string
+	Body       []byte
+	Children   []*Part
+	Properties []MAPIProperty
+	Err        error
+}
+
+// ParseMessage reads a whole message from r and builds its MIME tree.
+func ParseMessage(r io.Reader) (*Part, error) {
+	mm, err := mail.ReadMessage(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(mm.Body)
+	if err != nil {
+		return nil, err
+	}
+	header := textproto.MIMEHeader(mm.Header)
+	path := "1"
+	if isMultipartHeader(header) {
+		path = ""
+	}
+	return newPart(path, header, body, "text/plain")
+}
+
+func isMultipartHeader(header textproto.MIMEHeader) bool {
+	mediaType, _, _ := ParseHeaderParams(header.Get("Content-Type"))
+	return strings.HasPrefix(mediaType, "multipart/")
+}
+
+// newPart parses a part and, for multipart, message/rfc822 and TNEF parts,
+// its children. defaultType is the media type to assume without a Content-Type.
+func newPart(path string, header textproto.MIMEHeader, body []byte, defaultType string) (*Part, error) {
+	part := &Part{Path: path, Header: header, Body: body}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = defaultType
+	}
+	mediaType, params, err := ParseHeaderParams(contentType)
+	if err != nil && !strings.Contains(mediaType, "/") {
+		// an unparsable Content-Type is treated as text/plain, as RFC 2045 says
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	part.MediaType = mediaType
+	part.Params = params
+
+	switch {
+	case strings.HasPrefix(part.MediaType, "multipart/"):
+		if err := part.parseMultipart(); err != nil {
+			return nil, err
+		}
+	case part.MediaType == "message/rfc822":
+		if err := part.parseEmbedded(); err != nil {
+			return nil, err
+		}
+	case part.isTNEF():
+		// a damaged winmail.dat should not hide the rest of the message
+		if err := part.parseTNEF(); err != nil {
+			part.Err, part.Properties = err, nil
+		}
+	}
+	return part, nil
+}
+
+func (p *Part) parseMultipart() error {
+	boundary := p.Params["boundary"]
+	if boundary == "" {
+		return fmt.Errorf("part %s: multipart without boundary", p.displayPath())
+	}
+	defaultType := "text/plain"
+	if p.MediaType == "multipart/digest" {
+		defaultType = "message/rfc822"
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(p.Body), boundary)
+	for i := 1; ; i++ {
+		raw, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("part %s: %v", p.displayPath(), err)
+		}
+		body, err := io.ReadAll(raw)
+		// a missing close delimiter is common enough to keep what was read
+		truncated := err == io.ErrUnexpectedEOF
+		if err != nil && !truncated {
+			return fmt.Errorf("part %s: %v", p.displayPath(), err)
+		}
+		child, err := newPart(p.childPath(i), raw.Header, body, defaultType)
+		if err != nil {
+			return err
+		}
+		p.Children = append(p.Children, child)
+		if truncated {
+			break
+		}
+	}
+	p.Body = nil
+	return nil
+}
+
+// parseEmbedded parses the message carried by a message/rfc822 part. As in
+// IMAP, a multipart embedded message shares the path of its container and a
+// single part one is numbered as its first child.
+func (p *Part) parseEmbedded() error {
+	decoded, err := p.Decode()
+	if err != nil {
+		return err
+	}
+	mm, err := mail.ReadMessage(bytes.NewReader(decoded))
+	if err != nil {
+		return fmt.Errorf("part %s: %v", p.displayPath(), err)
+	}
+	body, err := io.ReadAll(mm.Body)
+	if err != nil {
+		return err
+	}
+	header := textproto.MIMEHeader(mm.Header)
+	path := p.childPath(1)
+	if isMultipartHeader(header) {
+		path = p.Path
+	}
+	child, err := newPart(path, header, body, "text/plain")
+	if err != nil {
+		return err
+	}
+	p.Children = []*Part{child}
+	return nil
+}
+
+func (p *Part) childPath(i int) string {
+	if p.Path == "" {
+		return strconv.Itoa(i)
+	}
+	return p.Path + "." + strconv.Itoa(i)
+}
+
+func (p *Part) displayPath() string {
+	if p.Path == "" {
+		return "root"
+	}
+	return p.Path
+}
+
+// IsMultipart reports whether the part is a multipart container.
+func (p *Part) IsMultipart() bool {
+	return strings.HasPrefix(p.MediaType, "multipart/")
+}
+
+// Charset returns the charset parameter of the part, if any.
+func (p *Part) Charset() string {
+	return p.Params["charset"]
+}
+
+// TransferEncoding returns the Content-Transfer-Encoding of the part,
+// lowercased, defaulting to 7bit.
+func (p *Part) TransferEncoding() string {
+	encoding := strings.ToLower(strings.TrimSpace(p.Header.Get("Content-Transfer-Encoding")))
+	if encoding == "" {
+		return "7bit"
+	}
+	return encoding
+}
+
+// Decode returns the body with its Content-Transfer-Encoding undone.
+func (p *Part) Decode() ([]byte, error) {
+	var reader io.Reader
+	switch p.TransferEncoding() {
+	case "base64":
+		reader = base64.NewDecoder(base64.StdEncoding, bytes.NewReader(p.Body))
+	case "quoted-printable":
+		reader = quotedprintable.NewReader(bytes.NewReader(p.Body))
+	case "7bit", "8bit", "binary":
+		return p.Body, nil
+	default:
+		return nil, fmt.Errorf("part %s: unsupported Content-Transfer-Encoding %q", p.displayPath(), p.TransferEncoding())
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("part %s: %v", p.displayPath(), err)
+	}
+	return decoded, nil
+}
+
+// Text returns the decoded body converted from its charset to UTF-8.
+func (p *Part) Text() (string, error) {
+	decoded, err := p.Decode()
+	if err != nil {
+		return "", err
+	}
+	text, err := DecodeCharset(decoded, p.Charset())
+	if err != nil {
+		return "", fmt.Errorf("part %s: %v", p.displayPath(), err)
+	}
+	return string(text), nil
+}
+
+// Walk calls fn for the part and all of its descendants, depth first.
+func (p *Part) Walk(fn func(*Part) error) error {
+	if err := fn(p); err != nil {
+		return err
+	}
+	for _, child := range p.Children {
+		if err := child.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find returns the part with the given path, or nil.
+func (p *Part) Find(path string) *Part {
+	var found *Part
+	p.Walk(func(part *Part) error {
+		if found == nil && part.Path == path {
+			found = part
+		}
+		return nil
+	})
+	return found
+}
+
+// Disposition returns the Content-Disposition of the part, lowercased, and
+// its parameters.
+func (p *Part) Disposition() (string, map[string]string) {
+	disposition, params, _ := ParseHeaderParams(p.Header.Get("Content-Disposition"))
+	return disposition, params
+}
+
+// IsAttachment reports whether the part has a Content-Disposition of
+// attachment.
+func (p *Part) IsAttachment() bool {
+	disposition, _ := p.Disposition()
+	return disposition == "attachment"
+}
+
+// Filename returns the decoded filename parameter of Content-Disposition,
+// falling back to the name parameter of Content-Type.
+func (p *Part) Filename() string {
+	_, params := p.Disposition()
+	if filename := params["filename"]; filename != "" {
+		return filename
+	}
+	return p.Params["name"]
+}
+
+// DecodedSize returns the size of the body after its transfer encoding is
+// undone, or the sum of the children for multipart parts.
+func (p *Part) DecodedSize() (int, error) {
+	if p.IsMultipart() {
+		size := 0
+		for _, child := range p.Children {
+			childSize, err := child.DecodedSize()
+			if err != nil {
+				return 0, err
+			}
+			size += childSize
+		}
+		return size, nil
+	}
+	decoded, err := p.Decode()
+	if err != nil {
+		return 0, err
+	}
+	return len(decoded), nil
+}
+
+// FirstText returns the first part of the given text media type that is not
+// an attachment, or nil.
+func (p *Part) FirstText(mediaType string) *Part {
+	var found *Part
+	p.Walk(func(part *Part) error {
+		if found == nil && part.MediaType == mediaType && !part.IsAttachment() {
+			found = part
+		}
+		return nil
+	})
+	return found
+}
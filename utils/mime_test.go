@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	file, err := os.Open("../test_files/nested.eml")
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer file.Close()
+	root, err := ParseMessage(file)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	var paths []string
+	root.Walk(func(part *Part) error {
+		paths = append(paths, part.Path+" "+part.MediaType)
+		return nil
+	})
+	expected := []string{
+		" multipart/mixed",
+		"1 multipart/alternative",
+		"1.1 text/plain",
+		"1.2 text/html",
+		"2 application/pdf",
+		"3 image/png",
+		"4 message/rfc822",
+		"4.1 text/plain",
+	}
+	if strings.Join(paths, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected parts\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(paths, "\n"))
+	}
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "1.1", expected: "こんにちは、ニュースレターです。\r\n今月のお知らせ：ご飯に行きませんか？\r\n"},
+		{path: "1.2", expected: "<html><body><p>こんにちは、ニュースレターです。</p></body></html>\r\n"},
+		{path: "2", expected: "%PDF-1.4\n% fake pdf for tests\n"},
+		{path: "4.1", expected: "This is the forwarded message."},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			part := root.Find(tc.path)
+			if part == nil {
+				t.Fatalf("part %s not found", tc.path)
+			}
+			text, err := part.Text()
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if text != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, text)
+			}
+		})
+	}
+
+	if part := root.FirstText("text/plain"); part == nil || part.Path != "1.1" {
+		t.Fatalf("expected first text/plain part to be 1.1, got %+v", part)
+	}
+}
+
+func TestParseMessageSinglePart(t *testing.T) {
+	message := "Subject: test\r\n" +
+		"Content-Type: text/plain; charset=Shift_JIS\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"=82=B1=82=F1=82=C9=82=BF=82=CD\r\n"
+	root, err := ParseMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if root.Path != "1" || len(root.Children) != 0 {
+		t.Fatalf("expected a single part numbered 1, got %+v", root)
+	}
+	text, err := root.Text()
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if text != "こんにちは\r\n" {
+		t.Fatalf("expected こんにちは, got %q", text)
+	}
+}
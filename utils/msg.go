@@ -0,0 +1,558 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MAPI properties read from Outlook .msg files, as listed in [MS-OXPROPS].
+const (
+	propSubject              = 0x0037
+	propClientSubmitTime     = 0x0039
+	propSentRepresentingName = 0x0042
+	propSentRepresentingAddr = 0x0065
+	propTransportHeaders     = 0x007D
+	propRecipientType        = 0x0C15
+	propSenderName           = 0x0C1A
+	propSenderAddr           = 0x0C1F
+	propDeliveryTime         = 0x0E06
+	propBody                 = 0x1000
+	propHTML                 = 0x1013
+	propInternetMessageID    = 0x1035
+	propDisplayName          = 0x3001
+	propEmailAddress         = 0x3003
+	propAttachData           = 0x3701
+	propAttachFilename       = 0x3704
+	propAttachLongFilename   = 0x3707
+	propAttachMimeTag        = 0x370E
+	propAttachContentID      = 0x3712
+	propSMTPAddress          = 0x39FE
+	propInternetCodepage     = 0x3FDE
+	propMessageCodepage      = 0x3FFD
+	propSenderSMTPAddr       = 0x5D01
+	propSentRepresentingSMTP = 0x5D02
+)
+
+// MAPI property types used in stream names.
+const (
+	typeString8 = 0x001E
+	typeUnicode = 0x001F
+	typeBinary  = 0x0102
+	typeObject  = 0x000D
+)
+
+const (
+	msgPropertiesStream = "__properties_version1.0"
+	msgRecipientPrefix  = "__recip_version1.0_"
+	msgAttachmentPrefix = "__attach_version1.0_"
+)
+
+// The property stream starts with a header whose size depends on the
+// storage it belongs to.
+const (
+	msgTopHeaderSize      = 32
+	msgEmbeddedHeaderSize = 24
+	msgChildHeaderSize    = 8
+)
+
+// recipientHeaders maps PR_RECIPIENT_TYPE to the header listing the
+// recipient.
+var recipientHeaders = map[uint32]string{1: "To", 2: "Cc", 3: "Bcc"}
+
+// IsMSG reports whether data looks like an Outlook .msg file.
+func IsMSG(data []byte) bool {
+	return isCompoundFile(data)
+}
+
+// NewMessageReader returns a reader for the message in r. An Outlook .msg
+// file is converted with ConvertMSG; anything else is read as it is.
+func NewMessageReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(len(cfbSignature))
+	if !IsMSG(start) {
+		return br, nil
+	}
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := ConvertMSG(data)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(converted), nil
+}
+
+// ConvertMSG converts an Outlook .msg file to an RFC 5322 message. The
+// transport headers Outlook keeps for received mail are used as they are,
+// less their Content- fields; drafts and sent items without them get From,
+// To, Cc, Subject, Date and Message-ID built from their properties. The
+// plain text and HTML bodies and the attachments, including attached
+// messages, become a new MIME tree.
+func ConvertMSG(data []byte) ([]byte, error) {
+	cf, err := readCompoundFile(data)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := newMsgStorage(cf, cf.root, msgTopHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := msg.writeMessage(&b, 0); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// msgStorage is a message, recipient or attachment storage of a .msg file.
+// fixed holds the 8 byte values of its fixed-size properties by ID.
+type msgStorage struct {
+	cf    *compoundFile
+	entry *cfbEntry
+	fixed map[uint16][]byte
+}
+
+func newMsgStorage(cf *compoundFile, entry *cfbEntry, headerSize int) (*msgStorage, error) {
+	s := &msgStorage{cf: cf, entry: entry, fixed: make(map[uint16][]byte)}
+	props := entry.find(msgPropertiesStream)
+	if props == nil {
+		return s, nil
+	}
+	b, err := cf.stream(props)
+	if err != nil {
+		return nil, err
+	}
+	for offset := headerSize; offset+16 <= len(b); offset += 16 {
+		id := binary.LittleEndian.Uint16(b[offset+2:])
+		s.fixed[id] = b[offset+8 : offset+16]
+	}
+	return s, nil
+}
+
+// stream returns the stream holding a variable-size property.
+func (s *msgStorage) stream(id, kind uint16) ([]byte, bool, error) {
+	entry := s.entry.find(fmt.Sprintf("__substg1.0_%04X%04X", id, kind))
+	if entry == nil || entry.kind != cfbStream {
+		return nil, false, nil
+	}
+	b, err := s.cf.stream(entry)
+	return b, err == nil, err
+}
+
+// str returns a string property, which is either UTF-16 or 8 bit text in
+// the charset of the message.
+func (s *msgStorage) str(id uint16, charset string) (string, error) {
+	if b, ok, err := s.stream(id, typeUnicode); ok || err != nil {
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00"), err
+	}
+	b, ok, err := s.stream(id, typeString8)
+	if !ok {
+		return "", err
+	}
+	b = bytes.TrimRight(b, "\x00")
+	if charset == "" && !utf8.Valid(b) {
+		charset = "windows-1252"
+	}
+	text, err := DecodeCharset(b, charset)
+	if err != nil {
+		return "", fmt.Errorf("property %04X: %v", id, err)
+	}
+	return string(text), nil
+}
+
+// firstStr returns the first of the string properties that is set.
+func (s *msgStorage) firstStr(charset string, ids ...uint16) (string, error) {
+	for _, id := range ids {
+		value, err := s.str(id, charset)
+		if value != "" || err != nil {
+			return value, err
+		}
+	}
+	return "", nil
+}
+
+func (s *msgStorage) long(id uint16) (uint32, bool) {
+	b, ok := s.fixed[id]
+	if !ok {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(b), true
+}
+
+// systime returns a PT_SYSTIME property.
+func (s *msgStorage) systime(id uint16) (time.Time, bool) {
+	b, ok := s.fixed[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	ticks := binary.LittleEndian.Uint64(b)
+	if ticks == 0 {
+		return time.Time{}, false
+	}
+	return filetime(ticks), true
+}
+
+// charset returns the charset of 8 bit strings and of a binary HTML body.
+func (s *msgStorage) charset() string {
+	for _, id := range []uint16{propInternetCodepage, propMessageCodepage} {
+		if codepage, ok := s.long(id); ok {
+			return codepageCharset(codepage)
+		}
+	}
+	return ""
+}
+
+// codepageCharset returns the charset name for a Windows code page.
+func codepageCharset(codepage uint32) string {
+	switch {
+	case codepage == 65001:
+		return "UTF-8"
+	case codepage == 20127:
+		return "US-ASCII"
+	case codepage >= 50220 && codepage <= 50222:
+		return "ISO-2022-JP"
+	case codepage == 51932 || codepage == 20932:
+		return "EUC-JP"
+	case codepage == 936:
+		return "GBK"
+	case codepage == 949:
+		return "EUC-KR"
+	case codepage == 950:
+		return "Big5"
+	case codepage == 20866:
+		return "KOI8-R"
+	case codepage == 21866:
+		return "KOI8-U"
+	case codepage >= 28591 && codepage <= 28599:
+		return "ISO-8859-" + strconv.Itoa(int(codepage-28590))
+	}
+	return "cp" + strconv.Itoa(int(codepage))
+}
+
+// children returns the storages below s whose names start with prefix.
+func (s *msgStorage) children(prefix string) []*cfbEntry {
+	var entries []*cfbEntry
+	for _, child := range s.entry.children {
+		if child.kind == cfbStorage && strings.HasPrefix(child.name, prefix) {
+			entries = append(entries, child)
+		}
+	}
+	return entries
+}
+
+// writeMessage writes the message as RFC 5322. depth counts the attached
+// messages it is nested in and keeps the MIME boundaries apart.
+func (s *msgStorage) writeMessage(b *bytes.Buffer, depth int) error {
+	charset := s.charset()
+	headers, err := s.str(propTransportHeaders, charset)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(headers) != "" {
+		writeTransportHeaders(b, headers)
+	} else if err := s.writeHeaders(b, charset); err != nil {
+		return err
+	}
+	body, err := s.mimeBody(charset, depth)
+	if err != nil {
+		return err
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+	body.write(b)
+	return nil
+}
+
+// writeTransportHeaders copies the header block Outlook received, dropping
+// the MIME fields that described the original body.
+func writeTransportHeaders(b *bytes.Buffer, headers string) {
+	headers = strings.ReplaceAll(headers, "\r\n", "\n")
+	skipping := false
+	for _, line := range strings.Split(headers, "\n") {
+		if line == "" {
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			name := strings.ToLower(strings.SplitN(line, ":", 2)[0])
+			skipping = strings.HasPrefix(name, "content-") || name == "mime-version"
+		}
+		if !skipping {
+			b.WriteString(line + "\r\n")
+		}
+	}
+}
+
+// writeHeaders builds the header block of a message without transport
+// headers from its properties.
+func (s *msgStorage) writeHeaders(b *bytes.Buffer, charset string) error {
+	var fields [][2]string
+	name, err := s.firstStr(charset, propSentRepresentingName, propSenderName)
+	if err != nil {
+		return err
+	}
+	address, err := s.firstStr(charset, propSentRepresentingSMTP, propSenderSMTPAddr, propSentRepresentingAddr, propSenderAddr)
+	if err != nil {
+		return err
+	}
+	if from := formatMailbox(name, address); from != "" {
+		fields = append(fields, [2]string{"From", from})
+	}
+
+	recipients := make(map[string][]string)
+	for _, entry := range s.children(msgRecipientPrefix) {
+		recipient, err := newMsgStorage(s.cf, entry, msgChildHeaderSize)
+		if err != nil {
+			return err
+		}
+		kind, _ := recipient.long(propRecipientType)
+		header, ok := recipientHeaders[kind]
+		if !ok {
+			continue
+		}
+		name, err := recipient.str(propDisplayName, charset)
+		if err != nil {
+			return err
+		}
+		address, err := recipient.firstStr(charset, propSMTPAddress, propEmailAddress)
+		if err != nil {
+			return err
+		}
+		if mailbox := formatMailbox(name, address); mailbox != "" {
+			recipients[header] = append(recipients[header], mailbox)
+		}
+	}
+	for _, header := range []string{"To", "Cc", "Bcc"} {
+		if len(recipients[header]) > 0 {
+			fields = append(fields, [2]string{header, strings.Join(recipients[header], ", ")})
+		}
+	}
+
+	subject, err := s.str(propSubject, charset)
+	if err != nil {
+		return err
+	}
+	if subject != "" {
+		fields = append(fields, [2]string{"Subject", subject})
+	}
+	date, ok := s.systime(propClientSubmitTime)
+	if !ok {
+		date, ok = s.systime(propDeliveryTime)
+	}
+	if ok {
+		fields = append(fields, [2]string{"Date", date.Format(time.RFC1123Z)})
+	}
+	messageID, err := s.str(propInternetMessageID, charset)
+	if err != nil {
+		return err
+	}
+	if messageID != "" {
+		fields = append(fields, [2]string{"Message-ID", messageID})
+	}
+
+	for _, field := range fields {
+		encoded, err := EncodeHeaderField(field[0], field[1], "UTF-8", "B")
+		if err != nil {
+			return fmt.Errorf("%s: %v", field[0], err)
+		}
+		b.WriteString(encoded + "\r\n")
+	}
+	return nil
+}
+
+// formatMailbox writes a display name and address as a mailbox, quoting the
+// name when it holds specials such as the comma of "Doe, John".
+func formatMailbox(name, address string) string {
+	if strings.ContainsAny(name, addressSpecials) {
+		name = quotePhrase(name)
+	}
+	switch {
+	case address == "":
+		return ""
+	case name == "":
+		return address
+	}
+	return name + " <" + address + ">"
+}
+
+// mimePart is a node of the MIME tree written for a converted message.
+type mimePart struct {
+	header   []string
+	body     []byte
+	boundary string
+	parts    []*mimePart
+}
+
+func (p *mimePart) write(b *bytes.Buffer) {
+	for _, field := range p.header {
+		b.WriteString(field + "\r\n")
+	}
+	b.WriteString("\r\n")
+	if p.boundary == "" {
+		b.Write(p.body)
+		return
+	}
+	for _, part := range p.parts {
+		b.WriteString("--" + p.boundary + "\r\n")
+		part.write(b)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("--" + p.boundary + "--\r\n")
+}
+
+func newMultipart(subtype string, depth int, parts []*mimePart) *mimePart {
+	boundary := fmt.Sprintf("=_gemm_%s_%d", subtype, depth)
+	return &mimePart{
+		header:   []string{fmt.Sprintf("Content-Type: multipart/%s; boundary=%q", subtype, boundary)},
+		boundary: boundary,
+		parts:    parts,
+	}
+}
+
+func newTextPart(mediaType string, text []byte, charset string) *mimePart {
+	var body bytes.Buffer
+	w := quotedprintable.NewWriter(&body)
+	w.Write(text)
+	w.Close()
+	contentType := "Content-Type: " + mediaType
+	if name, _, err := LookupCharset(charset); err == nil {
+		contentType += "; charset=" + name
+	}
+	return &mimePart{
+		header: []string{contentType, "Content-Transfer-Encoding: quoted-printable"},
+		body:   body.Bytes(),
+	}
+}
+
+// mimeBody returns the MIME tree of the bodies and attachments.
+func (s *msgStorage) mimeBody(charset string, depth int) (*mimePart, error) {
+	var alternatives []*mimePart
+	text, err := s.str(propBody, charset)
+	if err != nil {
+		return nil, err
+	}
+	if text != "" {
+		alternatives = append(alternatives, newTextPart("text/plain", []byte(text), "UTF-8"))
+	}
+	html, ok, err := s.stream(propHTML, typeBinary)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		alternatives = append(alternatives, newTextPart("text/html", bytes.TrimRight(html, "\x00"), charset))
+	} else if html, err := s.str(propHTML, charset); err != nil {
+		return nil, err
+	} else if html != "" {
+		alternatives = append(alternatives, newTextPart("text/html", []byte(html), "UTF-8"))
+	}
+
+	var body *mimePart
+	switch len(alternatives) {
+	case 0:
+		body = newTextPart("text/plain", nil, "UTF-8")
+	case 1:
+		body = alternatives[0]
+	default:
+		body = newMultipart("alternative", depth, alternatives)
+	}
+
+	attachments, err := s.attachments(charset, depth)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return body, nil
+	}
+	return newMultipart("mixed", depth, append([]*mimePart{body}, attachments...)), nil
+}
+
+// attachments returns a part for every attachment storage. Attached
+// messages become message/rfc822 parts.
+func (s *msgStorage) attachments(charset string, depth int) ([]*mimePart, error) {
+	var parts []*mimePart
+	for _, entry := range s.children(msgAttachmentPrefix) {
+		attachment, err := newMsgStorage(s.cf, entry, msgChildHeaderSize)
+		if err != nil {
+			return nil, err
+		}
+		filename, err := attachment.firstStr(charset, propAttachLongFilename, propAttachFilename, propDisplayName)
+		if err != nil {
+			return nil, err
+		}
+		contentID, err := attachment.str(propAttachContentID, charset)
+		if err != nil {
+			return nil, err
+		}
+		disposition := "Content-Disposition: attachment"
+		if contentID != "" {
+			disposition = "Content-Disposition: inline"
+		}
+		if filename != "" {
+			sections, err := EncodeParam("filename", filename, "UTF-8")
+			if err != nil {
+				return nil, err
+			}
+			disposition += ";\r\n " + strings.Join(sections, ";\r\n ")
+		}
+
+		var part *mimePart
+		if embedded := entry.find(fmt.Sprintf("__substg1.0_%04X%04X", propAttachData, typeObject)); embedded != nil && embedded.kind == cfbStorage {
+			inner, err := newMsgStorage(s.cf, embedded, msgEmbeddedHeaderSize)
+			if err != nil {
+				return nil, err
+			}
+			var message bytes.Buffer
+			if err := inner.writeMessage(&message, depth+1); err != nil {
+				return nil, err
+			}
+			part = &mimePart{header: []string{"Content-Type: message/rfc822"}, body: message.Bytes()}
+		} else {
+			data, _, err := attachment.stream(propAttachData, typeBinary)
+			if err != nil {
+				return nil, err
+			}
+			mediaType, err := attachment.str(propAttachMimeTag, charset)
+			if err != nil {
+				return nil, err
+			}
+			if mediaType == "" {
+				mediaType = "application/octet-stream"
+			}
+			part = &mimePart{
+				header: []string{"Content-Type: " + mediaType, "Content-Transfer-Encoding: base64"},
+				body:   base64Lines(data),
+			}
+		}
+		part.header = append(part.header, disposition)
+		if contentID != "" {
+			part.header = append(part.header, "Content-ID: <"+strings.Trim(contentID, "<>")+">")
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// base64Lines encodes data in base64 lines of 76 characters.
+func base64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b bytes.Buffer
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	return b.Bytes()
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConvertMSG(t *testing.T) {
+	data, err := os.ReadFile("../test_files/sample.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsMSG(data) {
+		t.Fatalf("expected the fixture to be recognized as .msg")
+	}
+	converted, err := ConvertMSG(data)
+	if err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+
+	headers, err := ReadHeaders(bytes.NewReader(converted))
+	if err != nil {
+		t.Fatalf("failed to read headers: %v", err)
+	}
+	var fields []string
+	for _, header := range headers {
+		fields = append(fields, header.Name+": "+header.Decoded)
+	}
+	expected := []string{
+		"From: 山田 太郎 <taro@example.jp>",
+		"To: Hanako <hanako@example.com>",
+		`Cc: "Doe, John" <john@example.com>`,
+		"Subject: 会議のお知らせ",
+		"Date: Mon, 01 Jan 2024 00:00:00 +0000",
+		"Message-ID: <msg1@example.jp>",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="=_gemm_mixed_0"`,
+	}
+	if strings.Join(fields, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected headers\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(fields, "\n"))
+	}
+
+	root, err := ParseMessage(bytes.NewReader(converted))
+	if err != nil {
+		t.Fatalf("failed to parse the converted message: %v", err)
+	}
+	testCases := []struct {
+		path      string
+		mediaType string
+		filename  string
+		content   string
+	}{
+		{"1.1", "text/plain", "", "本文です。\r\nFrom here.\r\n"},
+		{"1.2", "text/html", "", "<p>本文です。</p>"},
+		{"2", "text/plain", "報告書.txt", "report\r\n"},
+		{"3", "message/rfc822", "転送", "Subject: =?UTF-8?B?6L2i6YCB?=\r\nMessage-ID: <inner@example.com>\r\nMIME-Version: 1.0\r\n"},
+		{"3.1", "text/plain", "", "inner body\r\n"},
+		{"4", "application/octet-stream", "big.bin", ""},
+	}
+	for _, tc := range testCases {
+		part := root.Find(tc.path)
+		if part == nil {
+			t.Fatalf("part %s not found", tc.path)
+		}
+		if part.MediaType != tc.mediaType || part.Filename() != tc.filename {
+			t.Fatalf("part %s: expected %s %q, got %s %q", tc.path, tc.mediaType, tc.filename, part.MediaType, part.Filename())
+		}
+		var content string
+		if strings.HasPrefix(part.MediaType, "text/") {
+			content, err = part.Text()
+		} else {
+			var decoded []byte
+			decoded, err = part.Decode()
+			content = string(decoded)
+		}
+		if err != nil {
+			t.Fatalf("part %s: %v", tc.path, err)
+		}
+		if !strings.Contains(content, tc.content) {
+			t.Fatalf("part %s: expected %q in %q", tc.path, tc.content, content)
+		}
+	}
+	// the attachment larger than the mini stream cutoff is read from
+	// regular sectors
+	if size, _ := root.Find("4").DecodedSize(); size != 5000 {
+		t.Fatalf("expected 5000 bytes, got %d", size)
+	}
+}
+
+func TestConvertMSGANSI(t *testing.T) {
+	// ansi.msg has 8 bit strings in code page 932, see mkmsg.py
+	data, err := os.ReadFile("../test_files/ansi.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, err := ConvertMSG(data)
+	if err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	root, err := ParseMessage(bytes.NewReader(converted))
+	if err != nil {
+		t.Fatalf("failed to parse the converted message: %v", err)
+	}
+	if subject := root.Header.Get("Subject"); subject != "=?UTF-8?b?6KaL56mN44KC44KK44Gu5Lu2?=" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	testCases := []struct {
+		path    string
+		content string
+	}{
+		{"1.1", "お見積もりを送ります。\r\n"},
+		{"1.2", "<html><body><p>お見積もり</p></body></html>"},
+	}
+	for _, tc := range testCases {
+		text, err := root.Find(tc.path).Text()
+		if err != nil {
+			t.Fatalf("part %s: %v", tc.path, err)
+		}
+		if text != tc.content {
+			t.Errorf("part %s: expected %q, got %q", tc.path, tc.content, text)
+		}
+	}
+	if filename := root.Find("2").Filename(); filename != "見積書.txt" {
+		t.Errorf("expected 見積書.txt, got %q", filename)
+	}
+}
+
+func TestConvertMSGErrors(t *testing.T) {
+	data, err := os.ReadFile("../test_files/sample.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name        string
+		input       []byte
+		expectedErr string
+	}{
+		{"Not a compound file", []byte("From: a@example.com\r\n\r\nbody\r\n"), "not a compound file"},
+		{"Truncated", data[:1024], "directory: sector 1 is out of range"},
+		{"DIFAT loop", difatLoop(data), "broken DIFAT chain at 26"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ConvertMSG(tc.input); err == nil || err.Error() != tc.expectedErr {
+				t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// difatLoop returns data with a DIFAT sector appended whose next sector is
+// itself, and a DIFAT count that does not stop the chain.
+func difatLoop(data []byte) []byte {
+	looped := append([]byte{}, data...)
+	sector := uint32(len(looped)/512 - 1)
+	difat := bytes.Repeat([]byte{0xFF}, 512)
+	binary.LittleEndian.PutUint32(difat[508:], sector)
+	looped = append(looped, difat...)
+	binary.LittleEndian.PutUint32(looped[0x44:], sector)
+	binary.LittleEndian.PutUint32(looped[0x48:], 0xFFFFFFFF)
+	return looped
+}
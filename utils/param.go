@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/go-mime"
+)
+
+// paramSection is one piece of an RFC 2231 parameter such as filename*1*.
+type paramSection struct {
+	index    int
+	extended bool
+	value    string
+}
+
+// ParseHeaderParams parses a structured header value such as a Content-Type
+// or Content-Disposition into its lowercased value and parameters. RFC 2231
+// continuations are reassembled, percent-decoded and converted from their
+// charset to UTF-8, and RFC 2047 encoded-words inside quoted values are
+// decoded as well, since many mailers still send them.
+func ParseHeaderParams(s string) (string, map[string]string, error) {
+	items := splitParams(s)
+	value := strings.ToLower(strings.TrimSpace(items[0]))
+	params := make(map[string]string)
+	sections := make(map[string][]paramSection)
+
+	for _, item := range items[1:] {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq := strings.Index(item, "=")
+		if eq <= 0 {
+			return value, params, fmt.Errorf("invalid parameter %q", item)
+		}
+		name := strings.ToLower(strings.TrimSpace(item[:eq]))
+		raw := unquoteParam(strings.TrimSpace(item[eq+1:]))
+
+		section := paramSection{}
+		if strings.HasSuffix(name, "*") {
+			section.extended = true
+			name = strings.TrimSuffix(name, "*")
+		}
+		if star := strings.LastIndex(name, "*"); star >= 0 {
+			index, err := strconv.Atoi(name[star+1:])
+			if err != nil {
+				return value, params, fmt.Errorf("invalid parameter name %q", item[:eq])
+			}
+			section.index = index
+			name = name[:star]
+		} else if !section.extended {
+			// a plain parameter; RFC 2231 values take precedence below
+			if containsEncodedWord(raw) {
+				if decoded, err := gomime.DecodeHeader(raw); err == nil {
+					raw = decoded
+				}
+			}
+			params[name] = raw
+			continue
+		}
+		section.value = raw
+		sections[name] = append(sections[name], section)
+	}
+
+	for name, parts := range sections {
+		decoded, err := joinParamSections(parts)
+		if err != nil {
+			return value, params, fmt.Errorf("parameter %s: %v", name, err)
+		}
+		params[name] = decoded
+	}
+	return value, params, nil
+}
+
+// joinParamSections reassembles RFC 2231 sections in index order. Only the
+// first section carries the charset and language.
+func joinParamSections(parts []paramSection) (string, error) {
+	sort.Slice(parts, func(i, j int) bool { return parts[i].index < parts[j].index })
+
+	charset := ""
+	var buf []byte
+	for i, part := range parts {
+		if part.index != i {
+			return "", fmt.Errorf("missing section %d", i)
+		}
+		v := part.value
+		if part.extended {
+			if i == 0 {
+				fields := strings.SplitN(v, "'", 3)
+				if len(fields) != 3 {
+					return "", fmt.Errorf("missing charset and language in %q", v)
+				}
+				charset, v = fields[0], fields[2]
+			}
+			decoded, err := percentDecode(v)
+			if err != nil {
+				return "", err
+			}
+			buf = append(buf, decoded...)
+		} else {
+			buf = append(buf, v...)
+		}
+	}
+	if charset == "" {
+		return string(buf), nil
+	}
+	converted, err := DecodeCharset(buf, charset)
+	if err != nil {
+		return "", err
+	}
+	return string(converted), nil
+}
+
+// splitParams splits s on semicolons outside quoted-strings.
+func splitParams(s string) []string {
+	var items []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case ';':
+			if !inQuote {
+				items = append(items, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(items, s[start:])
+}
+
+func unquoteParam(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func percentDecode(s string) ([]byte, error) {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return nil, fmt.Errorf("truncated percent-encoding in %q", s)
+		}
+		c, ok := unhex(s[i+1], s[i+2])
+		if !ok {
+			return nil, fmt.Errorf("invalid percent-encoding in %q", s)
+		}
+		b = append(b, c)
+		i += 2
+	}
+	return b, nil
+}
+
+// maxParamSectionLength keeps each folded "name*N*=value;" line within 78
+// characters.
+const maxParamSectionLength = maxLineLength - 2
+
+// EncodeParam encodes a Content-Type or Content-Disposition parameter. A
+// short ASCII value is returned as a single, quoted if needed, name=value.
+// Other values use RFC 2231: non-ASCII values are converted to charset and
+// percent-encoded with the charset in the first section, and long values are
+// split into numbered continuations on character boundaries. Each returned
+// section fits on a folded line of its own.
+func EncodeParam(name, value, charset string) ([]string, error) {
+	name = strings.ToLower(name)
+	if isASCII(value) && !strings.ContainsAny(value, "\r\n") {
+		single := name + "=" + quoteParam(value)
+		if len(single) <= maxParamSectionLength {
+			return []string{single}, nil
+		}
+		return splitParam(name, value, "", func(s string) (string, error) {
+			return quoteParam(s), nil
+		})
+	}
+
+	mimeName, enc, err := LookupCharset(charset)
+	if err != nil {
+		return nil, err
+	}
+	if losses, err := unmappableRunes(value, charset); err != nil {
+		return nil, err
+	} else if len(losses) > 0 {
+		return nil, &UnmappableError{Charset: mimeName, Rune: losses[0].Rune, Offset: losses[0].Offset}
+	}
+	return splitParam(name, value, mimeName+"''", func(s string) (string, error) {
+		b, err := enc.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			return "", err
+		}
+		return percentEncode(b), nil
+	})
+}
+
+// splitParam splits value into as few name*N sections as fit, with prefix
+// before the first value. A non-empty prefix marks extended sections.
+func splitParam(name, value, prefix string, encode func(string) (string, error)) ([]string, error) {
+	marker := ""
+	if prefix != "" {
+		marker = "*"
+	}
+	section := func(i int, text string) (string, error) {
+		encoded, err := encode(text)
+		if err != nil {
+			return "", err
+		}
+		s := name + "*" + strconv.Itoa(i) + marker + "="
+		if i == 0 {
+			s += prefix
+		}
+		return s + encoded, nil
+	}
+
+	var sections []string
+	var chunk, current string
+	for _, r := range value {
+		candidate := chunk + string(r)
+		encoded, err := section(len(sections), candidate)
+		if err != nil {
+			return nil, err
+		}
+		if len(encoded) > maxParamSectionLength && chunk != "" {
+			sections = append(sections, current)
+			candidate = string(r)
+			if encoded, err = section(len(sections), candidate); err != nil {
+				return nil, err
+			}
+		}
+		chunk, current = candidate, encoded
+	}
+	if chunk != "" {
+		sections = append(sections, current)
+	}
+	if len(sections) == 1 && prefix != "" {
+		// a single extended section needs no number
+		sections[0] = name + "*" + strings.TrimPrefix(sections[0], name+"*0*")
+	}
+	return sections, nil
+}
+
+// quoteParam returns s as a token if it is one, and as a quoted-string
+// otherwise.
+func quoteParam(s string) string {
+	if s != "" && !strings.ContainsAny(s, ` ()<>@,;:\"/[]?=`) && isPrintableASCII(s) {
+		return s
+	}
+	return quotePhrase(s)
+}
+
+// percentEncode encodes the bytes that are not attribute-chars of RFC 2231.
+func percentEncode(b []byte) string {
+	const upperhex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for _, c := range b {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(upperhex[c>>4])
+		sb.WriteByte(upperhex[c&0x0f])
+	}
+	return sb.String()
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHeaderParams(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedValue string
+		expected      map[string]string
+	}{
+		{
+			name:          "Plain",
+			input:         `text/plain; charset="UTF-8"; format=flowed`,
+			expectedValue: "text/plain",
+			expected:      map[string]string{"charset": "UTF-8", "format": "flowed"},
+		},
+		{
+			name:          "Quoted semicolon",
+			input:         `attachment; filename="a;b \"c\".txt"`,
+			expectedValue: "attachment",
+			expected:      map[string]string{"filename": `a;b "c".txt`},
+		},
+		{
+			name:          "RFC 2231 UTF-8",
+			input:         `attachment; filename*=UTF-8''%E8%AB%8B%E6%B1%82%E6%9B%B8.pdf`,
+			expectedValue: "attachment",
+			expected:      map[string]string{"filename": "請求書.pdf"},
+		},
+		{
+			name:          "RFC 2231 continuations in ISO-2022-JP",
+			input:         "attachment;\r\n filename*0*=ISO-2022-JP'ja'%1B%24B%40A5a;\r\n filename*1*=%3Dq%1B%28B.pdf",
+			expectedValue: "attachment",
+			expected:      map[string]string{"filename": "請求書.pdf"},
+		},
+		{
+			name:          "RFC 2231 mixed extended and plain sections",
+			input:         `attachment; filename*1=".pdf"; filename*0*=UTF-8''%E8%AB%8B%E6%B1%82%E6%9B%B8`,
+			expectedValue: "attachment",
+			expected:      map[string]string{"filename": "請求書.pdf"},
+		},
+		{
+			name:          "RFC 2231 wins over plain",
+			input:         `attachment; filename="fallback.pdf"; filename*=UTF-8''%E8%AB%8B.pdf`,
+			expectedValue: "attachment",
+			expected:      map[string]string{"filename": "請.pdf"},
+		},
+		{
+			name:          "RFC 2047 in quotes",
+			input:         `image/png; name="=?UTF-8?B?55S75YOPLnBuZw==?="`,
+			expectedValue: "image/png",
+			expected:      map[string]string{"name": "画像.png"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, params, err := ParseHeaderParams(tc.input)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if value != tc.expectedValue {
+				t.Fatalf("expected value %s, got %s", tc.expectedValue, value)
+			}
+			if len(params) != len(tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, params)
+			}
+			for key, expected := range tc.expected {
+				if params[key] != expected {
+					t.Fatalf("expected %s to be %s, got %s", key, expected, params[key])
+				}
+			}
+		})
+	}
+
+	if _, _, err := ParseHeaderParams(`attachment; filename*1*=%41`); err == nil {
+		t.Fatalf("expected an error for a missing first section")
+	}
+}
+
+func TestEncodeParam(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		charset  string
+		expected []string
+	}{
+		{
+			name:     "Token",
+			input:    "report.pdf",
+			charset:  "UTF-8",
+			expected: []string{"filename=report.pdf"},
+		},
+		{
+			name:     "Quoted",
+			input:    `my "report".pdf`,
+			charset:  "UTF-8",
+			expected: []string{`filename="my \"report\".pdf"`},
+		},
+		{
+			name:     "Single extended section",
+			input:    "請求書.pdf",
+			charset:  "ISO-2022-JP",
+			expected: []string{"filename*=ISO-2022-JP''%1B$B%40A5a%3Dq%1B%28B.pdf"},
+		},
+		{
+			name:    "Continuations",
+			input:   "【重要】2024年度第3四半期売上報告書.pdf",
+			charset: "UTF-8",
+			expected: []string{
+				"filename*0*=UTF-8''%E3%80%90%E9%87%8D%E8%A6%81%E3%80%912024%E5%B9%B4",
+				"filename*1*=%E5%BA%A6%E7%AC%AC3%E5%9B%9B%E5%8D%8A%E6%9C%9F%E5%A3%B2%E4%B8%8A",
+				"filename*2*=%E5%A0%B1%E5%91%8A%E6%9B%B8.pdf",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sections, err := EncodeParam("filename", tc.input, tc.charset)
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			if strings.Join(sections, "|") != strings.Join(tc.expected, "|") {
+				t.Fatalf("expected %v, got %v", tc.expected, sections)
+			}
+			joined := strings.Join(sections, ";\r\n ")
+			for _, section := range sections {
+				if len(section)+2 > maxLineLength {
+					t.Fatalf("section longer than a folded line: %s", section)
+				}
+			}
+			_, params, err := ParseHeaderParams("attachment; " + joined)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if params["filename"] != tc.input {
+				t.Fatalf("expected round trip to give %s, got %s", tc.input, params["filename"])
+			}
+		})
+	}
+
+	if _, err := EncodeParam("filename", "㈱.pdf", "ISO-2022-JP"); err == nil {
+		t.Fatalf("expected an error for an unmappable character")
+	}
+}
@@ -1,133 +1,135 @@
 package utils
 
 import (
+	"bufio"
+	"errors"
 	"os"
+	"io"
 	"fmt"
-	"net/mail"
 	"strings"
-	"mime"
-	"golang.org/x/text/encoding/japanese"
 
 	"github.com/ProtonMail/go-mime"
 )
 
-func DecodeHeaders(filename string) (map[string]string, error) {
+// Header is a single header field in the order it appears in a message.
+// Raw is the unfolded field body and Position is the zero-based index of the
+// field within the header block. Err is set when an encoded-word of the
+// field cannot be decoded, in which case Decoded is left equal to Raw.
+type Header struct {
+	Name     string
+	Raw      string
+	Decoded  string
+	Position int
+	Err      error
+}
+
+// ErrNoEncodedHeader is returned by DecodeHeaders when a message has no
+// header with an encoded-word.
+var ErrNoEncodedHeader = errors.New("no encoded header found")
+
+// DecodeHeaders decodes the headers of the .eml or Outlook .msg file at
+// filename.
+func DecodeHeaders(filename string) ([]Header, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
-	byteData := make([]byte, 1000000)
-	count, err := file.Read(byteData)
+	r, err := NewMessageReader(file)
 	if err != nil {
 		return nil, err
 	}
-	message := string(byteData[:count])
-	mm, err := mail.ReadMessage(strings.NewReader(message))
+	return DecodeHeadersFrom(r)
+}
+
+// DecodeHeadersFrom reads the header block of a message from r and returns
+// every header containing an encoded-word, in file order. Reading stops at
+// the blank line that ends the header block, so the body is never loaded.
+func DecodeHeadersFrom(r io.Reader) ([]Header, error) {
+	headers, err := ReadHeaders(r)
 	if err != nil {
 		return nil, err
 	}
-	header := mm.Header
-	decodedHeaders := make(map[string]string)
-
-	for key, value := range header {
-		if containsEncodedWord(value[0]) {
-			decoded, err := gomime.DecodeHeader(value[0])
-			if err != nil {
-				return nil, err
-			}
-			decodedHeaders[key] = decoded
+	var decodedHeaders []Header
+	for _, header := range headers {
+		if containsEncodedWord(header.Raw) {
+			decodedHeaders = append(decodedHeaders, header)
 		}
 	}
 	// if no encoded word found, raise an error
 	if len(decodedHeaders) == 0 {
-		return nil, fmt.Errorf("no encoded header found")
+		return nil, ErrNoEncodedHeader
 	}
 	return decodedHeaders, nil
 }
 
-func containsEncodedWord(s string) bool {
-	// if space included, split by space
-	var components []string
-	if strings.Contains(s, " ") {
-		components = strings.Split(s, " ")
-	} else {
-		components = []string{s}
+// ReadHeaders reads every field of the header block from r, keeping repeated
+// fields and their order. Fields without encoded-words are returned with
+// Decoded equal to Raw. A field that fails to decode does not stop the
+// others; its error is kept in Err.
+func ReadHeaders(r io.Reader) ([]Header, error) {
+	headers, err := ReadRawHeaders(r)
+	if err != nil {
+		return nil, err
 	}
-	for _, component := range components {
-		if isEncodedWord(component) {
-			return true
+	for i := range headers {
+		headers[i].Decoded = headers[i].Raw
+		if containsEncodedWord(headers[i].Raw) {
+			decoded, err := gomime.DecodeHeader(headers[i].Raw)
+			if err != nil {
+				headers[i].Err = err
+				continue
+			}
+			headers[i].Decoded = decoded
 		}
 	}
-	return false
+	return headers, nil
 }
 
-func isEncodedWord(s string) bool {
-	if !strings.HasPrefix(s, "=?") || !strings.HasSuffix(s, "?=") {
-		return false
-	}
-	// if the number of "?" is not 4, return false
-	if strings.Count(s, "?") != 4 {
-		return false
-	}
-	// split into charset, encoding, and encoded text
-	s = strings.TrimPrefix(s, "=?")
-	s = strings.TrimSuffix(s, "?=")
-	slice := strings.Split(s, "?")
-	encoding := slice[1]
-	// if encoding is not "B" or "Q", return false
-	if encoding != "B" && encoding != "Q" {
-		return false
-	}
-	return true
-}
-
-var ValidCharsets = map[string]string{
-	"utf8":      "UTF-8",
-	"iso2022jp": "ISO-2022-JP",
-	"shiftjis":  "Shift_JIS",
-}
-
-func NormalizeCharset(input string) string {
-	input = strings.ToLower(input)
-	input = strings.ReplaceAll(input, "-", "")
-	input = strings.ReplaceAll(input, "_", "")
-	return input
-}
-
-func EncodeHeader(s, charset, encoding string) (string, error) {
-	var encodedBytes []byte
-	var err error
-
-	mappedCharset, ok := ValidCharsets[charset]
-	if !ok {
-		return "", fmt.Errorf("invalid charset")
-	}
+// ReadRawHeaders reads the header block like ReadHeaders but leaves Decoded
+// empty, so that headers which fail to decode can still be inspected.
+func ReadRawHeaders(r io.Reader) ([]Header, error) {
+	br := bufio.NewReader(r)
+	var headers []Header
+	lineNo := 0
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		lineNo++
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "" {
+			// blank line ends the header block
+			break
+		}
 
-	switch charset {
-	case "utf8":
-		encodedBytes = []byte(s)
-	case "iso2022jp":
-		encodedBytes, err = japanese.ISO2022JP.NewEncoder().Bytes([]byte(s))
-		if err != nil {
-			return "", err
+		if trimmed[0] == ' ' || trimmed[0] == '\t' {
+			if len(headers) == 0 {
+				return nil, fmt.Errorf("malformed header at line %d: continuation line without a field", lineNo)
+			}
+			headers[len(headers)-1].Raw += trimmed
+		} else {
+			colon := strings.Index(trimmed, ":")
+			if colon <= 0 {
+				return nil, fmt.Errorf("malformed header at line %d: %q", lineNo, trimmed)
+			}
+			headers = append(headers, Header{
+				Name:     strings.TrimRight(trimmed[:colon], " \t"),
+				Raw:      strings.TrimLeft(trimmed[colon+1:], " \t"),
+				Position: len(headers),
+			})
 		}
-	case "shiftjis":
-		encodedBytes, err = japanese.ShiftJIS.NewEncoder().Bytes([]byte(s))
-		if err != nil {
-			return "", err
+		if err == io.EOF {
+			break
 		}
-	default:
-		return "", fmt.Errorf("invalid charset")
+	}
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("no header found")
 	}
 
-	upperEncoding := strings.ToUpper(encoding)
-	switch upperEncoding {
-	case "B":
-		return mime.BEncoding.Encode(mappedCharset, string(encodedBytes)), nil
-	case "Q":
-		return mime.QEncoding.Encode(mappedCharset, string(encodedBytes)), nil
-	default:
-		return "", fmt.Errorf("invalid encoding")
+	for i := range headers {
+		headers[i].Raw = strings.TrimRight(headers[i].Raw, " \t")
 	}
-}
\ No newline at end of file
+	return headers, nil
+}
@@ -1,20 +1,24 @@
 package utils
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+)
 
 func TestDecodeHeaders(t *testing.T) {
 	testCases := []struct {
 		name     string
 		input    string
-		expected map[string]string
+		expected []Header
 	}{
 		{
-			name:     "Simple",
-			input:		"../test_files/simple.eml",
-			expected: map[string]string{
-				"From": "John Doe （ジョン　ドゥー） <john@example.com>",
-				"To": "ジェーン・ドゥー <jane@example.co.jp>",
-				"Subject": "Re: ご飯に行きませんか？",
+			name:  "Simple",
+			input: "../test_files/simple.eml",
+			expected: []Header{
+				{Name: "From", Decoded: "John Doe （ジョン　ドゥー） <john@example.com>", Position: 0},
+				{Name: "Subject", Decoded: "Re: ご飯に行きませんか？", Position: 1},
+				{Name: "To", Decoded: "ジェーン・ドゥー <jane@example.co.jp>", Position: 2},
 			},
 		},
 	}
@@ -28,11 +32,84 @@ func TestDecodeHeaders(t *testing.T) {
 			if len(decoded) != len(tc.expected) {
 				t.Fatalf("expected %d headers, got %d", len(tc.expected), len(decoded))
 			}
-			for key, value := range decoded {
-				if tc.expected[key] != value {
-					t.Fatalf("expected %s to be %s, got %s", key, tc.expected[key], value)
+			for i, header := range decoded {
+				expected := tc.expected[i]
+				if header.Name != expected.Name || header.Decoded != expected.Decoded || header.Position != expected.Position {
+					t.Fatalf("expected header %d to be %+v, got %+v", i, expected, header)
 				}
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestDecodeHeadersFrom(t *testing.T) {
+	// a body far larger than the old 1 MB buffer, read one byte at a time
+	message := "Subject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\r\n" +
+		"To: =?ISO-2022-JP?B?GyRCJDMkcyRLJEEkTxsoQg==?=\r\n" +
+		"\r\n" + strings.Repeat("x", 2000000)
+	r := iotest.OneByteReader(strings.NewReader(message))
+
+	decoded, err := DecodeHeadersFrom(r)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	expected := []string{"こんにちは", "こんにちは"}
+	if len(decoded) != len(expected) {
+		t.Fatalf("expected %d headers, got %d", len(expected), len(decoded))
+	}
+	for i, value := range expected {
+		if decoded[i].Decoded != value {
+			t.Fatalf("expected %s to be %s, got %s", decoded[i].Name, value, decoded[i].Decoded)
+		}
+	}
+}
+
+func TestReadHeaders(t *testing.T) {
+	message := "Received: from a.example by b.example;\r\n" +
+		"\tMon, 1 Jan 2024 00:00:01 +0000\r\n" +
+		"Subject: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\r\n" +
+		"Received: from c.example by a.example; Mon, 1 Jan 2024 00:00:00 +0000\r\n" +
+		"Subject: plain\r\n" +
+		"\r\n" +
+		"Subject: body\r\n"
+
+	headers, err := ReadHeaders(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("failed to read headers: %v", err)
+	}
+	expected := []Header{
+		{Name: "Received", Raw: "from a.example by b.example;\tMon, 1 Jan 2024 00:00:01 +0000", Decoded: "from a.example by b.example;\tMon, 1 Jan 2024 00:00:01 +0000", Position: 0},
+		{Name: "Subject", Raw: "=?UTF-8?B?44GT44KT44Gr44Gh44Gv?=", Decoded: "こんにちは", Position: 1},
+		{Name: "Received", Raw: "from c.example by a.example; Mon, 1 Jan 2024 00:00:00 +0000", Decoded: "from c.example by a.example; Mon, 1 Jan 2024 00:00:00 +0000", Position: 2},
+		{Name: "Subject", Raw: "plain", Decoded: "plain", Position: 3},
+	}
+	if len(headers) != len(expected) {
+		t.Fatalf("expected %d headers, got %d", len(expected), len(headers))
+	}
+	for i, header := range headers {
+		if header != expected[i] {
+			t.Fatalf("expected header %d to be %+v, got %+v", i, expected[i], header)
+		}
+	}
+}
+
+func TestReadHeadersUnknownCharset(t *testing.T) {
+	message := "Subject: =?x-unknown?B?YWJj?=\r\n" +
+		"To: =?UTF-8?B?44GT44KT44Gr44Gh44Gv?=\r\n" +
+		"\r\n"
+
+	headers, err := ReadHeaders(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("failed to read headers: %v", err)
+	}
+	if len(headers) != 2 {
+		t.Fatalf("expected 2 headers, got %d", len(headers))
+	}
+	// the field that fails keeps its raw value and does not stop the next
+	if subject := headers[0]; subject.Err == nil || subject.Decoded != subject.Raw {
+		t.Errorf("expected the raw subject and an error, got %+v", subject)
+	}
+	if to := headers[1]; to.Err != nil || to.Decoded != "こんにちは" {
+		t.Errorf("expected こんにちは, got %+v", to)
+	}
+}
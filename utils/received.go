@@ -0,0 +1,271 @@
+package utils
+
+import (
+	"net"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// skewTolerance is how far a hop may be dated before the previous one and
+// still be put down to clocks that disagree rather than to fields out of
+// order.
+const skewTolerance = 5 * time.Minute
+
+// Received is a parsed Received field as described by RFC 5321 section
+// 4.4. FromComment and ByComment are the first comments after the from and
+// by clauses, which usually hold the host name and address the relay saw
+// and the name of its software; Comments holds the others, such as the TLS
+// details added by Postfix.
+type Received struct {
+	From        string
+	FromComment string
+	By          string
+	ByComment   string
+	Via         string
+	With        string
+	ID          string
+	For         string
+	Comments    []string
+	// Date is zero if the field has no date or it cannot be parsed.
+	Date time.Time
+	Raw  string
+}
+
+// ParseReceived parses the value of a Received field. Clauses it does not
+// understand are kept with the clause before them rather than rejected.
+func ParseReceived(value string) Received {
+	r := Received{Raw: strings.TrimSpace(value)}
+	tokens, date := receivedTokens(value)
+	if date != "" {
+		if t, err := mail.ParseDate(date); err == nil {
+			r.Date = t
+		}
+	}
+
+	var clause *string
+	var comment *string
+	for _, token := range tokens {
+		if strings.HasPrefix(token, "(") {
+			text := strings.Join(strings.Fields(token[1:len(token)-1]), " ")
+			if comment != nil && *comment == "" {
+				*comment = text
+			} else {
+				r.Comments = append(r.Comments, text)
+			}
+			continue
+		}
+		next := map[string]*string{
+			"from": &r.From, "by": &r.By, "via": &r.Via,
+			"with": &r.With, "id": &r.ID, "for": &r.For,
+		}[strings.ToLower(token)]
+		if next != nil && (clause == nil || *clause != "") {
+			clause, comment = next, nil
+			switch next {
+			case &r.From:
+				comment = &r.FromComment
+			case &r.By:
+				comment = &r.ByComment
+			}
+			continue
+		}
+		if clause == nil {
+			continue
+		}
+		if *clause == "" {
+			*clause = token
+		} else {
+			*clause += " " + token
+		}
+	}
+	r.For = strings.Trim(r.For, "<>")
+	return r
+}
+
+// receivedTokens splits the clauses of a Received field into words and
+// parenthesized comments, and returns the date after the last semicolon
+// outside a comment.
+func receivedTokens(value string) (tokens []string, date string) {
+	var token strings.Builder
+	end := func() {
+		if token.Len() > 0 {
+			tokens = append(tokens, token.String())
+			token.Reset()
+		}
+	}
+	depth := 0
+	quoted := false
+	dateStart, clauses := -1, 0
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value):
+			token.WriteByte(c)
+			token.WriteByte(value[i+1])
+			i++
+		case quoted:
+			token.WriteByte(c)
+			quoted = c != '"'
+		case c == '(':
+			if depth == 0 {
+				end()
+			}
+			depth++
+			token.WriteByte(c)
+		case c == ')' && depth > 0:
+			depth--
+			token.WriteByte(c)
+			if depth == 0 {
+				end()
+			}
+		case depth > 0:
+			token.WriteByte(c)
+		case c == '"':
+			token.WriteByte(c)
+			quoted = true
+		case c == ';':
+			end()
+			dateStart, clauses = i+1, len(tokens)
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			end()
+		default:
+			token.WriteByte(c)
+		}
+	}
+	if depth > 0 {
+		// an unclosed comment runs to the end
+		token.WriteString(strings.Repeat(")", depth))
+	}
+	end()
+	if dateStart < 0 {
+		return tokens, ""
+	}
+	return tokens[:clauses], strings.TrimSpace(value[dateStart:])
+}
+
+var (
+	bracketedIP = regexp.MustCompile(`\[(?:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+	tlsVersion  = regexp.MustCompile(`(?i)\b(TLS ?v?1[._][0-3]|TLSv1|SSLv3)\b`)
+	tlsCipher   = regexp.MustCompile(`(?i)\bcipher[= ]([A-Z0-9_-]+)`)
+	// sharedAddresses is the carrier-grade NAT range of RFC 6598.
+	sharedAddresses = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+)
+
+// FromIP returns the address of the client the relay saw, taken from the
+// from clause and its comment, or nil if none is given.
+func (r Received) FromIP() net.IP {
+	for _, s := range []string{r.FromComment, r.From} {
+		if m := bracketedIP.FindStringSubmatch(s); m != nil {
+			if ip := net.ParseIP(m[1]); ip != nil {
+				return ip
+			}
+		}
+		for _, word := range strings.FieldsFunc(s, func(c rune) bool {
+			return strings.ContainsRune(" \t()[],", c)
+		}) {
+			if ip := net.ParseIP(strings.TrimPrefix(word, "IPv6:")); ip != nil {
+				return ip
+			}
+		}
+	}
+	return nil
+}
+
+// TLS reports whether the hop used TLS, either by a protocol of RFC 3848
+// such as ESMTPS or ESMTPSA, or by TLS details in a comment, which are
+// returned as the protocol version and cipher that were found.
+func (r Received) TLS() (bool, string) {
+	comments := append([]string{r.FromComment, r.ByComment, r.With}, r.Comments...)
+	text := strings.Join(comments, " ")
+	var details []string
+	if m := tlsVersion.FindStringSubmatch(text); m != nil {
+		details = append(details, m[1])
+	}
+	if m := tlsCipher.FindStringSubmatch(text); m != nil {
+		details = append(details, m[1])
+	}
+	withTLS := false
+	if words := strings.Fields(strings.ToUpper(r.With)); len(words) > 0 {
+		protocol := strings.TrimSuffix(words[0], "A")
+		withTLS = strings.HasSuffix(protocol, "SMTPS") || strings.HasSuffix(protocol, "LMTPS")
+	}
+	return withTLS || len(details) > 0, strings.Join(details, " ")
+}
+
+// IsPrivateIP reports whether ip is not routed on the Internet: a private
+// (RFC 1918 or RFC 4193), loopback, link-local or shared (RFC 6598) address.
+func IsPrivateIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || sharedAddresses.Contains(ip)
+}
+
+// Hop is one relay of a message.
+type Hop struct {
+	Received
+	// Delay is the time since the previous dated hop, or since the Date
+	// field for the first; it is only set if HasDelay is.
+	Delay    time.Duration
+	HasDelay bool
+	IP       net.IP
+	Private  bool
+	UsesTLS  bool
+	// TLSDetail is the TLS version and cipher, if the field gives them.
+	TLSDetail string
+	// Skew is set for a hop dated slightly before the previous one, and
+	// OutOfOrder when it is more than skewTolerance before it.
+	Skew       bool
+	OutOfOrder bool
+}
+
+// HopTrace is the route of a message taken from its Received fields.
+type HopTrace struct {
+	// Date is the Date field of the message, zero if missing.
+	Date time.Time
+	// Hops are in the order the message took, from the oldest Received
+	// field at the bottom of the header to the newest at the top.
+	Hops []Hop
+	// Total is the time from the Date field, or the first dated hop, to
+	// the last dated hop.
+	Total time.Duration
+}
+
+// TraceHops parses the Received fields among headers, as read by
+// ReadRawHeaders, and computes the delay of each hop.
+func TraceHops(headers []Header) *HopTrace {
+	trace := &HopTrace{}
+	var received []Received
+	for _, header := range headers {
+		switch {
+		case strings.EqualFold(header.Name, "Received"):
+			received = append(received, ParseReceived(header.Raw))
+		case strings.EqualFold(header.Name, "Date") && trace.Date.IsZero():
+			if t, err := mail.ParseDate(strings.TrimSpace(header.Raw)); err == nil {
+				trace.Date = t
+			}
+		}
+	}
+
+	start, last := trace.Date, trace.Date
+	for i := len(received) - 1; i >= 0; i-- {
+		hop := Hop{Received: received[i]}
+		hop.IP = hop.FromIP()
+		hop.Private = hop.IP != nil && IsPrivateIP(hop.IP)
+		hop.UsesTLS, hop.TLSDetail = hop.TLS()
+		if !hop.Date.IsZero() {
+			if !last.IsZero() {
+				hop.Delay, hop.HasDelay = hop.Date.Sub(last), true
+				hop.Skew = hop.Delay < 0 && hop.Delay >= -skewTolerance
+				hop.OutOfOrder = hop.Delay < -skewTolerance
+			}
+			if start.IsZero() {
+				start = hop.Date
+			}
+			last = hop.Date
+		}
+		trace.Hops = append(trace.Hops, hop)
+	}
+	if !start.IsZero() {
+		trace.Total = last.Sub(start)
+	}
+	return trace
+}
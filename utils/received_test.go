@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReceived(t *testing.T) {
+	testCases := []struct {
+		name      string
+		value     string
+		from      string
+		by        string
+		with      string
+		id        string
+		ip        string
+		tls       bool
+		tlsDetail string
+		date      string
+	}{
+		{
+			name: "Postfix with TLS",
+			value: "from mail.example.jp (mail.example.jp [192.0.2.10])\t(using TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits))" +
+				"\tby mx.example.com (Postfix) with ESMTPS id 4T3kQm0bZ7z9sHL\tfor <hanako@example.com>; Mon,  1 Jan 2024 09:00:12 +0900 (JST)",
+			from: "mail.example.jp", by: "mx.example.com", with: "ESMTPS", id: "4T3kQm0bZ7z9sHL",
+			ip: "192.0.2.10", tls: true, tlsDetail: "TLSv1.3 TLS_AES_256_GCM_SHA384",
+			date: "2024-01-01T09:00:12+09:00",
+		},
+		{
+			name:  "Gmail",
+			value: "from mail-sor-f41.google.com (mail-sor-f41.google.com. [209.85.220.41]) by mx.google.com with SMTPS id a1sor123 for <hanako@example.com> (Google Transport Security); Mon, 01 Jan 2024 00:00:05 -0800 (PST)",
+			from:  "mail-sor-f41.google.com", by: "mx.google.com", with: "SMTPS", id: "a1sor123",
+			ip: "209.85.220.41", tls: true, date: "2024-01-01T00:00:05-08:00",
+		},
+		{
+			name:  "Exchange",
+			value: "from EXCH01.corp.example.jp (10.1.2.3) by EXCH02.corp.example.jp (10.1.2.4) with Microsoft SMTP Server (version=TLS1_2, cipher=TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384) id 15.20.7; Mon, 1 Jan 2024 09:00:00 +0900",
+			from:  "EXCH01.corp.example.jp", by: "EXCH02.corp.example.jp", with: "Microsoft SMTP Server", id: "15.20.7",
+			ip: "10.1.2.3", tls: true, tlsDetail: "TLS1_2 TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+			date: "2024-01-01T09:00:00+09:00",
+		},
+		{
+			name:  "IPv6 without TLS",
+			value: "from relay.example.net ([IPv6:2001:db8::25]) by mx.example.com with ESMTP id 1A2B; Mon, 1 Jan 2024 00:00:00 +0000",
+			from:  "relay.example.net", by: "mx.example.com", with: "ESMTP", id: "1A2B",
+			ip: "2001:db8::25", date: "2024-01-01T00:00:00Z",
+		},
+		{
+			name:  "qmail",
+			value: "(qmail 1234 invoked by uid 89); 1 Jan 2024 00:00:00 -0000",
+			date:  "2024-01-01T00:00:00Z",
+		},
+		{
+			name:  "No date",
+			value: "from a.example.jp by b.example.jp with SMTP",
+			from:  "a.example.jp", by: "b.example.jp", with: "SMTP",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := ParseReceived(tc.value)
+			if r.From != tc.from || r.By != tc.by || r.With != tc.with || r.ID != tc.id {
+				t.Errorf("got from %q by %q with %q id %q", r.From, r.By, r.With, r.ID)
+			}
+			ip := ""
+			if addr := r.FromIP(); addr != nil {
+				ip = addr.String()
+			}
+			if ip != tc.ip {
+				t.Errorf("got IP %q, want %q", ip, tc.ip)
+			}
+			if tls, detail := r.TLS(); tls != tc.tls || detail != tc.tlsDetail {
+				t.Errorf("got TLS %v %q, want %v %q", tls, detail, tc.tls, tc.tlsDetail)
+			}
+			date := ""
+			if !r.Date.IsZero() {
+				date = r.Date.UTC().Format(time.RFC3339)
+				want, _ := time.Parse(time.RFC3339, tc.date)
+				if !r.Date.Equal(want) {
+					t.Errorf("got date %s, want %s", date, tc.date)
+				}
+			} else if tc.date != "" {
+				t.Errorf("no date, want %s", tc.date)
+			}
+		})
+	}
+}
+
+func TestTraceHops(t *testing.T) {
+	header := func(fields ...string) []Header {
+		var headers []Header
+		for _, field := range fields {
+			name, value, _ := strings.Cut(field, ": ")
+			headers = append(headers, Header{Name: name, Raw: value})
+		}
+		return headers
+	}
+
+	trace := TraceHops(header(
+		"Received: from c.example (c.example [192.0.2.3]) by d.example with ESMTP; Mon, 1 Jan 2024 08:00:00 +0900",
+		"Received: from b.example (b.example [100.64.0.2]) by c.example with ESMTP; Mon, 1 Jan 2024 09:00:30 +0900",
+		"Received: by b.example with HTTP; Sun, 31 Dec 2023 23:59:50 +0000",
+		"Received: from a.example by a.example; not a date",
+		"Date: Mon, 1 Jan 2024 09:00:00 +0900",
+	))
+	if len(trace.Hops) != 4 {
+		t.Fatalf("got %d hops", len(trace.Hops))
+	}
+	testCases := []struct {
+		by         string
+		delay      time.Duration
+		hasDelay   bool
+		private    bool
+		skew       bool
+		outOfOrder bool
+	}{
+		{by: "a.example"},
+		{by: "b.example", delay: -10 * time.Second, hasDelay: true, skew: true},
+		{by: "c.example", delay: 40 * time.Second, hasDelay: true, private: true},
+		{by: "d.example", delay: -time.Hour - 30*time.Second, hasDelay: true, outOfOrder: true},
+	}
+	for i, tc := range testCases {
+		hop := trace.Hops[i]
+		if hop.By != tc.by || hop.Delay != tc.delay || hop.HasDelay != tc.hasDelay ||
+			hop.Private != tc.private || hop.Skew != tc.skew || hop.OutOfOrder != tc.outOfOrder {
+			t.Errorf("hop %d: got by %s delay %s (%v) private %v skew %v out of order %v",
+				i+1, hop.By, hop.Delay, hop.HasDelay, hop.Private, hop.Skew, hop.OutOfOrder)
+		}
+	}
+	if trace.Total != -time.Hour {
+		t.Errorf("got total %s", trace.Total)
+	}
+}
@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNoRecord is returned by a TXTResolver for a name without TXT records.
+var ErrNoRecord = errors.New("no TXT record found")
+
+// TXTResolver looks up the TXT records of a DNS name, such as the DKIM key
+// record at sel._domainkey.example.com. The character strings of a record
+// are joined into one string.
+type TXTResolver interface {
+	LookupTXT(name string) ([]string, error)
+}
+
+// DNSResolver looks TXT records up in the DNS.
+type DNSResolver struct{}
+
+// LookupTXT implements TXTResolver.
+func (DNSResolver) LookupTXT(name string) ([]string, error) {
+	records, err := net.LookupTXT(name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, ErrNoRecord
+	}
+	return records, err
+}
+
+// TXTRecords is a local store of TXT records keyed by lowercase names
+// without a trailing dot, so that keys can be checked offline.
+type TXTRecords map[string][]string
+
+// LookupTXT implements TXTResolver.
+func (r TXTRecords) LookupTXT(name string) ([]string, error) {
+	records, ok := r[normalizeDNSName(name)]
+	if !ok || len(records) == 0 {
+		return nil, ErrNoRecord
+	}
+	return records, nil
+}
+
+// Add appends a record for name.
+func (r TXTRecords) Add(name, record string) {
+	name = normalizeDNSName(name)
+	r[name] = append(r[name], record)
+}
+
+func normalizeDNSName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// LoadTXTRecords reads a local key store: a JSON object mapping names to a
+// record or a list of records if the file ends in .json, and a DNS zone
+// file otherwise.
+func LoadTXTRecords(path string) (TXTRecords, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return LoadTXTJSON(path)
+	}
+	return LoadZoneFile(path)
+}
+
+// LoadTXTJSON reads TXT records from a JSON object such as
+// {"sel._domainkey.example.com": "v=DKIM1; k=ed25519; p=..."}.
+func LoadTXTJSON(path string) (TXTRecords, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	records := TXTRecords{}
+	for name, raw := range entries {
+		var record string
+		var list []string
+		if err := json.Unmarshal(raw, &record); err == nil {
+			records.Add(name, record)
+		} else if err := json.Unmarshal(raw, &list); err == nil {
+			for _, record := range list {
+				records.Add(name, record)
+			}
+		} else {
+			return nil, fmt.Errorf("%s: %s must be a string or a list of strings", path, name)
+		}
+	}
+	return records, nil
+}
+
+// LoadZoneFile reads the TXT records of a DNS zone file in the format of
+// RFC 1035. $ORIGIN, relative names, "@", parentheses and comments are
+// understood; records other than TXT are skipped.
+func LoadZoneFile(path string) (TXTRecords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := TXTRecords{}
+	origin := ""
+	owner := ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	var entry []string // tokens of an entry continued in parentheses
+	depth := 0
+	continued := false
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		tokens, opened, err := zoneTokens(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		if depth == 0 {
+			entry = tokens
+			// an entry starting with blank space belongs to the last owner
+			continued = line != "" && (line[0] == ' ' || line[0] == '\t')
+		} else {
+			entry = append(entry, tokens...)
+		}
+		depth += opened
+		if depth < 0 {
+			return nil, fmt.Errorf("%s:%d: unbalanced parentheses", path, lineNo)
+		}
+		if depth > 0 || len(entry) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(entry[0]) {
+		case "$ORIGIN":
+			if len(entry) > 1 {
+				origin = normalizeDNSName(entry[1])
+			}
+			continue
+		case "$TTL", "$INCLUDE", "$GENERATE":
+			continue
+		}
+		if !continued {
+			owner = absoluteName(entry[0], origin)
+			entry = entry[1:]
+		}
+		// skip the TTL and class in either order
+		for len(entry) > 0 && (isTTL(entry[0]) || isDNSClass(entry[0])) {
+			entry = entry[1:]
+		}
+		if len(entry) == 0 || !strings.EqualFold(entry[0], "TXT") {
+			continue
+		}
+		records.Add(owner, strings.Join(entry[1:], ""))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%s: unbalanced parentheses", path)
+	}
+	return records, nil
+}
+
+// zoneTokens splits a zone file line into its fields, unquoting character
+// strings and dropping parentheses and comments. opened counts the
+// parentheses left open.
+func zoneTokens(line string) (tokens []string, opened int, err error) {
+	var token strings.Builder
+	inToken, quoted := false, false
+	end := func() {
+		if inToken {
+			tokens = append(tokens, token.String())
+			token.Reset()
+			inToken = false
+		}
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			// \DDD is a decimal byte, anything else is itself
+			if i+3 < len(line) && isDigits(line[i+1:i+4]) {
+				n, _ := strconv.Atoi(line[i+1 : i+4])
+				token.WriteByte(byte(n))
+				i += 3
+			} else {
+				token.WriteByte(line[i+1])
+				i++
+			}
+			inToken = true
+		case c == '"':
+			end()
+			quoted = !quoted
+			// an empty quoted string is still a token
+			inToken = quoted
+		case quoted:
+			token.WriteByte(c)
+		case c == ';':
+			end()
+			return tokens, opened, nil
+		case c == '(':
+			end()
+			opened++
+		case c == ')':
+			end()
+			opened--
+		case c == ' ' || c == '\t':
+			end()
+		default:
+			token.WriteByte(c)
+			inToken = true
+		}
+	}
+	if quoted {
+		return nil, 0, fmt.Errorf("unterminated quoted string")
+	}
+	end()
+	return tokens, opened, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// absoluteName resolves an owner name of a zone file against the origin.
+func absoluteName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."), origin == "":
+		return normalizeDNSName(name)
+	}
+	return normalizeDNSName(name) + "." + origin
+}
+
+// isTTL reports whether s is a TTL such as 3600 or 1h.
+func isTTL(s string) bool {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return false
+	}
+	for _, c := range strings.ToLower(s) {
+		if (c < '0' || c > '9') && !strings.ContainsRune("smhdw", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDNSClass(s string) bool {
+	switch strings.ToUpper(s) {
+	case "IN", "CH", "HS", "CS":
+		return true
+	}
+	return false
+}
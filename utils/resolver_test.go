@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadZoneFile(t *testing.T) {
+	zone := `$ORIGIN example.com.
+$TTL 1h
+@          IN  TXT   "v=spf1 -all"
+sel._domainkey 300 IN TXT ( "v=DKIM1; "   ; split over lines
+                            "p=AB\"C\059" )
+           IN  TXT   unquoted
+other.example.net.  TXT  "a" "b"
+mail       IN  A     192.0.2.1
+`
+	path := filepath.Join(t.TempDir(), "keys.zone")
+	if err := os.WriteFile(path, []byte(zone), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	records, err := LoadZoneFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := TXTRecords{
+		"example.com":                {"v=spf1 -all"},
+		"sel._domainkey.example.com": {`v=DKIM1; p=AB"C;`, "unquoted"},
+		"other.example.net":          {"ab"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %v, got %v", expected, records)
+	}
+	if found, err := records.LookupTXT("SEL._domainkey.Example.com."); err != nil || len(found) != 2 {
+		t.Errorf("expected a case-insensitive lookup, got %v, %v", found, err)
+	}
+	if _, err := records.LookupTXT("missing.example.com"); err != ErrNoRecord {
+		t.Errorf("expected ErrNoRecord, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("a TXT ( \"b\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadZoneFile(path); err == nil {
+		t.Errorf("expected an error for unbalanced parentheses")
+	}
+}
+
+func TestLoadTXTJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`{"A.example.com.": "one", "b.example.com": ["two", "three"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	records, err := LoadTXTRecords(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := TXTRecords{"a.example.com": {"one"}, "b.example.com": {"two", "three"}}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %v, got %v", expected, records)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"a.example.com": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTXTJSON(path); err == nil {
+		t.Errorf("expected an error for a number")
+	}
+}
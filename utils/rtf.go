@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// rtfPrebuffer fills the dictionary of compressed RTF before the first
+// byte is read, as given in [MS-OXRTFCP].
+const rtfPrebuffer = "{\\rtf1\\ansi\\mac\\deff0\\deftab720{\\fonttbl;}{\\f0\\fnil \\froman " +
+	"\\fswiss \\fmodern \\fscript \\fdecor MS Sans SerifSymbolArialTimes New RomanCourier" +
+	"{\\colortbl\\red0\\green0\\blue0\r\n\\par \\pard\\plain\\f0\\fs20\\b\\i\\u\\tab\\tx"
+
+const (
+	rtfCompressed   = 0x75465A4C // "LZFu"
+	rtfUncompressed = 0x414C454D // "MELA"
+)
+
+// DecompressRTF undoes the LZFu compression of PR_RTF_COMPRESSED, the RTF
+// body of Outlook messages and TNEF streams.
+func DecompressRTF(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("compressed RTF is too short")
+	}
+	le := binary.LittleEndian
+	compressedSize := int(le.Uint32(data))
+	rawSize := int(le.Uint32(data[4:]))
+	// the compressed size counts the header after itself
+	end := compressedSize + 4
+	if end > len(data) {
+		end = len(data)
+	}
+	if end < 16 {
+		return nil, fmt.Errorf("compressed RTF has a bad size %d", compressedSize)
+	}
+	switch le.Uint32(data[8:]) {
+	case rtfUncompressed:
+		input := data[16:end]
+		if rawSize < len(input) {
+			input = input[:rawSize]
+		}
+		return input, nil
+	case rtfCompressed:
+	default:
+		return nil, fmt.Errorf("unknown RTF compression %08X", le.Uint32(data[8:]))
+	}
+
+	input := data[16:end]
+	if rtfCRC(input) != le.Uint32(data[12:]) {
+		return nil, fmt.Errorf("compressed RTF has a bad CRC")
+	}
+
+	var dictionary [4096]byte
+	copy(dictionary[:], rtfPrebuffer)
+	write := len(rtfPrebuffer)
+	// a control byte and eight references of 2 bytes give at most 8*17
+	// bytes, so the raw size is only trusted up to that
+	size := rawSize
+	if size > 8*len(input) {
+		size = 8 * len(input)
+	}
+	out := make([]byte, 0, size)
+	for i := 0; i < len(input); {
+		control := input[i]
+		i++
+		for bit := 0; bit < 8 && i < len(input); bit++ {
+			if control&(1<<bit) == 0 {
+				dictionary[write] = input[i]
+				write = (write + 1) % len(dictionary)
+				out = append(out, input[i])
+				i++
+				continue
+			}
+			if i+1 >= len(input) {
+				return nil, fmt.Errorf("compressed RTF is truncated")
+			}
+			reference := int(input[i])<<8 | int(input[i+1])
+			i += 2
+			offset := reference >> 4
+			if offset == write {
+				// a reference to the write position ends the stream
+				return out, nil
+			}
+			for n := 0; n < reference&0xF+2; n++ {
+				b := dictionary[(offset+n)%len(dictionary)]
+				dictionary[write] = b
+				write = (write + 1) % len(dictionary)
+				out = append(out, b)
+			}
+		}
+	}
+	return out, nil
+}
+
+// rtfCRC is the CRC of compressed RTF, which is CRC-32 without the
+// inversions at the start and end.
+func rtfCRC(data []byte) uint32 {
+	return ^crc32.Update(^uint32(0), crc32.IEEETable, data)
+}
+
+// rtfSkippedDestinations are groups whose text is not part of the document.
+var rtfSkippedDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true,
+	"pict": true, "object": true, "header": true, "footer": true,
+}
+
+// rtfGroup is the state of an RTF group that matters to HTMLFromRTF.
+type rtfGroup struct {
+	skip     bool // a destination whose text is dropped
+	htmlrtf  bool // inside \htmlrtf, which marks RTF-only content
+	unicodeN int  // characters following \u to skip, set by \uc
+}
+
+// HTMLFromRTF returns the HTML encapsulated in RTF by Exchange, which marks
+// it with \fromhtml1, following [MS-OXRTFEX]. ok is false for RTF that did
+// not come from HTML.
+func HTMLFromRTF(rtf []byte) (html string, ok bool) {
+	header := rtf
+	if len(header) > 1024 {
+		header = header[:1024]
+	}
+	if !bytes.Contains(header, []byte(`\fromhtml`)) {
+		return "", false
+	}
+
+	charset := "windows-1252"
+	var out strings.Builder
+	var pending []byte // \'hh bytes, decoded together as they may form one character
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		text, err := DecodeCharset(pending, charset)
+		if err != nil {
+			text = []byte(strings.ToValidUTF8(string(pending), "�"))
+		}
+		out.Write(text)
+		pending = pending[:0]
+	}
+
+	state := rtfGroup{unicodeN: 1}
+	var stack []rtfGroup
+	skipChars := 0 // fallback characters left after \u
+	emit := func(s string) {
+		if skipChars > 0 {
+			skipChars--
+			return
+		}
+		if state.skip || state.htmlrtf {
+			return
+		}
+		flush()
+		out.WriteString(s)
+	}
+
+	for i := 0; i < len(rtf); {
+		c := rtf[i]
+		switch c {
+		case '{':
+			stack = append(stack, state)
+			i++
+			// {\*\name ...} is an optional destination, dropped unless it is
+			// an \htmltag holding encapsulated HTML
+			if bytes.HasPrefix(rtf[i:], []byte(`\*\`)) {
+				word, _, _, _ := readControlWord(rtf, i+2)
+				if word != "htmltag" {
+					state.skip = true
+				}
+			} else if i < len(rtf) && rtf[i] == '\\' {
+				if word, _, _, _ := readControlWord(rtf, i); rtfSkippedDestinations[word] {
+					state.skip = true
+				}
+			}
+		case '}':
+			if len(stack) > 0 {
+				state = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+			i++
+		case '\\':
+			word, param, hasParam, next := readControlWord(rtf, i)
+			i = next
+			switch word {
+			case "":
+				// a control symbol such as \{ or \'hh
+				if i >= len(rtf) {
+					break
+				}
+				symbol := rtf[i]
+				i++
+				switch symbol {
+				case '\'':
+					if i+2 > len(rtf) {
+						break
+					}
+					b, err := strconv.ParseUint(string(rtf[i:i+2]), 16, 8)
+					i += 2
+					if err != nil {
+						break
+					}
+					if skipChars > 0 {
+						skipChars--
+					} else if !state.skip && !state.htmlrtf {
+						pending = append(pending, byte(b))
+					}
+				case '{', '}', '\\':
+					emit(string(symbol))
+				case '~':
+					emit(" ")
+				}
+			case "htmlrtf":
+				state.htmlrtf = !hasParam || param != 0
+			case "ansicpg":
+				charset = codepageCharset(uint32(param))
+			case "par", "line":
+				emit("\r\n")
+			case "tab":
+				emit("\t")
+			case "uc":
+				state.unicodeN = param
+			case "u":
+				if param < 0 {
+					param += 0x10000
+				}
+				emit(string(rune(param)))
+				skipChars = state.unicodeN
+			}
+		case '\r', '\n':
+			i++
+		default:
+			r, size := utf8.DecodeRune(rtf[i:])
+			emit(string(r))
+			i += size
+		}
+	}
+	flush()
+	return out.String(), true
+}
+
+// readControlWord reads the control word at rtf[i], which starts with a
+// backslash, and returns its name, its numeric parameter and the index
+// following it. The name is empty for a control symbol such as \{, whose
+// symbol is left at the returned index.
+func readControlWord(rtf []byte, i int) (word string, param int, hasParam bool, next int) {
+	start := i + 1
+	end := start
+	for end < len(rtf) && (rtf[end] >= 'a' && rtf[end] <= 'z' || rtf[end] >= 'A' && rtf[end] <= 'Z') {
+		end++
+	}
+	if end == start {
+		return "", 0, false, start
+	}
+	word = string(rtf[start:end])
+	digits := end
+	if digits < len(rtf) && rtf[digits] == '-' {
+		digits++
+	}
+	for digits < len(rtf) && rtf[digits] >= '0' && rtf[digits] <= '9' {
+		digits++
+	}
+	if n, err := strconv.Atoi(string(rtf[end:digits])); err == nil {
+		param, hasParam, end = n, true, digits
+	}
+	if end < len(rtf) && rtf[end] == ' ' {
+		// a space only delimits the control word
+		end++
+	}
+	return word, param, hasParam, end
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecompressRTF(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			// the examples of [MS-OXRTFCP] section 4
+			name:     "Literals",
+			input:    "2d0000002b0000004c5a4675f1c5c7a703000a007263706731323542320af32068656c090020627705b06c647d0a800fa0",
+			expected: "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n",
+		},
+		{
+			name:     "Dictionary references",
+			input:    "1a0000001c0000004c5a4675e2d44b51410004205758595a0d6e7d010eb0",
+			expected: "{\\rtf1 WXYZWXYZWXYZWXYZWXYZ}",
+		},
+		{
+			name:     "Uncompressed",
+			input:    "12000000060000004d454c41000000007b5c7274667d",
+			expected: "{\\rtf}",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input, err := hex.DecodeString(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := DecompressRTF(input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(output) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, output)
+			}
+		})
+	}
+
+	if _, err := DecompressRTF([]byte("short")); err == nil {
+		t.Errorf("expected an error for a short input")
+	}
+
+	literals, _ := hex.DecodeString(testCases[0].input)
+	literals[len(literals)-1] ^= 1
+	if _, err := DecompressRTF(literals); err == nil || err.Error() != "compressed RTF has a bad CRC" {
+		t.Errorf("changed data: got %v", err)
+	}
+
+	// a raw size of 4 GiB is not allocated up front
+	references, _ := hex.DecodeString(testCases[1].input)
+	copy(references[4:], []byte{0xFF, 0xFF, 0xFF, 0xFF})
+	output, err := DecompressRTF(references)
+	if err != nil || string(output) != testCases[1].expected || cap(output) > 8*len(references) {
+		t.Errorf("huge raw size: got %q (capacity %d), %v", output, cap(output), err)
+	}
+}
+
+func TestHTMLFromRTF(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+		ok       bool
+	}{
+		{
+			name: "Encapsulated HTML",
+			input: `{\rtf1\ansi\ansicpg932\fromhtml1 \deff0{\fonttbl{\f0\fswiss MS PGothic;}}` +
+				`{\*\htmltag19 <html>}{\*\htmltag64 <p>}\htmlrtf {\htmlrtf0 \'96\'7b\'95\'b6\u12391?\'82\'b7\htmlrtf }\htmlrtf0 ` +
+				`{\*\htmltag72 </p>}\htmlrtf \par\htmlrtf0 {\*\htmltag0 \par }{\*\htmltag27 </html>}}`,
+			expected: "<html><p>本文です</p>\r\n</html>",
+			ok:       true,
+		},
+		{
+			name:     "Escaped braces",
+			input:    `{\rtf1\ansi\fromhtml1 {\*\htmltag0 <style>p \{margin:0\}</style>}{\*\mhtmltag0 ignored}}`,
+			expected: "<style>p {margin:0}</style>",
+			ok:       true,
+		},
+		{
+			name:  "Plain RTF",
+			input: `{\rtf1\ansi\pard hello}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			html, ok := HTMLFromRTF([]byte(tc.input))
+			if ok != tc.ok || html != tc.expected {
+				t.Errorf("expected %q, %v, got %q, %v", tc.expected, tc.ok, html, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,645 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"mime"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// tnefSignature starts every TNEF stream, the winmail.dat Exchange sends
+// as application/ms-tnef.
+const tnefSignature = 0x223E9F78
+
+// TNEF attributes as listed in [MS-OXTNEF]. Only the low word, the
+// attribute ID, is compared; the high word repeats the data type.
+const (
+	attSubject        = 0x8004
+	attMessageClass   = 0x8008
+	attBody           = 0x800C
+	attAttachData     = 0x800F
+	attAttachTitle    = 0x8010
+	attAttachRenddata = 0x9002
+	attMAPIProps      = 0x9003
+	attAttachment     = 0x9005
+	attOemCodepage    = 0x9007
+)
+
+// tnefLevelAttachment marks the attributes of an attachment; those of the
+// message have level 1.
+const tnefLevelAttachment = 2
+
+// MAPI properties read from TNEF besides those shared with .msg files.
+const (
+	propRTFCompressed = 0x1009
+	propAttachMethod  = 0x3705
+)
+
+// MAPI property types, the fixed size ones besides those in msg.go.
+const (
+	typeShort    = 0x0002
+	typeLong     = 0x0003
+	typeFloat    = 0x0004
+	typeDouble   = 0x0005
+	typeCurrency = 0x0006
+	typeAppTime  = 0x0007
+	typeError    = 0x000A
+	typeBoolean  = 0x000B
+	typeI8       = 0x0014
+	typeSystime  = 0x0040
+	typeCLSID    = 0x0048
+	typeMulti    = 0x1000
+)
+
+// iidMessage is IID_IMessage as it is stored in a PT_OBJECT value: an
+// attachment holding it carries an embedded message as a TNEF stream.
+var iidMessage = []byte{0x07, 0x03, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+
+// MAPIProperty is a property of a TNEF message or attachment. Named
+// properties, which have IDs from 0x8000, also carry their property set and
+// name or numeric ID in Name. Value is a string, []byte, int64, float64,
+// bool or time.Time, or a slice of them for multi-valued properties.
+type MAPIProperty struct {
+	ID    uint16
+	Type  uint16
+	Name  string
+	Value interface{}
+}
+
+// propertyNames are the canonical names of properties commonly found in
+// TNEF streams.
+var propertyNames = map[uint16]string{
+	0x001A:                   "PR_MESSAGE_CLASS",
+	0x0017:                   "PR_IMPORTANCE",
+	0x0026:                   "PR_PRIORITY",
+	0x0036:                   "PR_SENSITIVITY",
+	propSubject:              "PR_SUBJECT",
+	propClientSubmitTime:     "PR_CLIENT_SUBMIT_TIME",
+	propSentRepresentingName: "PR_SENT_REPRESENTING_NAME",
+	propSentRepresentingAddr: "PR_SENT_REPRESENTING_EMAIL_ADDRESS",
+	0x0070:                   "PR_CONVERSATION_TOPIC",
+	0x0071:                   "PR_CONVERSATION_INDEX",
+	propTransportHeaders:     "PR_TRANSPORT_MESSAGE_HEADERS",
+	propSenderName:           "PR_SENDER_NAME",
+	propSenderAddr:           "PR_SENDER_EMAIL_ADDRESS",
+	propDeliveryTime:         "PR_MESSAGE_DELIVERY_TIME",
+	0x0E07:                   "PR_MESSAGE_FLAGS",
+	0x0E08:                   "PR_MESSAGE_SIZE",
+	propBody:                 "PR_BODY",
+	propRTFCompressed:        "PR_RTF_COMPRESSED",
+	propHTML:                 "PR_HTML",
+	propInternetMessageID:    "PR_INTERNET_MESSAGE_ID",
+	0x3007:                   "PR_CREATION_TIME",
+	0x3008:                   "PR_LAST_MODIFICATION_TIME",
+	propDisplayName:          "PR_DISPLAY_NAME",
+	propEmailAddress:         "PR_EMAIL_ADDRESS",
+	propAttachData:           "PR_ATTACH_DATA",
+	0x3703:                   "PR_ATTACH_EXTENSION",
+	propAttachFilename:       "PR_ATTACH_FILENAME",
+	propAttachMethod:         "PR_ATTACH_METHOD",
+	propAttachLongFilename:   "PR_ATTACH_LONG_FILENAME",
+	0x370B:                   "PR_RENDERING_POSITION",
+	propAttachMimeTag:        "PR_ATTACH_MIME_TAG",
+	propAttachContentID:      "PR_ATTACH_CONTENT_ID",
+	0x3714:                   "PR_ATTACH_FLAGS",
+	propInternetCodepage:     "PR_INTERNET_CPID",
+	propMessageCodepage:      "PR_MESSAGE_CODEPAGE",
+}
+
+// Tag returns the property tag, such as "0x0037001F".
+func (p MAPIProperty) Tag() string {
+	return fmt.Sprintf("0x%04X%04X", p.ID, p.Type)
+}
+
+// CanonicalName returns the name of the property, such as "PR_SUBJECT",
+// the name of a named property, or an empty string if it is unknown.
+func (p MAPIProperty) CanonicalName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return propertyNames[p.ID]
+}
+
+// String formats the value of the property. Long binary values are cut
+// short.
+func (p MAPIProperty) String() string {
+	return formatPropertyValue(p.Value)
+}
+
+func formatPropertyValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		const limit = 32
+		if len(v) > limit {
+			return fmt.Sprintf("%X... (%d bytes)", v[:limit], len(v))
+		}
+		return fmt.Sprintf("%X", v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, value := range v {
+			values[i] = formatPropertyValue(value)
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// TNEF is a parsed TNEF stream: the message properties, the plain text
+// body of attBody, and the attachments.
+type TNEF struct {
+	MessageClass string
+	Subject      string
+	Body         string
+	Properties   []MAPIProperty
+	Attachments  []*TNEFAttachment
+	charset      string
+}
+
+// TNEFAttachment is an attachment of a TNEF stream. Title is the short
+// filename of attAttachTitle, decoded from the OEM code page of the stream.
+type TNEFAttachment struct {
+	Title      string
+	Data       []byte
+	Properties []MAPIProperty
+	// Embedded is true when Data is an attached message, itself a TNEF
+	// stream.
+	Embedded bool
+}
+
+// IsTNEF reports whether data starts with the TNEF signature.
+func IsTNEF(data []byte) bool {
+	return len(data) >= 4 && binary.LittleEndian.Uint32(data) == tnefSignature
+}
+
+// ParseTNEF parses a TNEF stream. A stream cut short keeps the attributes
+// read before the cut.
+func ParseTNEF(data []byte) (*TNEF, error) {
+	if !IsTNEF(data) || len(data) < 6 {
+		return nil, fmt.Errorf("not a TNEF stream")
+	}
+	le := binary.LittleEndian
+	t := &TNEF{}
+	var attachment *TNEFAttachment
+	// the signature is followed by a 16 bit legacy key
+	for offset := 6; offset+9 <= len(data); {
+		level := data[offset]
+		id := uint16(le.Uint32(data[offset+1:]))
+		length := int(le.Uint32(data[offset+5:]))
+		start := offset + 9
+		if length < 0 || start+length+2 > len(data) {
+			break
+		}
+		value := data[start : start+length]
+		if checksum := le.Uint16(data[start+length:]); checksum != tnefChecksum(value) {
+			return nil, fmt.Errorf("attribute %04X has a bad checksum", id)
+		}
+		offset = start + length + 2
+
+		if level == tnefLevelAttachment && id == attAttachRenddata {
+			attachment = &TNEFAttachment{}
+			t.Attachments = append(t.Attachments, attachment)
+			continue
+		}
+		if level == tnefLevelAttachment {
+			if attachment == nil {
+				return nil, fmt.Errorf("attribute %04X precedes the first attachment", id)
+			}
+			if err := t.attachmentAttribute(attachment, id, value); err != nil {
+				return nil, fmt.Errorf("attachment %d: %v", len(t.Attachments), err)
+			}
+			continue
+		}
+		switch id {
+		case attOemCodepage:
+			if len(value) >= 4 {
+				t.charset = codepageCharset(le.Uint32(value))
+			}
+		case attMessageClass:
+			t.MessageClass = t.decodeString(value)
+		case attSubject:
+			t.Subject = t.decodeString(value)
+		case attBody:
+			t.Body = t.decodeString(value)
+		case attMAPIProps:
+			properties, err := t.parseProperties(value)
+			if err != nil {
+				return nil, fmt.Errorf("message properties: %v", err)
+			}
+			t.Properties = append(t.Properties, properties...)
+		}
+	}
+	return t, nil
+}
+
+// attachmentAttribute applies an attachment level attribute.
+func (t *TNEF) attachmentAttribute(attachment *TNEFAttachment, id uint16, value []byte) error {
+	switch id {
+	case attAttachTitle:
+		attachment.Title = t.decodeString(value)
+	case attAttachData:
+		attachment.Data = value
+	case attAttachment:
+		properties, err := t.parseProperties(value)
+		if err != nil {
+			return fmt.Errorf("properties: %v", err)
+		}
+		attachment.Properties = append(attachment.Properties, properties...)
+		attachment.setObject()
+	}
+	return nil
+}
+
+func tnefChecksum(b []byte) uint16 {
+	var sum uint16
+	for _, c := range b {
+		sum += uint16(c)
+	}
+	return sum
+}
+
+// decodeString decodes 8 bit text in the OEM code page of the stream.
+func (t *TNEF) decodeString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	text, err := DecodeCharset(b, t.charset)
+	if err != nil {
+		return strings.ToValidUTF8(string(b), "�")
+	}
+	return string(text)
+}
+
+// parseProperties parses the property list of attMAPIProps or
+// attAttachment.
+func (t *TNEF) parseProperties(b []byte) ([]MAPIProperty, error) {
+	r := &propertyReader{b: b}
+	count := r.uint32()
+	var properties []MAPIProperty
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		p := MAPIProperty{Type: r.uint16(), ID: r.uint16()}
+		if p.ID >= 0x8000 {
+			p.Name = r.propertyName()
+		}
+		if p.Type&typeMulti != 0 {
+			n := r.uint32()
+			var values []interface{}
+			for j := uint32(0); j < n && r.err == nil; j++ {
+				values = append(values, t.readValue(r, p.Type&^typeMulti, true))
+			}
+			p.Value = values
+		} else {
+			p.Value = t.readValue(r, p.Type, false)
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("property %04X: %v", p.ID, r.err)
+		}
+		properties = append(properties, p)
+	}
+	return properties, r.err
+}
+
+// readValue reads one value of the given type. Variable size values of a
+// single-valued property are preceded by a count, which is always 1.
+func (t *TNEF) readValue(r *propertyReader, kind uint16, multi bool) interface{} {
+	switch kind {
+	case typeShort:
+		return int64(int16(r.uint32()))
+	case typeLong, typeError:
+		return int64(int32(r.uint32()))
+	case typeBoolean:
+		return r.uint32() != 0
+	case typeFloat:
+		return float64(math.Float32frombits(r.uint32()))
+	case typeDouble, typeAppTime:
+		return math.Float64frombits(r.uint64())
+	case typeCurrency, typeI8:
+		return int64(r.uint64())
+	case typeSystime:
+		return filetime(r.uint64())
+	case typeCLSID:
+		return r.bytes(16)
+	case typeString8, typeUnicode, typeBinary, typeObject:
+		if !multi {
+			r.uint32()
+		}
+		b := r.bytes(int(r.uint32()))
+		r.pad()
+		switch kind {
+		case typeString8:
+			return t.decodeString(b)
+		case typeUnicode:
+			return decodeUTF16(b)
+		}
+		return b
+	}
+	r.fail(fmt.Errorf("unknown type %04X", kind))
+	return nil
+}
+
+// setObject takes the data of an attachment from PR_ATTACH_DATA when
+// attAttachData did not carry it. A PT_OBJECT value starts with the
+// interface ID of the object, telling an embedded message from OLE data.
+func (a *TNEFAttachment) setObject() {
+	for _, p := range a.Properties {
+		if p.ID != propAttachData {
+			continue
+		}
+		b, ok := p.Value.([]byte)
+		if !ok {
+			continue
+		}
+		if p.Type == typeObject && len(b) >= 16 {
+			a.Embedded = bytes.Equal(b[:16], iidMessage)
+			b = b[16:]
+		}
+		if a.Data == nil || a.Embedded {
+			a.Data = b
+		}
+	}
+}
+
+// findProperty returns the value of the property with the given ID, or nil.
+func findProperty(properties []MAPIProperty, id uint16) interface{} {
+	for _, p := range properties {
+		if p.ID == id {
+			return p.Value
+		}
+	}
+	return nil
+}
+
+// stringProperty returns the first of the string properties that is set.
+func stringProperty(properties []MAPIProperty, ids ...uint16) string {
+	for _, id := range ids {
+		if s, ok := findProperty(properties, id).(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// Filename returns the long filename of the attachment, falling back to
+// its title and display name.
+func (a *TNEFAttachment) Filename() string {
+	if name := stringProperty(a.Properties, propAttachLongFilename); name != "" {
+		return name
+	}
+	if a.Title != "" {
+		return a.Title
+	}
+	return stringProperty(a.Properties, propAttachFilename, propDisplayName)
+}
+
+// MediaType returns the MIME type of the attachment from PR_ATTACH_MIME_TAG
+// or the extension of its filename.
+func (a *TNEFAttachment) MediaType() string {
+	if a.Embedded {
+		return "application/ms-tnef"
+	}
+	if mediaType := stringProperty(a.Properties, propAttachMimeTag); mediaType != "" {
+		return mediaType
+	}
+	if mediaType := mime.TypeByExtension(filepath.Ext(a.Filename())); mediaType != "" {
+		mediaType, _, _ = mime.ParseMediaType(mediaType)
+		return mediaType
+	}
+	return "application/octet-stream"
+}
+
+// HTML returns the HTML body from PR_HTML or, failing that, the HTML
+// encapsulated in the compressed RTF body.
+func (t *TNEF) HTML() (string, error) {
+	switch html := findProperty(t.Properties, propHTML).(type) {
+	case string:
+		return html, nil
+	case []byte:
+		text, err := DecodeCharset(bytes.TrimRight(html, "\x00"), t.htmlCharset())
+		return string(text), err
+	}
+	rtf, err := t.RTF()
+	if err != nil || rtf == nil {
+		return "", err
+	}
+	html, _ := HTMLFromRTF(rtf)
+	return html, nil
+}
+
+// htmlCharset returns the charset of a binary PR_HTML.
+func (t *TNEF) htmlCharset() string {
+	for _, id := range []uint16{propInternetCodepage, propMessageCodepage} {
+		if codepage, ok := findProperty(t.Properties, id).(int64); ok {
+			return codepageCharset(uint32(codepage))
+		}
+	}
+	return t.charset
+}
+
+// RTF returns the decompressed RTF body, or nil if there is none.
+func (t *TNEF) RTF() ([]byte, error) {
+	compressed, ok := findProperty(t.Properties, propRTFCompressed).([]byte)
+	if !ok {
+		return nil, nil
+	}
+	rtf, err := DecompressRTF(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("RTF body: %v", err)
+	}
+	return rtf, nil
+}
+
+// PlainText returns the plain text body of attBody or PR_BODY.
+func (t *TNEF) PlainText() string {
+	if t.Body != "" {
+		return t.Body
+	}
+	return stringProperty(t.Properties, propBody)
+}
+
+// propertyReader reads the little-endian fields of a property list,
+// keeping the first error.
+type propertyReader struct {
+	b      []byte
+	offset int
+	err    error
+}
+
+func (r *propertyReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *propertyReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.offset+n > len(r.b) {
+		r.fail(fmt.Errorf("property list is truncated"))
+		return nil
+	}
+	b := r.b[r.offset : r.offset+n]
+	r.offset += n
+	return b
+}
+
+func (r *propertyReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *propertyReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *propertyReader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// pad skips to the next multiple of four bytes.
+func (r *propertyReader) pad() {
+	if n := r.offset % 4; n != 0 {
+		r.bytes(4 - n)
+	}
+}
+
+// propertyName reads the property set and the name or numeric ID of a
+// named property, formatted as "{GUID}:name" or "{GUID}:0x8501".
+func (r *propertyReader) propertyName() string {
+	guid := r.bytes(16)
+	kind := r.uint32()
+	if guid == nil {
+		return ""
+	}
+	le := binary.LittleEndian
+	set := fmt.Sprintf("{%08X-%04X-%04X-%X-%X}", le.Uint32(guid), le.Uint16(guid[4:]), le.Uint16(guid[6:]), guid[8:10], guid[10:])
+	if kind == 0 {
+		return fmt.Sprintf("%s:0x%04X", set, r.uint32())
+	}
+	name := decodeUTF16(r.bytes(int(r.uint32())))
+	r.pad()
+	return set + ":" + name
+}
+
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// filetime converts a FILETIME, counting 100 nanosecond intervals since
+// 1601, to a time.
+func filetime(ticks uint64) time.Time {
+	const unixEpoch = 116444736000000000
+	return time.Unix(0, (int64(ticks)-unixEpoch)*100).UTC()
+}
+
+// isTNEF reports whether the part is a TNEF stream, which Exchange sends as
+// application/ms-tnef or, less helpfully, as a winmail.dat attachment.
+func (p *Part) isTNEF() bool {
+	switch p.MediaType {
+	case "application/ms-tnef", "application/vnd.ms-tnef":
+		return true
+	}
+	return strings.EqualFold(p.Filename(), "winmail.dat")
+}
+
+// parseTNEF makes the bodies and attachments of a TNEF part its children:
+// the plain text body, the HTML body or else the RTF body, and then every
+// attachment under its original filename. The TNEF part keeps its body.
+func (p *Part) parseTNEF() error {
+	decoded, err := p.Decode()
+	if err != nil {
+		return err
+	}
+	if !IsTNEF(decoded) && p.MediaType != "application/ms-tnef" && p.MediaType != "application/vnd.ms-tnef" {
+		// only the filename said winmail.dat
+		return nil
+	}
+	t, err := ParseTNEF(decoded)
+	if err != nil {
+		return fmt.Errorf("part %s: %v", p.displayPath(), err)
+	}
+	p.Properties = t.Properties
+
+	var children []*Part
+	add := func(header textproto.MIMEHeader, body []byte, properties []MAPIProperty) error {
+		header.Set("Content-Transfer-Encoding", "binary")
+		child, err := newPart(p.childPath(len(children)+1), header, body, "application/octet-stream")
+		if err != nil {
+			return err
+		}
+		// an attached message also has the properties of its own stream;
+		// properties is copied so that children never share its array
+		child.Properties = append(append([]MAPIProperty(nil), properties...), child.Properties...)
+		children = append(children, child)
+		return nil
+	}
+
+	if text := t.PlainText(); text != "" {
+		header := textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}}
+		if err := add(header, []byte(text), nil); err != nil {
+			return err
+		}
+	}
+	html, err := t.HTML()
+	if err != nil {
+		return fmt.Errorf("part %s: %v", p.displayPath(), err)
+	}
+	if html != "" {
+		header := textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}}
+		if err := add(header, []byte(html), nil); err != nil {
+			return err
+		}
+	} else if rtf, err := t.RTF(); err != nil {
+		return fmt.Errorf("part %s: %v", p.displayPath(), err)
+	} else if rtf != nil {
+		header := textproto.MIMEHeader{"Content-Type": {"application/rtf"}}
+		if err := add(header, rtf, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, attachment := range t.Attachments {
+		disposition := "attachment"
+		if filename := attachment.Filename(); filename != "" {
+			sections, err := EncodeParam("filename", filename, "UTF-8")
+			if err != nil {
+				return err
+			}
+			disposition += "; " + strings.Join(sections, "; ")
+		}
+		header := textproto.MIMEHeader{
+			"Content-Type":        {attachment.MediaType()},
+			"Content-Disposition": {disposition},
+		}
+		if contentID := stringProperty(attachment.Properties, propAttachContentID); contentID != "" {
+			header.Set("Content-ID", "<"+strings.Trim(contentID, "<>")+">")
+		}
+		if err := add(header, attachment.Data, attachment.Properties); err != nil {
+			return err
+		}
+	}
+	p.Children = children
+	return nil
+}
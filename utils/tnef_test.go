@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseTNEFPart(t *testing.T) {
+	f, err := os.Open("../test_files/tnef.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	root, err := ParseMessage(f)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	testCases := []struct {
+		path      string
+		mediaType string
+		filename  string
+		content   string
+	}{
+		{"2.1", "text/plain", "", "本文です。\r\n"},
+		{"2.2", "text/html", "", "<html><body><p>本文です</p>\r\n</body></html>"},
+		{"2.3", "text/plain", "報告書.txt", "売上報告\r\n"},
+		// the title is Shift_JIS, the OEM code page of the stream
+		{"2.4", "application/pdf", "資料.pdf", "%PDF-1.4\n%%EOF\n"},
+		{"2.5", "application/ms-tnef", "転送", ""},
+		{"2.5.1", "text/plain", "", "転送本文\r\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			part := root.Find(tc.path)
+			if part == nil {
+				t.Fatalf("part %s not found", tc.path)
+			}
+			if part.MediaType != tc.mediaType {
+				t.Errorf("expected %s, got %s", tc.mediaType, part.MediaType)
+			}
+			if part.Filename() != tc.filename {
+				t.Errorf("expected filename %q, got %q", tc.filename, part.Filename())
+			}
+			if tc.content == "" {
+				return
+			}
+			text, err := part.Text()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if text != tc.content {
+				t.Errorf("expected %q, got %q", tc.content, text)
+			}
+		})
+	}
+
+	tnef := root.Find("2")
+	names := map[string]string{}
+	for _, property := range tnef.Properties {
+		names[property.CanonicalName()] = property.String()
+	}
+	expected := map[string]string{
+		"PR_SUBJECT":            "会議資料",
+		"PR_IMPORTANCE":         "2",
+		"PR_CLIENT_SUBMIT_TIME": "2023-11-14T22:13:20Z",
+		"{00062008-0000-0000-C000-000000000046}:0x8554": "16.0",
+	}
+	for name, value := range expected {
+		if names[name] != value {
+			t.Errorf("expected %s to be %q, got %q", name, value, names[name])
+		}
+	}
+}
+
+func TestParseTNEFErrors(t *testing.T) {
+	stream := []byte{0x78, 0x9F, 0x3E, 0x22, 0x00, 0x00}
+	// attSubject "Hi" with its checksum
+	subject := []byte{0x01, 0x04, 0x80, 0x01, 0x00, 0x03, 0x00, 0x00, 0x00, 'H', 'i', 0x00, 0xB1, 0x00}
+
+	parsed, err := ParseTNEF(append(append([]byte{}, stream...), subject...))
+	if err != nil || parsed.Subject != "Hi" {
+		t.Errorf("expected the subject Hi, got %v, %v", parsed, err)
+	}
+	// a cut short attribute is dropped
+	parsed, err = ParseTNEF(append(append(append([]byte{}, stream...), subject...), subject[:7]...))
+	if err != nil || parsed.Subject != "Hi" {
+		t.Errorf("expected the subject Hi, got %v, %v", parsed, err)
+	}
+
+	bad := append([]byte{}, subject...)
+	bad[len(bad)-2]++
+	testCases := []struct {
+		name        string
+		input       []byte
+		expectedErr string
+	}{
+		{"Not TNEF", []byte("plain text"), "not a TNEF stream"},
+		{"Bad checksum", append(append([]byte{}, stream...), bad...), "attribute 8004 has a bad checksum"},
+		{"Attachment first", append(append([]byte{}, stream...), 0x02, 0x10, 0x80, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00), "attribute 8010 precedes the first attachment"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseTNEF(tc.input)
+			if err == nil || err.Error() != tc.expectedErr {
+				t.Errorf("expected error %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestParseMessageDamagedTNEF(t *testing.T) {
+	// tnef-damaged.eml is tnef.eml with a byte of winmail.dat changed
+	f, err := os.Open("../test_files/tnef-damaged.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	root, err := ParseMessage(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tnef := root.Find("2")
+	if tnef.Err == nil || tnef.Err.Error() != "part 2: attribute 9006 has a bad checksum" {
+		t.Errorf("expected a bad checksum, got %v", tnef.Err)
+	}
+	if len(tnef.Children) != 0 || len(tnef.Properties) != 0 {
+		t.Errorf("expected a leaf, got %d children and %d properties", len(tnef.Children), len(tnef.Properties))
+	}
+	if text, err := root.Find("1").Text(); err != nil || text != "See the attachment." {
+		t.Errorf("expected the text part, got %q, %v", text, err)
+	}
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Unmappable is a policy for characters that a charset cannot encode.
+type Unmappable string
+
+const (
+	// UnmappableFail reports the first character that cannot be encoded.
+	UnmappableFail Unmappable = "fail"
+	// UnmappableSubstitute replaces each such character with 〓 or "?".
+	UnmappableSubstitute Unmappable = "substitute"
+	// UnmappableTransliterate replaces each such character with a look-alike
+	// the charset has, such as ～ for 〜 in Windows-31J or (株) for ㈱, and
+	// substitutes the rest.
+	UnmappableTransliterate Unmappable = "transliterate"
+	// UnmappableUTF8 switches the whole text to UTF-8.
+	UnmappableUTF8 Unmappable = "utf8"
+)
+
+// UnmappablePolicies lists the accepted policies in the order they are
+// documented.
+var UnmappablePolicies = []Unmappable{UnmappableFail, UnmappableSubstitute, UnmappableTransliterate, UnmappableUTF8}
+
+// ParseUnmappable returns the policy named s.
+func ParseUnmappable(s string) (Unmappable, error) {
+	for _, policy := range UnmappablePolicies {
+		if strings.EqualFold(s, string(policy)) {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unmappable must be one of fail, substitute, transliterate or utf8")
+}
+
+// UnmappableError is returned when a character cannot be encoded in a
+// charset. Offset counts characters from the start of the text.
+type UnmappableError struct {
+	Charset string
+	Rune    rune
+	Offset  int
+}
+
+func (e *UnmappableError) Error() string {
+	return fmt.Sprintf("%q (U+%04X) at offset %d cannot be encoded in %s", e.Rune, e.Rune, e.Offset, e.Charset)
+}
+
+// substitutes are tried in order by UnmappableSubstitute. 〓 (geta) is the
+// customary mark for a missing character in Japanese text.
+var substitutes = []string{"〓", "?"}
+
+// transliterations map characters to the look-alikes the JIS charsets use
+// for them. The JIS forms such as 〜 only need their Microsoft forms in
+// Windows-31J and ISO-2022-JP-MS, since Shift_JIS and ISO-2022-JP encode
+// them as they are. Anything else is tried in its NFKC form.
+var transliterations = map[rune]string{
+	'〜': "～",
+	'−': "－",
+	'‖': "∥",
+	'—': "―",
+	'¢': "￠",
+	'£': "￡",
+	'¬': "￢",
+	'¥': "￥",
+}
+
+// ApplyUnmappable rewrites s according to policy so that it can be encoded
+// in charset, and returns the text and the charset to encode it with, which
+// is charset itself unless the policy is UnmappableUTF8.
+func ApplyUnmappable(s, charset string, policy Unmappable) (string, string, error) {
+	losses, err := unmappableRunes(s, charset)
+	if err != nil || len(losses) == 0 {
+		return s, charset, err
+	}
+	switch policy {
+	case UnmappableUTF8:
+		return s, "UTF-8", nil
+	case UnmappableSubstitute, UnmappableTransliterate:
+		lost := make(map[int]bool)
+		for _, loss := range losses {
+			lost[loss.Offset] = true
+		}
+		var b strings.Builder
+		offset := 0
+		for _, r := range s {
+			if !lost[offset] {
+				b.WriteRune(r)
+			} else if policy == UnmappableTransliterate {
+				b.WriteString(transliterate(r, charset))
+			} else {
+				b.WriteString(substitute(charset))
+			}
+			offset++
+		}
+		return b.String(), charset, nil
+	default:
+		mimeName, _, _ := LookupCharset(charset)
+		return "", "", &UnmappableError{Charset: mimeName, Rune: losses[0].Rune, Offset: losses[0].Offset}
+	}
+}
+
+// unmappableRunes returns the characters of s that charset cannot encode at
+// all, leaving out those that only come back in another form.
+func unmappableRunes(s, charset string) ([]Loss, error) {
+	losses, err := CharsetLosses(s, charset)
+	if err != nil {
+		return nil, err
+	}
+	var unmappable []Loss
+	for _, loss := range losses {
+		if loss.Replacement == "" {
+			unmappable = append(unmappable, loss)
+		}
+	}
+	return unmappable, nil
+}
+
+func transliterate(r rune, charset string) string {
+	for _, candidate := range []string{transliterations[r], norm.NFKC.String(string(r))} {
+		if candidate == "" || candidate == string(r) {
+			continue
+		}
+		if losses, err := unmappableRunes(candidate, charset); err == nil && len(losses) == 0 {
+			return candidate
+		}
+	}
+	return substitute(charset)
+}
+
+func substitute(charset string) string {
+	for _, candidate := range substitutes {
+		if losses, err := unmappableRunes(candidate, charset); err == nil && len(losses) == 0 {
+			return candidate
+		}
+	}
+	return "?"
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyUnmappable(t *testing.T) {
+	testCases := []struct {
+		name            string
+		input           string
+		charset         string
+		policy          Unmappable
+		expectedText    string
+		expectedCharset string
+		expectedErr     string
+	}{
+		{
+			name:            "Representable text is kept",
+			input:           "こんにちは",
+			charset:         "iso2022jp",
+			policy:          UnmappableFail,
+			expectedText:    "こんにちは",
+			expectedCharset: "iso2022jp",
+		},
+		{
+			name:        "Fail reports the first character",
+			input:       "会社㈱😀",
+			charset:     "ISO-2022-JP",
+			policy:      UnmappableFail,
+			expectedErr: "'㈱' (U+3231) at offset 2 cannot be encoded in ISO-2022-JP",
+		},
+		{
+			name:            "Substitute",
+			input:           "a😀b",
+			charset:         "Shift_JIS",
+			policy:          UnmappableSubstitute,
+			expectedText:    "a〓b",
+			expectedCharset: "Shift_JIS",
+		},
+		{
+			name:            "Substitute without geta",
+			input:           "a😀b",
+			charset:         "ISO-8859-1",
+			policy:          UnmappableSubstitute,
+			expectedText:    "a?b",
+			expectedCharset: "ISO-8859-1",
+		},
+		{
+			name:            "Transliterate",
+			input:           "㈱①〜ｶﾅ−¥😀",
+			charset:         "ISO-2022-JP",
+			policy:          UnmappableTransliterate,
+			expectedText:    "(株)1〜カナ−￥〓",
+			expectedCharset: "ISO-2022-JP",
+		},
+		{
+			name:            "JIS forms are kept",
+			input:           "〜−‖—¢£¬",
+			charset:         "Shift_JIS",
+			policy:          UnmappableFail,
+			expectedText:    "〜−‖—¢£¬",
+			expectedCharset: "Shift_JIS",
+		},
+		{
+			name:            "Transliterate to the Microsoft forms",
+			input:           "〜−‖—¢£¬",
+			charset:         "ISO-2022-JP-MS",
+			policy:          UnmappableTransliterate,
+			expectedText:    "～－∥―￠￡￢",
+			expectedCharset: "ISO-2022-JP-MS",
+		},
+		{
+			name:            "Upgrade to UTF-8",
+			input:           "㈱",
+			charset:         "ISO-2022-JP",
+			policy:          UnmappableUTF8,
+			expectedText:    "㈱",
+			expectedCharset: "UTF-8",
+		},
+		{
+			name:            "Windows-31J has the NEC special characters",
+			input:           "㈱①",
+			charset:         "cp932",
+			policy:          UnmappableFail,
+			expectedText:    "㈱①",
+			expectedCharset: "cp932",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			text, charset, err := ApplyUnmappable(tc.input, tc.charset, tc.policy)
+			if tc.expectedErr != "" {
+				var unmappable *UnmappableError
+				if !errors.As(err, &unmappable) || err.Error() != tc.expectedErr {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if text != tc.expectedText || charset != tc.expectedCharset {
+				t.Fatalf("expected %q in %s, got %q in %s", tc.expectedText, tc.expectedCharset, text, charset)
+			}
+		})
+	}
+}
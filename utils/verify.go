@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Loss is a character of the original text that does not survive conversion
+// to a charset. Offset counts characters, not bytes. Replacement is what the
+// character comes back as, or empty if the charset cannot encode it at all.
+type Loss struct {
+	Offset      int
+	Rune        rune
+	Replacement string
+}
+
+func (l Loss) String() string {
+	if l.Replacement == "" {
+		return fmt.Sprintf("%q (U+%04X) at %d cannot be encoded", l.Rune, l.Rune, l.Offset)
+	}
+	return fmt.Sprintf("%q (U+%04X) at %d comes back as %q", l.Rune, l.Rune, l.Offset, l.Replacement)
+}
+
+// CharsetLosses converts s to charset and back one character at a time and
+// returns the characters that do not come back unchanged. Shift_JIS and
+// ISO-2022-JP are read back as StrictJIS does, so ～ is lost to 〜.
+func CharsetLosses(s, charset string) ([]Loss, error) {
+	_, enc, err := LookupCharset(charset)
+	if err != nil {
+		return nil, err
+	}
+	repertoire := jisRepertoire(charset)
+	var losses []Loss
+	offset := 0
+	for _, r := range s {
+		encoded, err := enc.NewEncoder().String(string(r))
+		if err != nil || (repertoire != nil && !repertoire(r)) {
+			losses = append(losses, Loss{Offset: offset, Rune: r})
+		} else if decoded, err := enc.NewDecoder().String(encoded); err != nil || StrictJIS(decoded, charset) != string(r) {
+			losses = append(losses, Loss{Offset: offset, Rune: r, Replacement: StrictJIS(decoded, charset)})
+		}
+		offset++
+	}
+	return losses, nil
+}
+
+// DecodeField decodes a complete, possibly folded header field such as
+// "Subject: =?UTF-8?b?...?=" through the same path as DecodeHeaders.
+func DecodeField(field string) (string, error) {
+	headers, err := ReadHeaders(strings.NewReader(field + "\r\n\r\n"))
+	if err != nil {
+		return "", err
+	}
+	if len(headers) != 1 {
+		return "", fmt.Errorf("expected a single header field, got %d", len(headers))
+	}
+	if headers[0].Err != nil {
+		return "", fmt.Errorf("failed to decode %s: %v", headers[0].Name, headers[0].Err)
+	}
+	return headers[0].Decoded, nil
+}
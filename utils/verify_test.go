@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsEncodedWord(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected bool
+	}{
+		{"=?UTF-8?B?44GT44KT?=", true},
+		{"=?UTF-8?b?44GT44KT?=", true},
+		{"=?iso-2022-jp?q?=1B$B$3$s=1B(B?=", true},
+		{"=?UTF-8*ja?Q?abc?=", true},
+		{"=?UTF-8?X?abc?=", false},
+		{"=?UTF-8?B?44 GT?=", false},
+		{"=?UTF-8?B?abc?= tail", false},
+		{"=?(bad)?B?abc?=", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			if got := IsEncodedWord(tc.input); got != tc.expected {
+				t.Fatalf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCharsetLosses(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		charset  string
+		expected []Loss
+	}{
+		{
+			name:    "Representable",
+			input:   "こんにちは",
+			charset: "ISO-2022-JP",
+		},
+		{
+			name:    "Microsoft forms",
+			input:   "～∥－",
+			charset: "Shift_JIS",
+			expected: []Loss{
+				{Offset: 0, Rune: '～', Replacement: "〜"},
+				{Offset: 1, Rune: '∥', Replacement: "‖"},
+				{Offset: 2, Rune: '－', Replacement: "−"},
+			},
+		},
+		{
+			name:    "Microsoft forms in ISO-2022-JP-MS",
+			input:   "～∥－",
+			charset: "ISO-2022-JP-MS",
+		},
+		{
+			name:     "NEC special characters",
+			input:    "①㈱",
+			charset:  "ISO-2022-JP",
+			expected: []Loss{{Offset: 0, Rune: '①'}, {Offset: 1, Rune: '㈱'}},
+		},
+		{
+			name:    "NEC special characters in ISO-2022-JP-MS",
+			input:   "①㈱",
+			charset: "ISO-2022-JP-MS",
+		},
+		{
+			name:    "Emoji and symbols",
+			input:   "a😀b−〜",
+			charset: "Shift_JIS",
+			expected: []Loss{
+				{Offset: 1, Rune: '😀'},
+			},
+		},
+		{
+			name:     "JIS forms in Windows-31J",
+			input:    "−〜",
+			charset:  "Windows-31J",
+			expected: []Loss{{Offset: 0, Rune: '−'}, {Offset: 1, Rune: '〜'}},
+		},
+		{
+			name:     "UTF-8 keeps everything",
+			input:    "😀−～",
+			charset:  "UTF-8",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			losses, err := CharsetLosses(tc.input, tc.charset)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(losses, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, losses)
+			}
+		})
+	}
+}
+
+func TestDecodeField(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Lowercase encoding",
+			input:    "Subject: =?UTF-8?b?44GT44KT44Gr44Gh44Gv?=",
+			expected: "こんにちは",
+		},
+		{
+			name:     "Folded",
+			input:    "Subject: =?ISO-2022-JP?b?GyRCJDMkcxsoQg==?=\r\n =?ISO-2022-JP?q?=1B$B$K$A$O=1B(B?=",
+			expected: "こんにちは",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			decoded, err := DecodeField(tc.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if decoded != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, decoded)
+			}
+		})
+	}
+}